@@ -4,6 +4,8 @@ import (
 	"context"
 	"flag"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/fieryorc/BedrockServerManager/svrmgr"
 	"github.com/golang/glog"
@@ -12,10 +14,25 @@ import (
 func main() {
 	flag.Parse()
 	glog.Error()
-	mgr := svrmgr.NewServerManager()
+	mgr, err := svrmgr.NewServerManager()
+	if err != nil {
+		glog.Exitf("%v", err)
+	}
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	err := mgr.Process(ctx, os.Args)
+
+	// Stop the server cleanly when the manager is terminated.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		glog.Infof("received %v", sig)
+		mgr.Shutdown(ctx)
+		glog.Flush()
+		os.Exit(0)
+	}()
+
+	err = mgr.Process(ctx, os.Args)
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,412 @@
+package svrmgr
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+var apiAddress = flag.String("api_address", "", "bind address for the HTTP API. for example localhost:8080. API is disabled if empty")
+var apiToken = flag.String("api_token", "", "if set, HTTP API requests must send the header 'Authorization: Bearer TOKEN'")
+
+// apiResponse is the JSON response for all the API requests.
+type apiResponse struct {
+	// Output printed by the command.
+	Output []string `json:"output"`
+	// Result is the typed result for the commands that produce data.
+	// For example, the ServerStatus for the status request.
+	Result interface{} `json:"result,omitempty"`
+	// Error is set if the request failed.
+	Error string `json:"error,omitempty"`
+}
+
+// apiServer exposes the commands over HTTP.
+// Requests are translated to commands and run through the registered handlers,
+// so the API behaves exactly like the console.
+//
+//	GET  /api/status
+//	POST /api/start
+//	POST /api/stop             {"warning": "5m"}
+//	POST /api/command          {"command": "list"}
+//	GET  /api/backups          ?filter=saves/manual/*
+//	POST /api/backups          {"description": "Built a gold farm"}
+//	POST /api/backups/restore  {"name": "saves/manual/20211002-120000"}
+//	POST /api/backups/prune    {"cutoff": "3d", "interval": "1d", "dry_run": true, "force": false}
+//	GET  /api/backups/diff     ?from=saves/manual/20211002-120000&to=saves/manual/20211003-120000
+//	GET  /api/logs             ?lines=20
+//	GET  /api/players
+//	GET  /api/players/history?name=NAME
+//	GET  /api/players/top?count=N
+type apiServer struct {
+	sm *ServerManager
+	// Commands run with this context instead of the request context,
+	// so that the started server outlives the request.
+	ctx context.Context
+	mux *http.ServeMux
+}
+
+// newAPIServer creates the API handler.
+func newAPIServer(ctx context.Context, sm *ServerManager) *apiServer {
+	s := &apiServer{
+		sm:  sm,
+		ctx: ctx,
+		mux: http.NewServeMux(),
+	}
+	s.mux.HandleFunc("/api/status", s.method(http.MethodGet, s.handleStatus))
+	s.mux.HandleFunc("/api/start", s.method(http.MethodPost, s.handleStart))
+	s.mux.HandleFunc("/api/stop", s.method(http.MethodPost, s.handleStop))
+	s.mux.HandleFunc("/api/command", s.method(http.MethodPost, s.handleCommand))
+	s.mux.HandleFunc("/api/backups", s.handleBackups)
+	s.mux.HandleFunc("/api/backups/restore", s.method(http.MethodPost, s.handleRestore))
+	s.mux.HandleFunc("/api/backups/prune", s.method(http.MethodPost, s.handlePrune))
+	s.mux.HandleFunc("/api/backups/diff", s.method(http.MethodGet, s.handleDiff))
+	s.mux.HandleFunc("/api/logs", s.method(http.MethodGet, s.handleLogs))
+	s.mux.HandleFunc("/api/players", s.method(http.MethodGet, s.handlePlayers))
+	s.mux.HandleFunc("/api/players/history", s.method(http.MethodGet, s.handlePlayerHistory))
+	s.mux.HandleFunc("/api/players/top", s.method(http.MethodGet, s.handlePlayersTop))
+	return s
+}
+
+// serveAPI runs the HTTP API until the context is done.
+func (sm *ServerManager) serveAPI(ctx context.Context, addr string) {
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: newAPIServer(ctx, sm),
+	}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+
+	sm.Log(fmt.Sprintf("HTTP API listening on %s", addr))
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		sm.Log(fmt.Sprintf("HTTP API failed. %v", err))
+	}
+}
+
+// ServeHTTP authorizes the request and routes it.
+func (s *apiServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	glog.Infof("API request %s %s", r.Method, r.URL.Path)
+	if *apiToken != "" && r.Header.Get("Authorization") != "Bearer "+*apiToken {
+		writeAPIError(w, http.StatusUnauthorized, "invalid or missing token")
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *apiServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	s.run(w, "status")
+}
+
+func (s *apiServer) handleStart(w http.ResponseWriter, r *http.Request) {
+	if s.sm.GetServerProcess().IsRunning() {
+		writeAPIError(w, http.StatusConflict, "server already running")
+		return
+	}
+	s.run(w, "start")
+}
+
+func (s *apiServer) handleStop(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Warning string `json:"warning"`
+	}
+	if !decodeAPIRequest(w, r, &req) {
+		return
+	}
+	if !s.sm.GetServerProcess().IsRunning() {
+		writeAPIError(w, http.StatusConflict, "server not running")
+		return
+	}
+
+	cmd := []string{"stop"}
+	warning := *stopWarning
+	if req.Warning != "" {
+		var err error
+		if warning, err = parseDuration(req.Warning); err != nil {
+			writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("invalid warning period. %v", err))
+			return
+		}
+		cmd = append(cmd, req.Warning)
+	}
+	if warning == 0 {
+		s.run(w, cmd...)
+		return
+	}
+
+	// The countdown runs in the background, so the request does not wait for it.
+	go func() {
+		glog.Infof("API running command '%s'", strings.Join(cmd, " "))
+		if err := s.sm.dispatchCommand(s.ctx, s.sm, cmd); err != nil {
+			s.sm.Log(err.Error())
+		}
+	}()
+	writeAPIResponse(w, http.StatusAccepted, apiResponse{
+		Output: []string{fmt.Sprintf("server stopping in %v", warning)},
+	})
+}
+
+func (s *apiServer) handleCommand(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Command string `json:"command"`
+	}
+	if !decodeAPIRequest(w, r, &req) {
+		return
+	}
+	if strings.TrimSpace(req.Command) == "" {
+		writeAPIError(w, http.StatusBadRequest, "command must be specified")
+		return
+	}
+	if !s.sm.GetServerProcess().IsRunning() {
+		writeAPIError(w, http.StatusConflict, "server not running")
+		return
+	}
+	s.run(w, append([]string{"server"}, strings.Fields(req.Command)...)...)
+}
+
+func (s *apiServer) handleBackups(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.run(w, append([]string{"backup", "list"}, r.URL.Query()["filter"]...)...)
+	case http.MethodPost:
+		var req struct {
+			Description string `json:"description"`
+		}
+		if !decodeAPIRequest(w, r, &req) {
+			return
+		}
+		if strings.TrimSpace(req.Description) == "" {
+			writeAPIError(w, http.StatusBadRequest, "backup description must be specified")
+			return
+		}
+		s.run(w, append([]string{"backup", "save"}, strings.Fields(req.Description)...)...)
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, fmt.Sprintf("method %s not allowed", r.Method))
+	}
+}
+
+func (s *apiServer) handleRestore(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if !decodeAPIRequest(w, r, &req) {
+		return
+	}
+	if req.Name == "" || strings.ContainsAny(req.Name, " \t") {
+		writeAPIError(w, http.StatusBadRequest, "invalid backup name")
+		return
+	}
+	if s.sm.GetServerProcess().IsRunning() {
+		writeAPIError(w, http.StatusConflict, "stop the server before restoring the backup")
+		return
+	}
+	s.run(w, "backup", "restore", req.Name)
+}
+
+func (s *apiServer) handlePrune(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Cutoff   string `json:"cutoff"`
+		Interval string `json:"interval"`
+		DryRun   bool   `json:"dry_run"`
+		Force    bool   `json:"force"`
+	}
+	if !decodeAPIRequest(w, r, &req) {
+		return
+	}
+	cmd := []string{"backup", "prune"}
+	if req.DryRun {
+		cmd = append(cmd, "--dry-run")
+	}
+	if req.Force {
+		cmd = append(cmd, "--force")
+	}
+	// Without cutoff and interval, the retention policies are applied.
+	if req.Cutoff != "" || req.Interval != "" {
+		for _, d := range []string{req.Cutoff, req.Interval} {
+			if _, err := parseDuration(d); err != nil {
+				writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("invalid duration '%s'. both cutoff and interval must be specified", d))
+				return
+			}
+		}
+		cmd = append(cmd, req.Cutoff, req.Interval)
+	}
+	s.run(w, cmd...)
+}
+
+func (s *apiServer) handleDiff(w http.ResponseWriter, r *http.Request) {
+	cmd := []string{"backup", "diff"}
+	// Without to, the backup is compared with the workspace.
+	for _, key := range []string{"from", "to"} {
+		name := r.URL.Query().Get(key)
+		if name == "" && key == "to" {
+			break
+		}
+		if name == "" || strings.ContainsAny(name, " \t") {
+			writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("invalid backup name '%s'", name))
+			return
+		}
+		cmd = append(cmd, name)
+	}
+	s.run(w, cmd...)
+}
+
+func (s *apiServer) handleLogs(w http.ResponseWriter, r *http.Request) {
+	cmd := []string{"log", "tail"}
+	if lines := r.URL.Query().Get("lines"); lines != "" {
+		if n, err := strconv.Atoi(lines); err != nil || n < 0 {
+			writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("invalid line count '%s'", lines))
+			return
+		}
+		cmd = append(cmd, lines)
+	}
+	s.run(w, cmd...)
+}
+
+func (s *apiServer) handlePlayers(w http.ResponseWriter, r *http.Request) {
+	s.run(w, "players")
+}
+
+func (s *apiServer) handlePlayerHistory(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		writeAPIError(w, http.StatusBadRequest, "name must be specified")
+		return
+	}
+	s.run(w, "players", "history", name)
+}
+
+func (s *apiServer) handlePlayersTop(w http.ResponseWriter, r *http.Request) {
+	cmd := []string{"players", "top"}
+	if count := r.URL.Query().Get("count"); count != "" {
+		if n, err := strconv.Atoi(count); err != nil || n < 1 {
+			writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("invalid player count '%s'", count))
+			return
+		}
+		cmd = append(cmd, count)
+	}
+	s.run(w, cmd...)
+}
+
+// method rejects the requests with other methods.
+func (s *apiServer) method(method string, fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			writeAPIError(w, http.StatusMethodNotAllowed, fmt.Sprintf("method %s not allowed", r.Method))
+			return
+		}
+		fn(w, r)
+	}
+}
+
+// run runs the command through the handlers and writes the output along with
+// the typed result. Command failures are reported with the status code of the error kind.
+func (s *apiServer) run(w http.ResponseWriter, cmd ...string) {
+	glog.Infof("API running command '%s'", strings.Join(cmd, " "))
+	p := &apiProvider{ServerManager: s.sm}
+	result, err := s.sm.dispatchCommandResult(s.ctx, p, cmd)
+	resp := apiResponse{Output: p.finish(), Result: result}
+	status := http.StatusOK
+	if err != nil {
+		status = apiErrorStatus(err)
+		resp.Error = err.Error()
+	}
+	writeAPIResponse(w, status, resp)
+}
+
+// apiErrorStatus returns the HTTP status code for the command error.
+func apiErrorStatus(err error) int {
+	switch errorKind(err) {
+	case ErrorKindInvalidArgs:
+		return http.StatusBadRequest
+	case ErrorKindNotFound:
+		return http.StatusNotFound
+	case ErrorKindConflict:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// decodeAPIRequest decodes the optional JSON request body.
+// Writes the error response and returns false if the body is invalid.
+func decodeAPIRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.ContentLength == 0 {
+		return true
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body. %v", err))
+		return false
+	}
+	return true
+}
+
+func writeAPIError(w http.ResponseWriter, status int, msg string) {
+	writeAPIResponse(w, status, apiResponse{Output: []string{}, Error: msg})
+}
+
+func writeAPIResponse(w http.ResponseWriter, status int, resp apiResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		glog.Errorf("unable to write API response. %v", err)
+	}
+}
+
+// apiProvider records the output of a command run through the API.
+// Output is also printed to the console. Output printed after the command
+// completes, such as the server output after start, goes to the console only.
+type apiProvider struct {
+	*ServerManager
+	lock   sync.Mutex
+	output []string
+	done   bool
+}
+
+func (p *apiProvider) Println(str string) {
+	p.ServerManager.Println(str)
+	p.record(str)
+}
+
+func (p *apiProvider) Printf(format string, args ...interface{}) {
+	p.ServerManager.Printf(format, args...)
+	p.record(fmt.Sprintf(format, args...))
+}
+
+func (p *apiProvider) Printfln(format string, args ...interface{}) {
+	p.ServerManager.Printfln(format, args...)
+	p.record(fmt.Sprintf(format, args...))
+}
+
+func (p *apiProvider) Log(line string) {
+	p.ServerManager.Log(line)
+	p.record(line)
+}
+
+// record adds the output lines, unless the command already completed.
+func (p *apiProvider) record(str string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.done {
+		return
+	}
+	for _, l := range strings.Split(strings.TrimRight(str, "\r\n"), "\n") {
+		p.output = append(p.output, strings.TrimRight(l, "\r"))
+	}
+}
+
+// finish stops recording and returns the recorded output.
+func (p *apiProvider) finish() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.done = true
+	if p.output == nil {
+		return []string{}
+	}
+	return p.output
+}
@@ -0,0 +1,276 @@
+package svrmgr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// apiTest runs the API against the mocked server manager.
+type apiTest struct {
+	*svrmgrTest
+	srv *httptest.Server
+}
+
+func newAPITest(t *testing.T) *apiTest {
+	st := newSvrMgrTest(t)
+	at := &apiTest{
+		svrmgrTest: st,
+		srv:        httptest.NewServer(newAPIServer(context.Background(), st.sm)),
+	}
+	t.Cleanup(at.srv.Close)
+	return at
+}
+
+// apiTestResponse is the apiResponse with the result left encoded.
+type apiTestResponse struct {
+	Output []string        `json:"output"`
+	Result json.RawMessage `json:"result"`
+	Error  string          `json:"error"`
+}
+
+// request sends the request and decodes the response.
+func (at *apiTest) request(t *testing.T, method, path, body string) (int, apiTestResponse) {
+	req, err := http.NewRequest(method, at.srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("unexpected content type %s", ct)
+	}
+	var result apiTestResponse
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("invalid response. %v", err)
+	}
+	return resp.StatusCode, result
+}
+
+func TestAPI_Status(t *testing.T) {
+	at := newAPITest(t)
+	defer at.close(t)
+
+	at.spMock.EXPECT().IsRunning().Return(true)
+	at.gwMock.EXPECT().IsDirClean(gomock.Any()).Return(false, nil)
+	at.expectStorageStats()
+
+	code, resp := at.request(t, http.MethodGet, "/api/status", "")
+	if code != http.StatusOK || resp.Error != "" {
+		t.Fatalf("unexpected response %d %v", code, resp)
+	}
+	var status map[string]interface{}
+	if err := json.Unmarshal(resp.Result, &status); err != nil {
+		t.Fatalf("invalid result %s. %v", resp.Result, err)
+	}
+	if status["server_running"] != true || status["workspace_clean"] != false {
+		t.Errorf("unexpected status %s", resp.Result)
+	}
+	if backup := status["backup"].(map[string]interface{}); backup["interval"] != "30m0s" {
+		t.Errorf("unexpected backup status %v", backup)
+	}
+	if sv := status["supervisor"].(map[string]interface{}); sv["policy"] != "on-failure" {
+		t.Errorf("unexpected supervisor status %v", sv)
+	}
+	if storage := status["storage"].(map[string]interface{}); storage["repository_size"] != 2048.0 {
+		t.Errorf("unexpected storage status %v", storage)
+	}
+}
+
+func TestAPI_Backups(t *testing.T) {
+	at := newAPITest(t)
+	defer at.close(t)
+
+	at.gwMock.EXPECT().ListBranches(gomock.Any(), gomock.Any(), []string{"saves/manual/*"}).Return([]GitReference{
+		{Ref: "refs/heads/saves/manual/1", Type: GitReferenceTypeBranch},
+		{Ref: "refs/heads/saves/manual/2", Type: GitReferenceTypeBranch, IsHead: true},
+	}, nil)
+
+	code, resp := at.request(t, http.MethodGet, "/api/backups?filter=saves/manual/*", "")
+	if code != http.StatusOK {
+		t.Fatalf("unexpected response %d %v", code, resp)
+	}
+	var refs []GitReference
+	if err := json.Unmarshal(resp.Result, &refs); err != nil {
+		t.Fatalf("invalid result %s. %v", resp.Result, err)
+	}
+	if len(refs) != 2 || refs[1].Ref != "refs/heads/saves/manual/2" || !refs[1].IsHead {
+		t.Errorf("unexpected result %s", resp.Result)
+	}
+
+	at.spMock.EXPECT().IsRunning().Return(false)
+	at.gwMock.EXPECT().IsDirClean(gomock.Any()).Return(false, nil)
+	at.gwMock.EXPECT().RunGitCommand(gomock.Any(), "add", ".")
+	at.gwMock.EXPECT().RunGitCommand(gomock.Any(), "checkout", "--orphan", gomock.Any())
+	at.gwMock.EXPECT().RunGitCommand(gomock.Any(), "commit", "--allow-empty", "-m", "built a farm")
+
+	// Commands without a result return the output.
+	code, resp = at.request(t, http.MethodPost, "/api/backups", `{"description": "built a farm"}`)
+	if code != http.StatusOK || len(resp.Output) != 1 || resp.Output[0] != "backup success" || resp.Result != nil {
+		t.Errorf("unexpected response %d %v", code, resp)
+	}
+}
+
+func TestAPI_CommandFailure(t *testing.T) {
+	at := newAPITest(t)
+	defer at.close(t)
+
+	at.spMock.EXPECT().IsRunning().Return(false).Times(2)
+	at.gwMock.EXPECT().IsDirClean(gomock.Any()).Return(false, fmt.Errorf("git failed"))
+
+	code, resp := at.request(t, http.MethodPost, "/api/backups/restore", `{"name": "saves/manual/1"}`)
+	if code != http.StatusInternalServerError || resp.Error != "git failed" {
+		t.Errorf("unexpected response %d %v", code, resp)
+	}
+}
+
+func TestAPI_ErrorCodes(t *testing.T) {
+	at := newAPITest(t)
+	defer at.close(t)
+
+	at.spMock.EXPECT().IsRunning().Return(false).AnyTimes()
+	at.gwMock.EXPECT().ListBranches(gomock.Any(), gomock.Any(), []string{"saves/manual/missing"}).Return(nil, nil)
+	gomock.InOrder(
+		at.gwMock.EXPECT().IsDirClean(gomock.Any()).Return(false, nil),
+		at.gwMock.EXPECT().IsDirClean(gomock.Any()).Return(true, nil),
+	)
+	at.gwMock.EXPECT().RunGitCommand(gomock.Any(), "checkout", "saves/manual/missing").
+		Return("error: pathspec 'saves/manual/missing' did not match any file(s) known to git", fmt.Errorf("git command failed with exit code 1"))
+
+	tests := []struct {
+		method, path, body string
+		code               int
+		err                string
+	}{
+		// The handler errors are mapped to the status codes.
+		{http.MethodGet, "/api/backups/diff?from=saves/manual/missing", "", http.StatusNotFound, "backup saves/manual/missing not found"},
+		{http.MethodGet, "/api/players/history?name=nobody", "", http.StatusNotFound, "no sessions found for 'nobody'"},
+		{http.MethodPost, "/api/backups/restore", `{"name": "saves/manual/missing"}`, http.StatusConflict, "there are changes since last backup"},
+		{http.MethodPost, "/api/backups/restore", `{"name": "saves/manual/missing"}`, http.StatusNotFound, "backup saves/manual/missing not found"},
+		{http.MethodPost, "/api/backups/prune", "", http.StatusBadRequest, "no retention policies"},
+	}
+	for _, tc := range tests {
+		code, resp := at.request(t, tc.method, tc.path, tc.body)
+		if code != tc.code || !strings.HasPrefix(resp.Error, tc.err) {
+			t.Errorf("%s %s %s: expected %d %q, got %d %q", tc.method, tc.path, tc.body, tc.code, tc.err, code, resp.Error)
+		}
+	}
+}
+
+func TestAPI_ErrorStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		code int
+	}{
+		{invalidArgsErrorf("invalid args"), http.StatusBadRequest},
+		{notFoundErrorf("backup x not found"), http.StatusNotFound},
+		{conflictErrorf("stop the server"), http.StatusConflict},
+		{fmt.Errorf("wrapped. %w", conflictErrorf("server already running")), http.StatusConflict},
+		{fmt.Errorf("git failed"), http.StatusInternalServerError},
+	}
+	for _, tc := range tests {
+		if code := apiErrorStatus(tc.err); code != tc.code {
+			t.Errorf("%v: expected %d, got %d", tc.err, tc.code, code)
+		}
+	}
+}
+
+func TestAPI_StopWithWarning(t *testing.T) {
+	at := newAPITest(t)
+	defer at.close(t)
+
+	stopped := make(chan struct{})
+	at.spMock.EXPECT().IsRunning().Return(true).Times(2)
+	at.spMock.EXPECT().SendInput("say Server stopping in 1s")
+	at.spMock.EXPECT().Stop(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, timeout time.Duration) error {
+		close(stopped)
+		return nil
+	})
+
+	// The request returns before the countdown is over.
+	start := time.Now()
+	code, resp := at.request(t, http.MethodPost, "/api/stop", `{"warning": "1s"}`)
+	if code != http.StatusAccepted || len(resp.Output) != 1 || resp.Output[0] != "server stopping in 1s" {
+		t.Errorf("unexpected response %d %v", code, resp)
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("request waited for the countdown. %v", elapsed)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(time.Second * 10):
+		t.Fatalf("server not stopped")
+	}
+}
+
+func TestAPI_InvalidRequests(t *testing.T) {
+	at := newAPITest(t)
+	defer at.close(t)
+
+	at.spMock.EXPECT().IsRunning().Return(false).AnyTimes()
+
+	tests := []struct {
+		method, path, body string
+		code               int
+	}{
+		{http.MethodPost, "/api/status", "", http.StatusMethodNotAllowed},
+		{http.MethodDelete, "/api/backups", "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/api/backups", `{"description": ""}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/backups", `{"description":`, http.StatusBadRequest},
+		{http.MethodPost, "/api/backups/prune", `{"cutoff": "3d"}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/backups/restore", `{"name": "a b"}`, http.StatusBadRequest},
+		{http.MethodGet, "/api/backups/diff?to=saves/manual/1", "", http.StatusBadRequest},
+		{http.MethodGet, "/api/logs?lines=abc", "", http.StatusBadRequest},
+		{http.MethodPost, "/api/command", `{"command": "list"}`, http.StatusConflict},
+		{http.MethodPost, "/api/stop", "", http.StatusConflict},
+		{http.MethodGet, "/api/nothing", "", http.StatusNotFound},
+	}
+	for _, tc := range tests {
+		req, _ := http.NewRequest(tc.method, at.srv.URL+tc.path, strings.NewReader(tc.body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.code {
+			t.Errorf("%s %s %s: expected %d, got %d", tc.method, tc.path, tc.body, tc.code, resp.StatusCode)
+		}
+	}
+}
+
+func TestAPI_Token(t *testing.T) {
+	at := newAPITest(t)
+	defer at.close(t)
+
+	old := *apiToken
+	*apiToken = "secret"
+	defer func() { *apiToken = old }()
+	at.spMock.EXPECT().Logs().Return(NewLogBuffer(10))
+
+	code, resp := at.request(t, http.MethodGet, "/api/logs", "")
+	if code != http.StatusUnauthorized || resp.Error == "" {
+		t.Errorf("unexpected response %d %v", code, resp)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, at.srv.URL+"/api/logs", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	httpResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		t.Errorf("expected %d, got %d", http.StatusOK, httpResp.StatusCode)
+	}
+}
@@ -0,0 +1,116 @@
+package svrmgr
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/fieryorc/BedrockServerManager/winutils"
+)
+
+// serverConfigFiles are the server settings files whose changes are shown in full by backup diff.
+var serverConfigFiles = []string{"server.properties", "permissions.json", "allowlist.json", "whitelist.json"}
+
+// BackupDiff is the result of the backup diff command.
+type BackupDiff struct {
+	From      string       `json:"from"`
+	To        string       `json:"to"` // Empty if compared with the workspace.
+	Files     []FileChange `json:"files"`
+	SizeDelta int64        `json:"size_delta"` // Change in the total size of the files in bytes.
+	// ConfigDiff is the textual diff of the server settings files. Empty if they are not changed.
+	ConfigDiff string `json:"config_diff"`
+}
+
+// Diff prints the changes between two backups, or between a backup and the workspace.
+func (h *backupHandler) Diff(ctx context.Context, provider Provider, args []string) error {
+	d, err := h.diff(ctx, provider, args)
+	if err != nil {
+		return err
+	}
+
+	to := d.To
+	if to == "" {
+		to = "workspace"
+	}
+	if len(d.Files) == 0 {
+		provider.Log(fmt.Sprintf("no changes between %s and %s", d.From, to))
+		return nil
+	}
+	out := []string{fmt.Sprintf("%s -> %s: %d files changed, %s", d.From, to, len(d.Files), formatSizeDelta(d.SizeDelta))}
+	for _, fc := range d.Files {
+		lines := ""
+		if !fc.Binary && fc.Added+fc.Deleted > 0 {
+			lines = fmt.Sprintf(" +%d -%d lines", fc.Added, fc.Deleted)
+		}
+		out = append(out, fmt.Sprintf("  %s %s %s -> %s (%s)%s", fc.Status, fc.Path,
+			formatBytes(fc.OldSize), formatBytes(fc.NewSize), formatSizeDelta(fc.SizeDelta()), lines))
+	}
+	if d.ConfigDiff != "" {
+		out = append(out, "server settings changes:", strings.TrimRight(d.ConfigDiff, "\r\n"))
+	}
+	provider.Printfln("%s", strings.Join(out, winutils.NewLine()))
+	return nil
+}
+
+// diff compares the backups for `backup diff FROM [TO]`.
+func (h *backupHandler) diff(ctx context.Context, provider Provider, args []string) (*BackupDiff, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, invalidArgsErrorf("invalid args. must specify one or two backups. try 'help' for usage")
+	}
+	d := &BackupDiff{}
+	for i, name := range args {
+		ref, err := findBackup(ctx, provider, name)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			d.From = ref.Ref
+		} else {
+			d.To = ref.Ref
+		}
+	}
+
+	gw := provider.GitWrapper()
+	files, err := gw.DiffFiles(ctx, d.From, d.To)
+	if err != nil {
+		return nil, err
+	}
+	d.Files = files
+	var changedConfig []string
+	for _, fc := range files {
+		d.SizeDelta += fc.SizeDelta()
+		for _, f := range serverConfigFiles {
+			if fc.Path == f {
+				changedConfig = append(changedConfig, f)
+			}
+		}
+	}
+	if len(changedConfig) > 0 {
+		if d.ConfigDiff, err = gw.DiffText(ctx, d.From, d.To, changedConfig); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// findBackup returns the backup with the exact name. Wildcards are not supported.
+func findBackup(ctx context.Context, provider Provider, name string) (*GitReference, error) {
+	branches, err := provider.GitWrapper().ListBranches(ctx, provider, []string{name})
+	if err != nil {
+		return nil, err
+	}
+	for i := range branches {
+		if branches[i].Ref == name {
+			return &branches[i], nil
+		}
+	}
+	return nil, notFoundErrorf("backup %s not found", name)
+}
+
+// formatSizeDelta formats the change in size with the sign.
+func formatSizeDelta(n int64) string {
+	if n < 0 {
+		return "-" + formatBytes(-n)
+	}
+	return "+" + formatBytes(n)
+}
@@ -0,0 +1,115 @@
+package svrmgr
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Export formats by file extension.
+const (
+	// exportFormatWorld is the Bedrock world archive, with the world folder contents at the root.
+	// It can be imported by double clicking the file.
+	exportFormatWorld = ".mcworld"
+	// exportFormatZip is the zip archive of the world folder and the server settings files.
+	exportFormatZip = ".zip"
+)
+
+// Export writes the world in the backup to a .mcworld or .zip file.
+// The backup is read from git, so it can be exported while the server is running.
+func (h *backupHandler) Export(ctx context.Context, provider Provider, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return invalidArgsErrorf("invalid args. must specify the backup name. try 'help' for usage")
+	}
+	ref, err := findBackup(ctx, provider, args[0])
+	if err != nil {
+		return err
+	}
+
+	output := strings.ReplaceAll(ref.Ref, "/", "_") + exportFormatWorld
+	if len(args) == 2 {
+		output = args[1]
+	}
+	format := strings.ToLower(filepath.Ext(output))
+	if format != exportFormatWorld && format != exportFormatZip {
+		return invalidArgsErrorf("invalid export file '%s'. must end with %s or %s", output, exportFormatWorld, exportFormatZip)
+	}
+	// git runs in the workspace, so the path must not be relative.
+	if output, err = filepath.Abs(output); err != nil {
+		return err
+	}
+	if _, err := os.Stat(output); err == nil {
+		return conflictErrorf("%s already exists", output)
+	}
+
+	worldPath, err := h.backupWorldPath(ctx, provider, ref.Ref)
+	if err != nil {
+		return err
+	}
+	gw := provider.GitWrapper()
+	if format == exportFormatWorld {
+		err = gw.Archive(ctx, ref.Ref+":"+worldPath, nil, output)
+	} else {
+		paths := []string{worldPath}
+		for _, f := range serverConfigFiles {
+			if _, err := gw.RunGitCommand(ctx, "cat-file", "-e", ref.Ref+":"+f); err == nil {
+				paths = append(paths, f)
+			}
+		}
+		err = gw.Archive(ctx, ref.Ref, paths, output)
+	}
+	if err != nil {
+		return err
+	}
+
+	size := int64(0)
+	if fi, err := os.Stat(output); err == nil {
+		size = fi.Size()
+	}
+	provider.Log(fmt.Sprintf("backup %s exported to %s (%s)", ref.Ref, output, formatBytes(size)))
+	return nil
+}
+
+// backupWorldPath returns the path of the world folder in the backup, relative to the workspace root.
+// The world is the level-name in the server.properties of the backup. If the backup has no
+// server.properties, the only world in the backup is used.
+func (h *backupHandler) backupWorldPath(ctx context.Context, provider Provider, ref string) (string, error) {
+	gw := provider.GitWrapper()
+	root, err := gw.RunGitCommand(ctx, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	worldsDir := h.worldsDir
+	if dir, err := filepath.EvalSymlinks(worldsDir); err == nil {
+		worldsDir = dir
+	}
+	rel, err := filepath.Rel(filepath.FromSlash(strings.TrimSpace(root)), worldsDir)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("worlds directory %s is not inside the git workspace %s", h.worldsDir, strings.TrimSpace(root))
+	}
+	worldsPath := filepath.ToSlash(rel)
+
+	if props, err := gw.RunGitCommand(ctx, "show", ref+":server.properties"); err == nil {
+		if name := parseLevelName(props); name != "" {
+			return path.Join(worldsPath, name), nil
+		}
+	}
+
+	out, err := gw.RunGitCommand(ctx, "ls-tree", "-d", "--name-only", ref+":"+worldsPath)
+	if err != nil {
+		return "", fmt.Errorf("no worlds in backup %s", ref)
+	}
+	var worlds []string
+	for _, l := range strings.Split(out, "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			worlds = append(worlds, l)
+		}
+	}
+	if len(worlds) != 1 {
+		return "", fmt.Errorf("unable to determine the world in backup %s. found %d worlds", ref, len(worlds))
+	}
+	return path.Join(worldsPath, worlds[0]), nil
+}
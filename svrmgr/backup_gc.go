@@ -0,0 +1,140 @@
+package svrmgr
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+)
+
+var backupGCSchedule = flag.String("backup_gc_schedule", "", "cron expression for the scheduled git maintenance (reflog expiry, gc and fsck). for example '0 5 * * 0'. empty to disable")
+
+// GCResult is the result of the git maintenance.
+type GCResult struct {
+	Before    GitObjectStats `json:"before"`
+	After     GitObjectStats `json:"after"`
+	Reclaimed int64          `json:"reclaimed"` // Bytes freed by the garbage collection.
+	DryRun    bool           `json:"dry_run"`   // True if git_dry_run is set. Nothing was deleted.
+}
+
+func (r GCResult) String() string {
+	if r.DryRun {
+		return fmt.Sprintf("git maintenance dry run complete. repository size %s", formatBytes(r.Before.TotalSize()))
+	}
+	return fmt.Sprintf("git maintenance complete. reclaimed %s (%s -> %s)",
+		formatBytes(r.Reclaimed), formatBytes(r.Before.TotalSize()), formatBytes(r.After.TotalSize()))
+}
+
+// GC runs the git maintenance to free the space used by the deleted backups.
+func (h *backupHandler) GC(ctx context.Context, provider Provider, args []string) error {
+	if len(args) > 0 {
+		return invalidArgsErrorf("invalid args. try 'help' for usage")
+	}
+	r, err := h.collectGarbage(ctx, provider)
+	if err != nil {
+		return err
+	}
+	provider.Log(r.String())
+	return nil
+}
+
+// collectGarbage runs the git maintenance. Fails if a backup is in progress.
+func (h *backupHandler) collectGarbage(ctx context.Context, provider Provider) (*GCResult, error) {
+	h.activityLock.Lock()
+	saving := h.saving
+	h.activityLock.Unlock()
+	if saving {
+		return nil, conflictErrorf("backup in progress. try again later")
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.collectGarbageLocked(ctx, provider)
+}
+
+// collectGarbageLocked expires the reflog, runs git gc and verifies the repository.
+// Must be called with the lock held.
+func (h *backupHandler) collectGarbageLocked(ctx context.Context, provider Provider) (*GCResult, error) {
+	gw := provider.GitWrapper()
+	before, err := gw.CountObjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	provider.Log("running git maintenance")
+	if err := gw.CollectGarbage(ctx, provider); err != nil {
+		return nil, err
+	}
+	if err := gw.Fsck(ctx); err != nil {
+		return nil, err
+	}
+
+	after, err := gw.CountObjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &GCResult{
+		Before:    before,
+		After:     after,
+		Reclaimed: before.TotalSize() - after.TotalSize(),
+		DryRun:    *gitDryRun,
+	}, nil
+}
+
+// applyGCSchedule replaces the git maintenance schedule with the cron expression.
+// Empty expression disables the scheduled maintenance.
+func (h *backupHandler) applyGCSchedule(provider Provider, expr string) {
+	var cron *cronSchedule
+	if expr != "" {
+		var err error
+		if cron, err = parseCron(expr); err != nil {
+			provider.Log(fmt.Sprintf("unable to apply backup_gc_schedule. %v", err))
+		}
+	}
+
+	h.lock.Lock()
+	h.gcCron = cron
+	h.gcNext = time.Time{}
+	if cron != nil {
+		h.gcNext = cron.Next(h.nowFn())
+		provider.Log(fmt.Sprintf("git maintenance scheduled (%s)", cron))
+	}
+	h.lock.Unlock()
+
+	select {
+	case h.schedulesChanged <- struct{}{}:
+	default:
+	}
+}
+
+// runDueGCLocked runs the scheduled git maintenance if it is due.
+// Must be called with the lock held.
+func (h *backupHandler) runDueGCLocked(ctx context.Context, provider Provider, now time.Time) {
+	if h.gcNext.IsZero() || h.gcNext.After(now) {
+		return
+	}
+	h.gcNext = h.gcCron.Next(now)
+
+	r, err := h.collectGarbageLocked(ctx, provider)
+	if err != nil {
+		provider.Log(fmt.Sprintf("scheduled git maintenance failed. %v", err))
+		return
+	}
+	provider.Log(r.String())
+}
+
+// formatBytes formats the size in bytes using binary units.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit && n > -unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	v := float64(n)
+	for _, suffix := range []string{"KiB", "MiB", "GiB"} {
+		v /= unit
+		if v < unit && v > -unit {
+			return fmt.Sprintf("%.1f %s", v, suffix)
+		}
+	}
+	return fmt.Sprintf("%.1f TiB", v/unit)
+}
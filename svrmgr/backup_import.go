@@ -0,0 +1,246 @@
+package svrmgr
+
+import (
+	"archive/zip"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var importMaxSize = flag.Int64("backup_import_max_size", 8*1024*1024*1024, "maximum total size in bytes of the world extracted by backup import")
+
+// Import loads the world in the .mcworld or .zip file and saves it as a new backup.
+// The world replaces the world LEVEL_NAME, which defaults to the level-name in server.properties.
+// server.properties is updated to load the imported world.
+func (h *backupHandler) Import(ctx context.Context, provider Provider, args []string) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	levelName, args, err := parseLevelNameFlag(args)
+	if err != nil {
+		return err
+	}
+	if len(args) < 2 {
+		return invalidArgsErrorf("invalid args. must specify the file and the backup description. try 'help' for usage")
+	}
+	file, desc := args[0], strings.Join(args[1:], " ")
+
+	if provider.GetServerProcess().IsRunning() {
+		return conflictErrorf("stop the server before importing the world")
+	}
+	isClean, err := provider.GitWrapper().IsDirClean(ctx)
+	if err != nil {
+		return err
+	}
+	if !isClean {
+		return conflictErrorf("there are changes since last backup. run 'backup save' or 'backup clean' to clean up")
+	}
+
+	r, err := zip.OpenReader(file)
+	if err != nil {
+		return invalidArgsErrorf("unable to open %s. %v", file, err)
+	}
+	defer r.Close()
+	root, err := findWorldRoot(r.File)
+	if err != nil {
+		return invalidArgsErrorf("invalid world archive %s. %v", file, err)
+	}
+	// Checked before the world is replaced. The actual size is checked again while extracting.
+	if size := worldSize(r.File, root); size > *importMaxSize {
+		return invalidArgsErrorf("world in %s is %s, larger than the limit of %s. see -backup_import_max_size", file, formatBytes(size), formatBytes(*importMaxSize))
+	}
+
+	propsPath := filepath.Join(filepath.Dir(h.worldsDir), "server.properties")
+	props, err := os.ReadFile(propsPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	current := parseLevelName(string(props))
+	if levelName == "" {
+		levelName = current
+	}
+	if levelName == "" {
+		return invalidArgsErrorf("level-name not found in %s. specify --level-name", propsPath)
+	}
+
+	if err := extractWorld(r.File, root, filepath.Join(h.worldsDir, levelName), *importMaxSize); err != nil {
+		return fmt.Errorf("import failed. run 'backup clean' to undo the changes. %v", err)
+	}
+	if levelName != current {
+		if err := os.WriteFile(propsPath, []byte(setLevelName(string(props), levelName)), 0644); err != nil {
+			return fmt.Errorf("import failed. run 'backup clean' to undo the changes. %v", err)
+		}
+		provider.Log(fmt.Sprintf("level-name set to %s", levelName))
+	}
+	provider.Log(fmt.Sprintf("world imported to %s", filepath.Join(h.worldsDir, levelName)))
+	return h.save(ctx, provider, backupTypeImported, desc)
+}
+
+// parseLevelNameFlag removes --level-name NAME from the args.
+func parseLevelNameFlag(args []string) (string, []string, error) {
+	var rest []string
+	name := ""
+	for i := 0; i < len(args); i++ {
+		if args[i] != "--level-name" {
+			rest = append(rest, args[i])
+			continue
+		}
+		if i+1 == len(args) {
+			return "", nil, invalidArgsErrorf("invalid args. --level-name must be followed by the name. try 'help' for usage")
+		}
+		i++
+		name = args[i]
+		if name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+			return "", nil, invalidArgsErrorf("invalid level name '%s'", name)
+		}
+	}
+	return name, rest, nil
+}
+
+// findWorldRoot returns the folder in the archive that contains level.dat and db/.
+// .mcworld files have the world at the root. Exported .zip files have it in worlds/LEVEL_NAME.
+func findWorldRoot(files []*zip.File) (string, error) {
+	var roots []string
+	hasDB := map[string]bool{}
+	for _, f := range files {
+		name := path.Clean(strings.ReplaceAll(f.Name, `\`, "/"))
+		if name == ".." || strings.HasPrefix(name, "../") || path.IsAbs(name) || (len(name) > 1 && name[1] == ':') {
+			return "", fmt.Errorf("unsafe path %s", f.Name)
+		}
+		dir, base := path.Split(name)
+		if base == "level.dat" {
+			roots = append(roots, dir)
+		}
+		if i := strings.Index(name, "db/"); i >= 0 && (i == 0 || name[i-1] == '/') {
+			hasDB[name[:i]] = true
+		}
+	}
+	if len(roots) == 0 {
+		return "", fmt.Errorf("level.dat not found")
+	}
+	// Prefer the top most world.
+	sort.Slice(roots, func(i, j int) bool {
+		return len(roots[i]) < len(roots[j])
+	})
+	if !hasDB[roots[0]] {
+		return "", fmt.Errorf("db folder not found next to %slevel.dat", roots[0])
+	}
+	return roots[0], nil
+}
+
+// worldSize returns the uncompressed size of the files under root in the archive, as recorded in the archive.
+func worldSize(files []*zip.File, root string) int64 {
+	size := int64(0)
+	for _, f := range files {
+		name := path.Clean(strings.ReplaceAll(f.Name, `\`, "/"))
+		if strings.HasPrefix(name, root) && !f.FileInfo().IsDir() {
+			size += int64(f.UncompressedSize64)
+		}
+	}
+	return size
+}
+
+// extractWorld replaces the contents of dir with the files under root in the archive.
+// Fails once more than maxSize bytes are extracted, since the recorded sizes cannot be trusted.
+// The files are extracted into a temporary directory next to dir, which replaces dir
+// only once all the files are extracted, so a failure leaves the world unchanged.
+func extractWorld(files []*zip.File, root, dir string, maxSize int64) error {
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(dir), filepath.Base(dir)+".import-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	for _, f := range files {
+		name := path.Clean(strings.ReplaceAll(f.Name, `\`, "/"))
+		if !strings.HasPrefix(name, root) || f.FileInfo().IsDir() {
+			continue
+		}
+		n, err := extractFile(f, filepath.Join(tmp, filepath.FromSlash(strings.TrimPrefix(name, root))), maxSize)
+		if err != nil {
+			return err
+		}
+		maxSize -= n
+	}
+	return replaceDir(tmp, dir)
+}
+
+// replaceDir replaces dir with src. dir is moved aside first, since a directory
+// cannot be renamed over another one on Windows. dir is put back if src cannot be moved.
+func replaceDir(src, dir string) error {
+	old := dir + ".old"
+	if err := os.RemoveAll(old); err != nil {
+		return err
+	}
+	if err := os.Rename(dir, old); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Rename(src, dir); err != nil {
+		os.Rename(old, dir)
+		return err
+	}
+	return os.RemoveAll(old)
+}
+
+// extractFile writes the archived file to the path. Fails if the file is larger than maxSize.
+// Returns the number of bytes written.
+func extractFile(f *zip.File, dst string, maxSize int64) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return 0, err
+	}
+	src, err := f.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(out, io.LimitReader(src, maxSize+1))
+	if err == nil && n > maxSize {
+		err = fmt.Errorf("world exceeds the size limit. see -backup_import_max_size")
+	}
+	if err != nil {
+		out.Close()
+		return n, err
+	}
+	return n, out.Close()
+}
+
+// parseLevelName returns the level-name in the server.properties contents. Empty if not set.
+func parseLevelName(props string) string {
+	for _, l := range strings.Split(props, "\n") {
+		if kv := strings.SplitN(strings.TrimSpace(l), "=", 2); len(kv) == 2 && kv[0] == "level-name" {
+			return strings.TrimSpace(kv[1])
+		}
+	}
+	return ""
+}
+
+// setLevelName returns the server.properties contents with the level-name replaced.
+func setLevelName(props, name string) string {
+	lines := strings.Split(props, "\n")
+	for i, l := range lines {
+		if strings.HasPrefix(strings.TrimSpace(l), "level-name=") {
+			lines[i] = "level-name=" + name
+			if strings.HasSuffix(l, "\r") {
+				lines[i] += "\r"
+			}
+			return strings.Join(lines, "\n")
+		}
+	}
+	if props != "" && !strings.HasSuffix(props, "\n") {
+		props += "\n"
+	}
+	return props + "level-name=" + name + "\n"
+}
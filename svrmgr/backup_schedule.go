@@ -0,0 +1,206 @@
+package svrmgr
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/fieryorc/BedrockServerManager/winutils"
+)
+
+// maxScheduleWait is the longest the schedule loop sleeps before checking
+// the schedules again. Keeps the schedules accurate across clock changes.
+const maxScheduleWait = time.Minute
+
+// backupTypePattern matches the valid backup type labels.
+// The label is part of the backup branch name.
+var backupTypePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// BackupSchedule is a cron style backup schedule.
+type BackupSchedule struct {
+	Cron        string     `json:"cron"`
+	Type        backupType `json:"type"`
+	Description string     `json:"description"`
+	Next        time.Time  `json:"next"`     // Next run. Zero if the schedule never matches.
+	LastRun     *time.Time `json:"last_run"` // nil if not run since start.
+	cron        *cronSchedule
+}
+
+// newBackupSchedule validates the schedule config and fills in the defaults.
+func newBackupSchedule(sc backupScheduleConfig) (*BackupSchedule, error) {
+	cron, err := parseCron(sc.Cron)
+	if err != nil {
+		return nil, err
+	}
+	bt := backupTypePeriodic
+	if sc.Type != "" {
+		if !backupTypePattern.MatchString(sc.Type) || sc.Type == string(backupTypeTemp) || sc.Type == string(backupTypeImported) {
+			return nil, fmt.Errorf("invalid backup type '%s' for schedule '%s'", sc.Type, sc.Cron)
+		}
+		bt = backupType(sc.Type)
+	}
+	desc := sc.Description
+	if desc == "" {
+		desc = fmt.Sprintf("Scheduled backup (%s)", cron)
+	}
+	return &BackupSchedule{
+		Cron:        cron.String(),
+		Type:        bt,
+		Description: desc,
+		cron:        cron,
+	}, nil
+}
+
+func (s BackupSchedule) String() string {
+	next := "never"
+	if !s.Next.IsZero() {
+		next = s.Next.Local().Format("20060102-15:04")
+	}
+	return fmt.Sprintf("%s saves/%s '%s', next run at %s", s.Cron, s.Type, s.Description, next)
+}
+
+// Schedule handles the backup schedule sub commands.
+func (h *backupHandler) Schedule(ctx context.Context, provider Provider, args []string) error {
+	schedules, err := h.scheduleList(ctx, provider, args)
+	if err != nil {
+		return err
+	}
+	if len(schedules) == 0 {
+		provider.Log("no backup schedules. add backup_schedules to the config file")
+		return nil
+	}
+	var out []string
+	for i, s := range schedules {
+		out = append(out, fmt.Sprintf("%d. %v", i+1, s))
+	}
+	provider.Printfln("%s", strings.Join(out, winutils.NewLine()))
+	return nil
+}
+
+// scheduleList returns the backup schedules for `backup schedule list`.
+func (h *backupHandler) scheduleList(ctx context.Context, provider Provider, args []string) ([]BackupSchedule, error) {
+	if len(args) > 0 && args[0] != "list" {
+		return nil, invalidArgsErrorf("unknown command. try help")
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	schedules := []BackupSchedule{}
+	for _, s := range h.schedules {
+		schedules = append(schedules, *s)
+	}
+	return schedules, nil
+}
+
+// applySchedules replaces the backup schedules with the ones in the config.
+func (h *backupHandler) applySchedules(provider Provider) {
+	var schedules []*BackupSchedule
+	for _, sc := range h.cfg.BackupSchedules() {
+		s, err := newBackupSchedule(sc)
+		if err != nil {
+			provider.Log(fmt.Sprintf("ignoring backup schedule. %v", err))
+			continue
+		}
+		schedules = append(schedules, s)
+	}
+
+	h.lock.Lock()
+	now := h.nowFn()
+	for _, s := range schedules {
+		s.Next = s.cron.Next(now)
+	}
+	h.schedules = schedules
+	h.lock.Unlock()
+
+	if len(schedules) > 0 {
+		provider.Log(fmt.Sprintf("%d backup schedules loaded", len(schedules)))
+	}
+	select {
+	case h.schedulesChanged <- struct{}{}:
+	default:
+	}
+}
+
+// nextScheduledLocked returns the earliest next run of the schedules and the
+// git maintenance. Zero if none.
+// Must be called with the lock held.
+func (h *backupHandler) nextScheduledLocked() time.Time {
+	next := h.gcNext
+	for _, s := range h.schedules {
+		if !s.Next.IsZero() && (next.IsZero() || s.Next.Before(next)) {
+			next = s.Next
+		}
+	}
+	return next
+}
+
+// runDueSchedules takes the backups for the schedules that are due and runs
+// the git maintenance if it is due.
+// A schedule that missed several runs, for example during a long backup, runs once.
+// Schedules of the same backup type that are due together take a single backup,
+// as their backups would get the same branch name.
+func (h *backupHandler) runDueSchedules(ctx context.Context, provider Provider) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	now := h.nowFn()
+	var types []backupType
+	descriptions := map[backupType][]string{}
+	for _, s := range h.schedules {
+		if s.Next.IsZero() || s.Next.After(now) {
+			continue
+		}
+		lastRun := now
+		s.LastRun = &lastRun
+		s.Next = s.cron.Next(now)
+
+		if _, ok := descriptions[s.Type]; !ok {
+			types = append(types, s.Type)
+		}
+		descriptions[s.Type] = append(descriptions[s.Type], s.Description)
+	}
+
+	for _, bt := range types {
+		desc := strings.Join(descriptions[bt], "; ")
+		if h.onlyWhenActive {
+			reason, ok := h.playersActive(provider)
+			if !ok {
+				provider.Log(fmt.Sprintf("skipping scheduled backup '%s'. %s", desc, reason))
+				continue
+			}
+		}
+		provider.Log(fmt.Sprintf("taking scheduled backup '%s'", desc))
+		if err := h.autoBackup(ctx, provider, bt, desc); err != nil {
+			provider.Log(fmt.Sprintf("scheduled backup failed. %v", err))
+		}
+	}
+	h.runDueGCLocked(ctx, provider, now)
+}
+
+// runScheduleLoop runs the due schedules until the context is cancelled.
+func (h *backupHandler) runScheduleLoop(ctx context.Context, provider Provider) {
+	for {
+		h.lock.Lock()
+		next := h.nextScheduledLocked()
+		h.lock.Unlock()
+
+		var wait <-chan time.Time
+		if !next.IsZero() {
+			d := next.Sub(h.nowFn())
+			if d > maxScheduleWait {
+				d = maxScheduleWait
+			}
+			wait = h.afterFn(d)
+		}
+
+		select {
+		case <-wait:
+			h.runDueSchedules(ctx, provider)
+		case <-h.schedulesChanged:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package svrmgr
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/fieryorc/BedrockServerManager/winutils"
+)
+
+// BackupStats is the storage usage of the backups.
+type BackupStats struct {
+	RepositorySize int64              `json:"repository_size"` // Disk space used by the git objects in bytes.
+	Objects        int64              `json:"objects"`         // Number of loose and packed git objects.
+	Backups        int                `json:"backups"`         // Number of backups.
+	ByType         map[backupType]int `json:"by_type"`         // Number of backups by backup type.
+	Oldest         *GitReference      `json:"oldest"`          // nil if there are no backups.
+	Newest         *GitReference      `json:"newest"`          // nil if there are no backups.
+	// Usage is the space used by each backup, largest first. Only set by `backup stats`.
+	Usage []BackupUsage `json:"usage,omitempty"`
+}
+
+// BackupUsage is the space used by a backup.
+type BackupUsage struct {
+	Ref string `json:"ref"`
+	// UniqueSize is the approximate disk space used only by this backup, in bytes.
+	// This is roughly the space freed by deleting the backup and running `backup gc`.
+	UniqueSize int64 `json:"unique_size"`
+}
+
+func (s *BackupStats) String() string {
+	var types []string
+	for bt := range s.ByType {
+		types = append(types, string(bt))
+	}
+	sort.Strings(types)
+	for i, bt := range types {
+		types[i] = fmt.Sprintf("%s: %d", bt, s.ByType[backupType(bt)])
+	}
+	str := fmt.Sprintf("%d backups", s.Backups)
+	if len(types) > 0 {
+		str += fmt.Sprintf(" (%s)", strings.Join(types, ", "))
+	}
+	return fmt.Sprintf("%s using %s", str, formatBytes(s.RepositorySize))
+}
+
+// Stats prints the storage usage of the backups.
+func (h *backupHandler) Stats(ctx context.Context, provider Provider, args []string) error {
+	if len(args) > 0 {
+		return invalidArgsErrorf("invalid args. try 'help' for usage")
+	}
+	s, err := h.stats(ctx, provider, true)
+	if err != nil {
+		return err
+	}
+
+	out := []string{
+		fmt.Sprintf("repository size: %s, %d objects", formatBytes(s.RepositorySize), s.Objects),
+		s.String(),
+	}
+	if s.Oldest != nil {
+		out = append(out,
+			fmt.Sprintf("oldest: %s (%s)", s.Oldest.Ref, s.Oldest.CommitDateRelative),
+			fmt.Sprintf("newest: %s (%s)", s.Newest.Ref, s.Newest.CommitDateRelative))
+	}
+	if len(s.Usage) > 0 {
+		out = append(out, "space used only by each backup:")
+		for _, u := range s.Usage {
+			out = append(out, fmt.Sprintf("  %10s %s", formatBytes(u.UniqueSize), u.Ref))
+		}
+	}
+	provider.Printfln("%s", strings.Join(out, winutils.NewLine()))
+	return nil
+}
+
+// stats returns the storage usage of the backups. The usage of each backup
+// is computed only if withUsage is set, as it reads all the backups.
+// Does not need the lock, as it only reads the repository.
+func (h *backupHandler) stats(ctx context.Context, provider Provider, withUsage bool) (*BackupStats, error) {
+	gw := provider.GitWrapper()
+	objects, err := gw.CountObjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	branches, err := gw.ListBranches(ctx, provider, []string{"saves/*"})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &BackupStats{
+		RepositorySize: objects.TotalSize(),
+		Objects:        objects.Count + objects.InPack,
+		ByType:         map[backupType]int{},
+	}
+	for i, b := range branches {
+		bt := backupTypeOf(b.Ref)
+		if bt == "" {
+			continue
+		}
+		s.Backups++
+		s.ByType[bt]++
+		if s.Oldest == nil || b.CommitDate.Before(s.Oldest.CommitDate) {
+			s.Oldest = &branches[i]
+		}
+		if s.Newest == nil || b.CommitDate.After(s.Newest.CommitDate) {
+			s.Newest = &branches[i]
+		}
+	}
+	if !withUsage || s.Backups == 0 {
+		return s, nil
+	}
+
+	sizes, err := gw.UniqueSizes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range branches {
+		if backupTypeOf(b.Ref) != "" {
+			s.Usage = append(s.Usage, BackupUsage{Ref: b.Ref, UniqueSize: sizes[b.Ref]})
+		}
+	}
+	sort.SliceStable(s.Usage, func(i, j int) bool {
+		return s.Usage[i].UniqueSize > s.Usage[j].UniqueSize
+	})
+	return s, nil
+}
@@ -0,0 +1,328 @@
+package svrmgr
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fieryorc/BedrockServerManager/winutils"
+)
+
+var backupRemotes = flag.String("backup_remotes", "", "comma separated git remotes (URLs or paths of bare repositories) the backups are pushed to after each backup. empty to disable")
+
+// Prefixes of the refs replicated to the remotes.
+const (
+	// backupRefPrefix is the prefix of the backup branches.
+	backupRefPrefix = "refs/heads/saves/"
+	// pinRefPrefix is the prefix of the tags pinning the backups, so the remote copies keep the protection.
+	pinRefPrefix = "refs/tags/" + pinTagPrefix
+)
+
+// deletedRefsFile is the file in the git directory that keeps the deletions not
+// synced yet, so they are still synced after the manager restarts. One ref per line.
+const deletedRefsFile = "bedrock_manager_deleted_refs"
+
+// RemoteSyncStatus is the replication status of a backup remote.
+type RemoteSyncStatus struct {
+	Remote    string     `json:"remote"`
+	LastSync  *time.Time `json:"last_sync"`  // Last successful sync. nil if not synced since start.
+	LastError string     `json:"last_error"` // Error of the last sync. Empty if it succeeded.
+	ToPush    []string   `json:"to_push"`    // Backups and pins missing or outdated on the remote.
+	ToDelete  []string   `json:"to_delete"`  // Backups and pins deleted by the manager that are still on the remote.
+	// RemoteOnly are the backups and pins on the remote that the manager did not delete, such as the
+	// backups of another server or the ones lost with the local repository. They are never deleted.
+	RemoteOnly []string `json:"remote_only"`
+}
+
+func (s RemoteSyncStatus) String() string {
+	last := "never synced"
+	if s.LastSync != nil {
+		last = fmt.Sprintf("last synced at %s", s.LastSync.Local().Format("20060102-15:04:05"))
+	}
+	str := fmt.Sprintf("%s: %s, %d backups to push, %d to delete, %d only on the remote", s.Remote, last, len(s.ToPush), len(s.ToDelete), len(s.RemoteOnly))
+	if s.LastError != "" {
+		str += fmt.Sprintf(". last error: %s", s.LastError)
+	}
+	return str
+}
+
+// remoteSyncState is the result of the last sync with a remote.
+type remoteSyncState struct {
+	lastSync  time.Time
+	lastError string
+}
+
+// Sync handles `backup sync [status]`.
+// Without status, the backups are pushed to the remotes and the backups deleted by the manager are deleted.
+func (h *backupHandler) Sync(ctx context.Context, provider Provider, args []string) error {
+	statuses, err := h.sync(ctx, provider, args)
+	if err != nil {
+		return err
+	}
+	if len(statuses) == 0 {
+		provider.Log("no backup remotes. set backup_remotes to replicate the backups")
+		return nil
+	}
+	var out []string
+	for _, s := range statuses {
+		out = append(out, s.String())
+	}
+	provider.Printfln("%s", strings.Join(out, winutils.NewLine()))
+	return nil
+}
+
+// sync returns the status of the remotes for `backup sync status`, or syncs them for `backup sync`.
+func (h *backupHandler) sync(ctx context.Context, provider Provider, args []string) ([]RemoteSyncStatus, error) {
+	statusOnly := false
+	if len(args) == 1 && args[0] == "status" {
+		statusOnly = true
+	} else if len(args) > 0 {
+		return nil, invalidArgsErrorf("invalid args. try 'help' for usage")
+	}
+	return h.syncRemotes(ctx, provider, statusOnly), nil
+}
+
+// syncRemotes compares the backups with each remote and, unless statusOnly is set,
+// pushes the missing backups and deletes the ones deleted by the manager.
+// Syncs are serialized, but do not block the backups.
+func (h *backupHandler) syncRemotes(ctx context.Context, provider Provider, statusOnly bool) []RemoteSyncStatus {
+	h.syncLock.Lock()
+	defer h.syncLock.Unlock()
+
+	h.deletedLock.Lock()
+	if err := h.loadDeletedLocked(ctx, provider); err != nil {
+		provider.Log(fmt.Sprintf("unable to read the deleted backups. %v", err))
+	}
+	deleted := map[string]bool{}
+	for ref := range h.deleted {
+		deleted[ref] = true
+	}
+	if len(h.remotes) == 0 && len(h.deleted) > 0 {
+		// Nothing to propagate the deletions to.
+		h.deleted = map[string]bool{}
+		h.saveDeletedLocked(provider)
+	}
+	h.deletedLock.Unlock()
+
+	statuses := []RemoteSyncStatus{}
+	if len(h.remotes) == 0 {
+		return statuses
+	}
+	local, localErr := provider.GitWrapper().ListRefs(ctx, "", backupRefPrefix, pinRefPrefix)
+	synced := localErr == nil
+	for _, remote := range h.remotes {
+		state := h.syncState[remote]
+		if state == nil {
+			state = &remoteSyncState{}
+			h.syncState[remote] = state
+		}
+		s := RemoteSyncStatus{Remote: remote, ToPush: []string{}, ToDelete: []string{}, RemoteOnly: []string{}}
+		err := localErr
+		if err == nil {
+			err = h.syncRemote(ctx, provider, local, deleted, &s, statusOnly)
+		}
+		if err != nil {
+			synced = false
+		}
+		if !statusOnly {
+			state.lastError = ""
+			if err != nil {
+				state.lastError = err.Error()
+			} else {
+				state.lastSync = h.nowFn()
+			}
+		}
+		if !state.lastSync.IsZero() {
+			lastSync := state.lastSync
+			s.LastSync = &lastSync
+		}
+		s.LastError = state.lastError
+		if statusOnly && err != nil {
+			s.LastError = err.Error()
+		}
+		statuses = append(statuses, s)
+	}
+
+	// The deletions are kept until all the remotes are synced.
+	if !statusOnly && synced {
+		h.deletedLock.Lock()
+		for ref := range deleted {
+			delete(h.deleted, ref)
+		}
+		if len(deleted) > 0 {
+			h.saveDeletedLocked(provider)
+		}
+		h.deletedLock.Unlock()
+	}
+	return statuses
+}
+
+// syncRemote fills in the unsynced backups of the remote and pushes them unless statusOnly is set.
+// Only the refs in deleted are deleted from the remote. Other refs missing locally are left alone,
+// so that a new local repository or another server sharing the remote never deletes the remote backups.
+func (h *backupHandler) syncRemote(ctx context.Context, provider Provider, local map[string]string, deleted map[string]bool, s *RemoteSyncStatus, statusOnly bool) error {
+	remote, err := provider.GitWrapper().ListRefs(ctx, s.Remote, backupRefPrefix, pinRefPrefix)
+	if err != nil {
+		return err
+	}
+	var refspecs []string
+	for ref, hash := range local {
+		if remote[ref] != hash {
+			s.ToPush = append(s.ToPush, shortRefName(ref))
+			// Never forced. Backups do not change, so a different commit on the remote
+			// is another server's backup and is reported instead of overwritten.
+			refspecs = append(refspecs, ref+":"+ref)
+		}
+	}
+	for ref := range remote {
+		if _, ok := local[ref]; ok {
+			continue
+		}
+		if deleted[ref] {
+			s.ToDelete = append(s.ToDelete, shortRefName(ref))
+			refspecs = append(refspecs, ":"+ref)
+		} else {
+			s.RemoteOnly = append(s.RemoteOnly, shortRefName(ref))
+		}
+	}
+	sort.Strings(s.ToPush)
+	sort.Strings(s.ToDelete)
+	sort.Strings(s.RemoteOnly)
+	if statusOnly || len(refspecs) == 0 {
+		return nil
+	}
+
+	sort.Strings(refspecs)
+	if err := provider.GitWrapper().PushRefs(ctx, provider, s.Remote, refspecs); err != nil {
+		return err
+	}
+	provider.Log(fmt.Sprintf("synced backups to %s. %d pushed, %d deleted", s.Remote, len(s.ToPush), len(s.ToDelete)))
+	s.ToPush, s.ToDelete = []string{}, []string{}
+	return nil
+}
+
+// shortRefName returns the branch or tag name of the full ref name.
+func shortRefName(ref string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(ref, "refs/heads/"), "refs/tags/")
+}
+
+// recordDeleted records the backups deleted by the manager, along with their pins,
+// so that the next sync deletes them from the remotes.
+func (h *backupHandler) recordDeleted(ctx context.Context, provider Provider, backups []GitReference) {
+	var refs []string
+	for _, b := range backups {
+		name := strings.TrimPrefix(b.Ref, "refs/heads/")
+		refs = append(refs, "refs/heads/"+name)
+		if b.Pinned {
+			refs = append(refs, pinRefPrefix+name)
+		}
+	}
+	h.recordDeletedRefs(ctx, provider, refs...)
+}
+
+// recordDeletedRefs records the full ref names deleted by the manager.
+// The deletions are persisted in the git directory until they are synced.
+func (h *backupHandler) recordDeletedRefs(ctx context.Context, provider Provider, refs ...string) {
+	if len(refs) == 0 {
+		return
+	}
+	h.deletedLock.Lock()
+	defer h.deletedLock.Unlock()
+	if err := h.loadDeletedLocked(ctx, provider); err != nil {
+		provider.Log(fmt.Sprintf("unable to read the deleted backups. %v", err))
+	}
+	for _, ref := range refs {
+		h.deleted[ref] = true
+	}
+	h.saveDeletedLocked(provider)
+}
+
+// loadDeletedLocked adds the deletions persisted by the previous runs. Reads the file only once.
+// Must be called with deletedLock held.
+func (h *backupHandler) loadDeletedLocked(ctx context.Context, provider Provider) error {
+	if h.deletedFile != "" {
+		return nil
+	}
+	path, err := provider.GitWrapper().GitPath(ctx, deletedRefsFile)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, l := range strings.Split(string(content), "\n") {
+		if ref := strings.TrimSpace(l); ref != "" {
+			h.deleted[ref] = true
+		}
+	}
+	h.deletedFile = path
+	return nil
+}
+
+// saveDeletedLocked persists the deletions not synced yet. The file is removed once all are synced.
+// Nothing is saved if the file could not be read.
+// Must be called with deletedLock held.
+func (h *backupHandler) saveDeletedLocked(provider Provider) {
+	if h.deletedFile == "" {
+		return
+	}
+	var err error
+	if len(h.deleted) == 0 {
+		if err = os.Remove(h.deletedFile); os.IsNotExist(err) {
+			err = nil
+		}
+	} else {
+		var refs []string
+		for ref := range h.deleted {
+			refs = append(refs, ref)
+		}
+		sort.Strings(refs)
+		err = os.WriteFile(h.deletedFile, []byte(strings.Join(refs, "\n")+"\n"), 0644)
+	}
+	if err != nil {
+		provider.Log(fmt.Sprintf("unable to save the deleted backups. %v", err))
+	}
+}
+
+// requestSync wakes up the sync loop. Does not wait for the sync.
+func (h *backupHandler) requestSync() {
+	select {
+	case h.syncRequests <- struct{}{}:
+	default:
+	}
+}
+
+// runSyncLoop syncs the remotes when requested, until the context is cancelled.
+// The backups request a sync after the save is resumed, so the pushes never delay the save hold.
+func (h *backupHandler) runSyncLoop(ctx context.Context, provider Provider) {
+	for {
+		select {
+		case <-h.syncRequests:
+			for _, s := range h.syncRemotes(ctx, provider, false) {
+				if s.LastError != "" {
+					provider.Log(fmt.Sprintf("unable to sync backups to %s. %s", s.Remote, s.LastError))
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// setRemotes replaces the remotes with backup_remotes.
+func (h *backupHandler) setRemotes(str string) {
+	var remotes []string
+	for _, r := range strings.Split(str, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			remotes = append(remotes, r)
+		}
+	}
+	h.syncLock.Lock()
+	h.remotes = remotes
+	h.syncLock.Unlock()
+}
@@ -1,8 +1,13 @@
 package svrmgr
 
 import (
+	"archive/zip"
 	"context"
+	"io"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -19,7 +24,7 @@ func TestBackup_CleanServerNotRunning(t *testing.T) {
 	defer st.close(t)
 
 	st.spMock.EXPECT().IsRunning().Return(false)
-	st.spMock.EXPECT().Kill()
+	st.spMock.EXPECT().Stop(gomock.Any(), gomock.Any())
 	st.gwMock.EXPECT().IsDirClean(gomock.Any()).Return(true, nil)
 
 	st.PushCommandAsync("backup save test backup")
@@ -41,12 +46,15 @@ func TestBackup_CleanServerRunning(t *testing.T) {
 	var ch chan string
 
 	st.spMock.EXPECT().IsRunning().Return(true)
-	st.spMock.EXPECT().Kill()
-	st.gwMock.EXPECT().IsDirClean(gomock.Any()).Return(true, nil)
+	st.spMock.EXPECT().Stop(gomock.Any(), gomock.Any())
 	st.spMock.EXPECT().StartReadOutput(gomock.Any()).DoAndReturn(func(c chan string) {
 		ch = c
 	})
-	st.spMock.EXPECT().EndReadOutput()
+	// The output is no longer read once the file list is received, so it must not block the server during the backup.
+	gomock.InOrder(
+		st.spMock.EXPECT().EndReadOutput(gomock.Any()),
+		st.gwMock.EXPECT().IsDirClean(gomock.Any()).Return(true, nil),
+	)
 	st.spMock.EXPECT().SendInput(gomock.Any()).AnyTimes().DoAndReturn(func(inp string) error {
 		if inp == "save hold" {
 			ch <- winutils.AddNewLine(backupSaveCompletedMarker)
@@ -74,20 +82,27 @@ func TestBackup_BackupSimple(t *testing.T) {
 	var ch chan string
 
 	st.spMock.EXPECT().IsRunning().Return(true)
-	st.spMock.EXPECT().Kill()
+	st.spMock.EXPECT().Stop(gomock.Any(), gomock.Any())
 	st.gwMock.EXPECT().IsDirClean(gomock.Any()).Return(false, nil)
 	st.spMock.EXPECT().StartReadOutput(gomock.Any()).DoAndReturn(func(c chan string) {
 		ch = c
 	})
-	st.spMock.EXPECT().EndReadOutput()
+	st.spMock.EXPECT().EndReadOutput(gomock.Any())
 	st.spMock.EXPECT().SendInput(gomock.Any()).AnyTimes().DoAndReturn(func(inp string) error {
 		if inp == "save hold" {
 			ch <- winutils.AddNewLine(backupSaveCompletedMarker)
-			ch <- winutils.AddNewLine("file list...")
+			ch <- winutils.AddNewLine("Bedrock level/db/000005.ldb:1234, Bedrock level/level.dat:2040")
 		}
 		return nil
 	})
 	st.gwMock.EXPECT().RunGitCommand(gomock.Any(), gomock.Any(), gomock.Any()).Return("complete", nil)
+	st.gwMock.EXPECT().StageSavedFiles(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, worldsDir string, files []savedFile) error {
+			if len(files) != 2 || files[0].Length != 1234 {
+				t.Errorf("unexpected files: %v", files)
+			}
+			return nil
+		})
 	st.gwMock.EXPECT().RunGitCommand(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("complete", nil)
 	st.gwMock.EXPECT().RunGitCommand(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("complete", nil)
 
@@ -104,12 +119,50 @@ func TestBackup_BackupSimple(t *testing.T) {
 	}
 }
 
+func TestBackup_InvalidFileList(t *testing.T) {
+	st := newBackupTest(t)
+	defer st.close(t)
+	var ch chan string
+
+	st.spMock.EXPECT().IsRunning().Return(true)
+	st.spMock.EXPECT().Stop(gomock.Any(), gomock.Any())
+	st.gwMock.EXPECT().IsDirClean(gomock.Any()).Return(false, nil)
+	st.spMock.EXPECT().StartReadOutput(gomock.Any()).DoAndReturn(func(c chan string) {
+		ch = c
+	})
+	st.spMock.EXPECT().EndReadOutput(gomock.Any())
+	st.spMock.EXPECT().SendInput(gomock.Any()).AnyTimes().DoAndReturn(func(inp string) error {
+		if inp == "save hold" {
+			ch <- winutils.AddNewLine(backupSaveCompletedMarker)
+			ch <- winutils.AddNewLine("file list...")
+		}
+		return nil
+	})
+	// All files are backed up when the list cannot be parsed.
+	st.gwMock.EXPECT().RunGitCommand(gomock.Any(), gomock.Any(), gomock.Any()).Return("complete", nil)
+	st.gwMock.EXPECT().RunGitCommand(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("complete", nil)
+	st.gwMock.EXPECT().RunGitCommand(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("complete", nil)
+
+	st.PushCommandAsync("backup save test backup")
+	st.PushCommandAsync("quit")
+
+	err := st.sm.Process(context.Background(), []string{})
+	if err != nil {
+		t.Errorf("expecting nil, got %v", err)
+	}
+	for _, exp := range []string{"unable to parse saved file list", "backup success"} {
+		if !strings.Contains(st.stdoutLog.String(), exp) {
+			t.Errorf("expected: %s", exp)
+		}
+	}
+}
+
 func TestClean_ServerRunning(t *testing.T) {
 	st := newBackupTest(t)
 	defer st.close(t)
 
 	st.spMock.EXPECT().IsRunning().Return(true)
-	st.spMock.EXPECT().Kill()
+	st.spMock.EXPECT().Stop(gomock.Any(), gomock.Any())
 
 	st.PushCommandAsync("backup clean")
 	st.PushCommandAsync("quit")
@@ -129,7 +182,7 @@ func TestClean_ServerNotRunning(t *testing.T) {
 	defer st.close(t)
 
 	st.spMock.EXPECT().IsRunning().AnyTimes().Return(false)
-	st.spMock.EXPECT().Kill()
+	st.spMock.EXPECT().Stop(gomock.Any(), gomock.Any())
 	st.gwMock.EXPECT().IsDirClean(gomock.Any()).Return(false, nil)
 	st.gwMock.EXPECT().GetCurrentHead(gomock.Any()).Return(GitReference{Ref: "refs/heads/foo"}, nil)
 	st.gwMock.EXPECT().RunGitCommand(gomock.Any(), gomock.Any(), gomock.Any()).Return("complete", nil)
@@ -159,7 +212,7 @@ func TestList_Simple(t *testing.T) {
 	st := newBackupTest(t)
 	defer st.close(t)
 
-	st.spMock.EXPECT().Kill()
+	st.spMock.EXPECT().Stop(gomock.Any(), gomock.Any())
 	branchList := []GitReference{
 		{
 			Ref:  "refs/heads/1",
@@ -203,7 +256,7 @@ func TestPrune_Simple(t *testing.T) {
 	st := newBackupTest(t)
 	defer st.close(t)
 
-	st.spMock.EXPECT().Kill()
+	st.spMock.EXPECT().Stop(gomock.Any(), gomock.Any())
 	nowTime := time.Date(2021, 1, 2, 1, 0, 0, 0, time.UTC)
 	st.nowFn = func() time.Time {
 		return nowTime
@@ -223,15 +276,15 @@ func TestPrune_Simple(t *testing.T) {
 	}
 
 	st.gwMock.EXPECT().ListBranches(gomock.Any(), gomock.Any(), gomock.Any()).Return(branchList, nil)
-	st.gwMock.EXPECT().DeleteBranches(gomock.Any(), gomock.Any(), gomock.Any()).
-		DoAndReturn(func(ctx context.Context, prov Provider, refs []GitReference) error {
+	st.gwMock.EXPECT().DeleteBranches(gomock.Any(), gomock.Any(), gomock.Any(), false).
+		DoAndReturn(func(ctx context.Context, prov Provider, refs []GitReference, force bool) ([]GitReference, error) {
 			for _, r := range refs {
 				t.Logf("deleting branch %v", r)
 			}
 			if len(refs) != 2 {
 				t.Errorf("incorrect number of branches to delete. Exp: 1, Got: %d", len(refs))
 			}
-			return nil
+			return refs, nil
 		})
 
 	st.PushCommandAsync("backup prune 12h 12h")
@@ -242,3 +295,464 @@ func TestPrune_Simple(t *testing.T) {
 		t.Errorf("expecting nil, got %v", err)
 	}
 }
+
+func TestBackup_OnlyWhenActive(t *testing.T) {
+	st := newBackupTest(t)
+	defer st.close(t)
+
+	ctx := context.Background()
+	bh := st.sm.handlers["backup"].(*backupHandler)
+	bh.onlyWhenActive = true
+
+	// First backup after start is always taken.
+	st.spMock.EXPECT().IsRunning().Return(false).Times(2)
+	st.gwMock.EXPECT().IsDirClean(gomock.Any()).Return(true, nil).Times(2)
+	if err := bh.periodicBackup(ctx, st.sm); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	if !strings.Contains(st.stdoutLog.String(), "taking periodic backup. no backup taken since start") {
+		t.Errorf("expected first backup, Got: %v", st.stdoutLog.String())
+	}
+
+	if err := bh.periodicBackup(ctx, st.sm); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	if !strings.Contains(st.stdoutLog.String(), "skipping periodic backup. no players online since the last backup") {
+		t.Errorf("expected skipped backup, Got: %v", st.stdoutLog.String())
+	}
+
+	// Player online during the backup.
+	bh.onPlayerEvent(ctx, st.sm, Event{Type: EventPlayerJoined, Time: time.Now().Add(time.Minute)})
+	st.sm.handlers["players"].(*playersHandler).online["Steve"] = Player{Name: "Steve"}
+	if err := bh.periodicBackup(ctx, st.sm); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	if !strings.Contains(st.stdoutLog.String(), "taking periodic backup. 1 players online") {
+		t.Errorf("expected backup with players online, Got: %v", st.stdoutLog.String())
+	}
+}
+
+func TestBackup_LastPlayerLeft(t *testing.T) {
+	st := newBackupTest(t)
+	defer st.close(t)
+
+	bh := st.sm.handlers["backup"].(*backupHandler)
+	bh.lock.Lock()
+	bh.onlyWhenActive = true
+	bh.lock.Unlock()
+
+	done := make(chan bool)
+	st.spMock.EXPECT().IsRunning().Return(false)
+	st.gwMock.EXPECT().IsDirClean(gomock.Any()).DoAndReturn(func(ctx context.Context) (bool, error) {
+		close(done)
+		return true, nil
+	})
+
+	now := time.Now()
+	st.sm.notifyServerOutput(playerLine(now.Add(-time.Hour), "connected", "Steve", "1"))
+	st.sm.notifyServerOutput(playerLine(now.Add(-time.Minute), "connected", "Alex", "2"))
+	st.sm.notifyServerOutput(playerLine(now.Add(-time.Second), "disconnected", "Alex", "2"))
+	st.sm.notifyServerOutput(playerLine(now, "disconnected", "Steve", "1"))
+
+	select {
+	case <-done:
+	case <-time.After(time.Second * 10):
+		t.Fatalf("timed out waiting for the backup. Got: %v", st.stdoutLog.String())
+	}
+	waitForOutput(t, &st.stdoutLog, "skipping backup. no dirty files")
+
+	// Player events do not wait for the backups. Already backed up, so no new backup is taken.
+	bh.lock.Lock()
+	returned := make(chan struct{})
+	go func() {
+		bh.onPlayerEvent(context.Background(), st.sm, Event{Type: EventPlayerLeft, Time: now})
+		close(returned)
+	}()
+	select {
+	case <-returned:
+	case <-time.After(time.Second * 10):
+		t.Fatalf("player event waited for the backup")
+	}
+	bh.lock.Unlock()
+	waitForOutput(t, &st.stdoutLog, "skipping backup. already backed up after the last player left")
+	if n := strings.Count(st.stdoutLog.String(), "taking backup. last player left"); n != 1 {
+		t.Errorf("expected 1 final backup, got %d. %v", n, st.stdoutLog.String())
+	}
+}
+
+func TestBackup_Schedules(t *testing.T) {
+	st := newBackupTest(t)
+	defer st.close(t)
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeTestConfig(t, path, `{"backup_schedules": [
+		{"cron": "0 */2 * * *"},
+		{"cron": "30 3 * * *", "type": "nightly", "description": "Nightly backup"}
+	]}`)
+	st.sm.config.path = path
+	if err := st.sm.config.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2021, 1, 2, 1, 0, 0, 0, time.Local)
+	var lock sync.Mutex
+	st.nowFn = func() time.Time {
+		lock.Lock()
+		defer lock.Unlock()
+		return now
+	}
+	setNow := func(t time.Time) {
+		lock.Lock()
+		defer lock.Unlock()
+		now = t
+	}
+	bh := st.sm.handlers["backup"].(*backupHandler)
+	bh.afterFn = func(d time.Duration) <-chan time.Time {
+		return nil
+	}
+	bh.applySchedules(st.sm)
+
+	ctx := context.Background()
+	schedules, err := bh.scheduleList(ctx, st.sm, []string{"list"})
+	if err != nil || len(schedules) != 2 {
+		t.Fatalf("unexpected schedules %v %v", schedules, err)
+	}
+	if schedules[0].Type != backupTypePeriodic || !schedules[0].Next.Equal(time.Date(2021, 1, 2, 2, 0, 0, 0, time.Local)) ||
+		schedules[1].Type != "nightly" || !schedules[1].Next.Equal(time.Date(2021, 1, 2, 3, 30, 0, 0, time.Local)) {
+		t.Errorf("unexpected schedules %v", schedules)
+	}
+
+	// Nothing due.
+	bh.runDueSchedules(ctx, st.sm)
+
+	// Both due. Runs once even though the periodic schedule missed a run.
+	setNow(time.Date(2021, 1, 2, 4, 0, 0, 0, time.Local))
+	st.spMock.EXPECT().IsRunning().Return(false).Times(2)
+	st.gwMock.EXPECT().IsDirClean(gomock.Any()).Return(false, nil).Times(2)
+	st.gwMock.EXPECT().RunGitCommand(gomock.Any(), "add", ".").Times(2)
+	st.gwMock.EXPECT().RunGitCommand(gomock.Any(), "checkout", "--orphan", "saves/periodic/20210102-040000")
+	st.gwMock.EXPECT().RunGitCommand(gomock.Any(), "checkout", "--orphan", "saves/nightly/20210102-040000")
+	st.gwMock.EXPECT().RunGitCommand(gomock.Any(), "commit", "--allow-empty", "-m", "Scheduled backup (0 */2 * * *)")
+	st.gwMock.EXPECT().RunGitCommand(gomock.Any(), "commit", "--allow-empty", "-m", "Nightly backup")
+	bh.runDueSchedules(ctx, st.sm)
+
+	st.spMock.EXPECT().Stop(gomock.Any(), gomock.Any())
+	st.PushCommandAsync("backup schedule list")
+	st.PushCommandAsync("quit")
+	if err := st.sm.Process(ctx, []string{}); err != nil {
+		t.Errorf("expecting nil, got %v", err)
+	}
+	for _, exp := range []string{
+		"1. 0 */2 * * * saves/periodic 'Scheduled backup (0 */2 * * *)', next run at 20210102-06:00",
+		"2. 30 3 * * * saves/nightly 'Nightly backup', next run at 20210103-03:30",
+	} {
+		if !strings.Contains(st.stdoutLog.String(), exp) {
+			t.Errorf("expected: %s, Got: %v", exp, st.stdoutLog.String())
+		}
+	}
+}
+
+func TestBackup_SchedulesDueTogether(t *testing.T) {
+	st := newBackupTest(t)
+	defer st.close(t)
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeTestConfig(t, path, `{"backup_schedules": [
+		{"cron": "0 * * * *", "description": "Hourly"},
+		{"cron": "0 4 * * *", "description": "Before the restart"}
+	]}`)
+	st.sm.config.path = path
+	if err := st.sm.config.Load(); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2021, 1, 2, 3, 30, 0, 0, time.Local)
+	var lock sync.Mutex
+	st.nowFn = func() time.Time {
+		lock.Lock()
+		defer lock.Unlock()
+		return now
+	}
+	bh := st.sm.handlers["backup"].(*backupHandler)
+	bh.afterFn = func(d time.Duration) <-chan time.Time {
+		return nil
+	}
+	bh.applySchedules(st.sm)
+
+	// Same backup type due at the same time takes a single backup.
+	lock.Lock()
+	now = time.Date(2021, 1, 2, 4, 0, 0, 0, time.Local)
+	lock.Unlock()
+	st.spMock.EXPECT().IsRunning().Return(false)
+	st.gwMock.EXPECT().IsDirClean(gomock.Any()).Return(false, nil)
+	st.gwMock.EXPECT().RunGitCommand(gomock.Any(), "add", ".")
+	st.gwMock.EXPECT().RunGitCommand(gomock.Any(), "checkout", "--orphan", "saves/periodic/20210102-040000")
+	st.gwMock.EXPECT().RunGitCommand(gomock.Any(), "commit", "--allow-empty", "-m", "Hourly; Before the restart")
+	bh.runDueSchedules(context.Background(), st.sm)
+}
+
+func TestPrune_Retention(t *testing.T) {
+	st := newBackupTest(t)
+	defer st.close(t)
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeTestConfig(t, path, `{"backup_retention": {"default": {"keep_all": "24h", "daily": "7d"}}}`)
+	st.sm.config.path = path
+	if err := st.sm.config.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	nowTime := time.Date(2021, 1, 10, 12, 0, 0, 0, time.Local)
+	st.nowFn = func() time.Time {
+		return nowTime
+	}
+	branchList := []GitReference{
+		newTestBranch("saves/periodic/", nowTime.Add(-time.Hour)),
+		newTestBranch("saves/periodic/", nowTime.Add(-time.Hour*48)),
+		newTestBranch("saves/periodic/", nowTime.Add(-time.Hour*49)),
+		newTestBranch("saves/nightly/", nowTime.Add(-time.Hour*24*5)),
+		newTestBranch("saves/nightly/", nowTime.Add(-time.Hour*24*8)),
+		newTestBranch("saves/manual/", nowTime.Add(-time.Hour*24*8)),
+	}
+	st.gwMock.EXPECT().ListBranches(gomock.Any(), gomock.Any(), []string{"saves/*"}).Return(branchList, nil).Times(2)
+	st.spMock.EXPECT().Stop(gomock.Any(), gomock.Any())
+
+	bh := st.sm.handlers["backup"].(*backupHandler)
+	result, err := bh.HandleResult(context.Background(), st.sm, []string{"backup", "prune", "--dry-run"})
+	if err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	expired := result.([]GitReference)
+	if len(expired) != 2 || expired[0].Ref != branchList[4].Ref || expired[1].Ref != branchList[2].Ref {
+		t.Errorf("unexpected expired backups %v", expired)
+	}
+
+	st.PushCommandAsync("backup prune --dry-run")
+	st.PushCommandAsync("quit")
+	if err := st.sm.Process(context.Background(), []string{}); err != nil {
+		t.Errorf("expecting nil, got %v", err)
+	}
+	out := st.stdoutLog.String()
+	if !strings.Contains(out, "the following backups would be deleted:") ||
+		!strings.Contains(out, branchList[2].Ref) || !strings.Contains(out, branchList[4].Ref) {
+		t.Errorf("expected backups to be listed, Got: %v", out)
+	}
+	if strings.Contains(out, branchList[5].Ref) {
+		t.Errorf("manual backup listed. %v", out)
+	}
+}
+
+func TestPrune_RetentionAfterBackup(t *testing.T) {
+	st := newBackupTest(t)
+	defer st.close(t)
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeTestConfig(t, path, `{"backup_retention": {"periodic": {"keep_all": "24h"}}}`)
+	st.sm.config.path = path
+	if err := st.sm.config.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	nowTime := time.Date(2021, 1, 10, 12, 0, 0, 0, time.Local)
+	st.nowFn = func() time.Time {
+		return nowTime
+	}
+	old := newTestBranch("saves/periodic/", nowTime.Add(-time.Hour*48))
+	st.spMock.EXPECT().IsRunning().Return(false)
+	st.gwMock.EXPECT().IsDirClean(gomock.Any()).Return(true, nil)
+	st.gwMock.EXPECT().ListBranches(gomock.Any(), gomock.Any(), []string{"saves/*"}).Return([]GitReference{
+		newTestBranch("saves/periodic/", nowTime.Add(-time.Hour)),
+		old,
+	}, nil)
+	st.gwMock.EXPECT().DeleteBranches(gomock.Any(), gomock.Any(), []GitReference{old}, false)
+
+	bh := st.sm.handlers["backup"].(*backupHandler)
+	if err := bh.periodicBackup(context.Background(), st.sm); err != nil {
+		t.Errorf("expecting nil, got %v", err)
+	}
+}
+
+func TestPrune_SkipsPinned(t *testing.T) {
+	st := newBackupTest(t)
+	defer st.close(t)
+
+	nowTime := time.Date(2021, 1, 10, 12, 0, 0, 0, time.Local)
+	st.nowFn = func() time.Time {
+		return nowTime
+	}
+	pinned := newTestBranch("saves/periodic/", nowTime.Add(-time.Hour*72))
+	pinned.Pinned = true
+	old := newTestBranch("saves/periodic/", nowTime.Add(-time.Hour*49))
+	st.gwMock.EXPECT().ListBranches(gomock.Any(), gomock.Any(), gomock.Any()).Return([]GitReference{
+		pinned,
+		newTestBranch("saves/periodic/", nowTime.Add(-time.Hour*50)),
+		old,
+		newTestBranch("saves/periodic/", nowTime.Add(-time.Hour)),
+	}, nil)
+	st.gwMock.EXPECT().DeleteBranches(gomock.Any(), gomock.Any(), []GitReference{old}, false)
+	st.spMock.EXPECT().Stop(gomock.Any(), gomock.Any())
+
+	st.PushCommandAsync("backup prune 12h 12h")
+	st.PushCommandAsync("quit")
+	if err := st.sm.Process(context.Background(), []string{}); err != nil {
+		t.Errorf("expecting nil, got %v", err)
+	}
+}
+
+func TestPrune_ForceIncludesPinned(t *testing.T) {
+	st := newBackupTest(t)
+	defer st.close(t)
+
+	nowTime := time.Date(2021, 1, 10, 12, 0, 0, 0, time.Local)
+	st.nowFn = func() time.Time {
+		return nowTime
+	}
+	pinned := newTestBranch("saves/periodic/", nowTime.Add(-time.Hour*72))
+	pinned.Pinned = true
+	old := newTestBranch("saves/periodic/", nowTime.Add(-time.Hour*49))
+	st.gwMock.EXPECT().ListBranches(gomock.Any(), gomock.Any(), gomock.Any()).Return([]GitReference{
+		pinned,
+		newTestBranch("saves/periodic/", nowTime.Add(-time.Hour*50)),
+		old,
+		newTestBranch("saves/periodic/", nowTime.Add(-time.Hour)),
+	}, nil)
+	st.gwMock.EXPECT().DeleteBranches(gomock.Any(), gomock.Any(), []GitReference{pinned, old}, true)
+	st.spMock.EXPECT().Stop(gomock.Any(), gomock.Any())
+
+	st.PushCommandAsync("backup prune --force 12h 12h")
+	st.PushCommandAsync("quit")
+	if err := st.sm.Process(context.Background(), []string{}); err != nil {
+		t.Errorf("expecting nil, got %v", err)
+	}
+}
+
+func TestBackup_GC(t *testing.T) {
+	st := newBackupTest(t)
+	defer st.close(t)
+
+	gomock.InOrder(
+		st.gwMock.EXPECT().CountObjects(gomock.Any()).Return(GitObjectStats{Size: 3 * 1024 * 1024}, nil),
+		st.gwMock.EXPECT().CollectGarbage(gomock.Any(), gomock.Any()),
+		st.gwMock.EXPECT().Fsck(gomock.Any()),
+		st.gwMock.EXPECT().CountObjects(gomock.Any()).Return(GitObjectStats{SizePack: 1024 * 1024}, nil),
+	)
+	st.spMock.EXPECT().Stop(gomock.Any(), gomock.Any())
+
+	bh := st.sm.handlers["backup"].(*backupHandler)
+	bh.activityLock.Lock()
+	bh.saving = true
+	bh.activityLock.Unlock()
+	if _, err := bh.collectGarbage(context.Background(), st.sm); err == nil || !strings.Contains(err.Error(), "backup in progress") {
+		t.Errorf("expected backup in progress error, got %v", err)
+	}
+	bh.activityLock.Lock()
+	bh.saving = false
+	bh.activityLock.Unlock()
+
+	st.PushCommandAsync("backup gc")
+	st.PushCommandAsync("quit")
+	if err := st.sm.Process(context.Background(), []string{}); err != nil {
+		t.Errorf("expecting nil, got %v", err)
+	}
+	if exp := "reclaimed 2.0 MiB (3.0 MiB -> 1.0 MiB)"; !strings.Contains(st.stdoutLog.String(), exp) {
+		t.Errorf("expected: %s, Got: %v", exp, st.stdoutLog.String())
+	}
+}
+
+func TestParseCountObjects(t *testing.T) {
+	stats, err := parseCountObjects("count: 12\nsize: 48\nin-pack: 30\npacks: 1\nsize-pack: 100\nprune-packable: 0\ngarbage: 0\nsize-garbage: 0\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Count != 12 || stats.InPack != 30 || stats.TotalSize() != 148*1024 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if _, err := parseCountObjects("count: x"); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestFindWorldRoot(t *testing.T) {
+	archive := func(names ...string) []*zip.File {
+		var files []*zip.File
+		for _, n := range names {
+			files = append(files, &zip.File{FileHeader: zip.FileHeader{Name: n}})
+		}
+		return files
+	}
+	tests := []struct {
+		files []*zip.File
+		root  string
+		err   string
+	}{
+		{archive("level.dat", "db/CURRENT"), "", ""},
+		{archive("worlds/world/level.dat", "worlds/world/db/CURRENT", "server.properties"), "worlds/world/", ""},
+		{archive("level.dat", "db/CURRENT", "../server.properties"), "", "unsafe path ../server.properties"},
+		{archive("level.dat", "db/CURRENT", "db/../../../etc/passwd"), "", "unsafe path db/../../../etc/passwd"},
+		{archive("level.dat", "db/CURRENT", `..\..\evil.dll`), "", `unsafe path ..\..\evil.dll`},
+		{archive("level.dat", "db/CURRENT", "/etc/cron.d/evil"), "", "unsafe path /etc/cron.d/evil"},
+		{archive("level.dat", "db/CURRENT", `C:\Windows\evil.dll`), "", `unsafe path C:\Windows\evil.dll`},
+		{archive("level.dat"), "", "db folder not found next to level.dat"},
+		{archive("db/CURRENT"), "", "level.dat not found"},
+	}
+	for _, tc := range tests {
+		root, err := findWorldRoot(tc.files)
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("%v: expected error %q, got %q %v", tc.files[len(tc.files)-1].Name, tc.err, root, err)
+			}
+			continue
+		}
+		if err != nil || root != tc.root {
+			t.Errorf("%v: expected %q, got %q %v", tc.files[0].Name, tc.root, root, err)
+		}
+	}
+}
+
+func TestExtractWorld_SizeLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "world.mcworld")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(f)
+	for name, content := range map[string]string{"level.dat": "level data", "db/CURRENT": strings.Repeat("x", 100)} {
+		fw, _ := w.Create(name)
+		io.WriteString(fw, content)
+	}
+	w.Close()
+	f.Close()
+
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	worlds := t.TempDir()
+	dir := filepath.Join(worlds, "world")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "live.txt"), []byte("live"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The live world is left unchanged if the extraction fails.
+	if err := extractWorld(r.File, "", dir, 50); err == nil || !strings.Contains(err.Error(), "exceeds the size limit") {
+		t.Errorf("expected the size limit error, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "live.txt")); err != nil {
+		t.Errorf("live world changed by the failed extraction. %v", err)
+	}
+	if err := extractWorld(r.File, "", dir, 110); err != nil {
+		t.Errorf("expecting nil, got %v", err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(dir, "db", "CURRENT")); len(content) != 100 {
+		t.Errorf("unexpected extracted file %q", content)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "live.txt")); !os.IsNotExist(err) {
+		t.Errorf("old world files not removed. %v", err)
+	}
+	if entries, _ := os.ReadDir(worlds); len(entries) != 1 {
+		t.Errorf("temporary directories left behind. %v", entries)
+	}
+}
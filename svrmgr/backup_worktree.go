@@ -0,0 +1,121 @@
+package svrmgr
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/fieryorc/BedrockServerManager/winutils"
+)
+
+// Extract checks out the backup into a separate directory using git worktree.
+// The workspace is not changed, so it can be used while the server is running.
+func (h *backupHandler) Extract(ctx context.Context, provider Provider, args []string) error {
+	if len(args) != 2 {
+		return invalidArgsErrorf("invalid args. must specify the backup name and the directory. try 'help' for usage")
+	}
+	ref, err := findBackup(ctx, provider, args[0])
+	if err != nil {
+		return err
+	}
+	dir, err := h.worktreeDir(ctx, provider, args[1])
+	if err != nil {
+		return err
+	}
+
+	if err := provider.GitWrapper().AddWorktree(ctx, provider, dir, ref.Ref); err != nil {
+		return err
+	}
+	provider.Log(fmt.Sprintf("backup %s extracted to %s. run 'backup worktree remove %s' when done", ref.Ref, dir, dir))
+	return nil
+}
+
+// Worktree handles `backup worktree list` and `backup worktree remove [--force] DIR`.
+func (h *backupHandler) Worktree(ctx context.Context, provider Provider, args []string) error {
+	if len(args) > 0 && args[0] == "remove" {
+		force, rest := parseFlag(args[1:], "--force")
+		if len(rest) != 1 {
+			return invalidArgsErrorf("invalid args. must specify the directory. try 'help' for usage")
+		}
+		dir, err := filepath.Abs(rest[0])
+		if err != nil {
+			return err
+		}
+		if err := provider.GitWrapper().RemoveWorktree(ctx, provider, dir, force); err != nil {
+			return err
+		}
+		provider.Log(fmt.Sprintf("removed %s", dir))
+		return nil
+	}
+
+	worktrees, err := h.worktreeList(ctx, provider, args)
+	if err != nil {
+		return err
+	}
+	if len(worktrees) == 0 {
+		provider.Log("no extracted backups")
+		return nil
+	}
+	var out []string
+	for _, wt := range worktrees {
+		backup := wt.Backup
+		if backup == "" {
+			backup = wt.Hash
+		}
+		out = append(out, fmt.Sprintf("%s %s", wt.Path, backup))
+	}
+	provider.Printfln("%s", strings.Join(out, winutils.NewLine()))
+	return nil
+}
+
+// worktreeList returns the extracted backups for `backup worktree list`.
+func (h *backupHandler) worktreeList(ctx context.Context, provider Provider, args []string) ([]GitWorktree, error) {
+	if len(args) > 0 && args[0] != "list" {
+		return nil, invalidArgsErrorf("unknown command. try help")
+	}
+	gw := provider.GitWrapper()
+	worktrees, err := gw.ListWorktrees(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(worktrees) == 0 {
+		return worktrees, nil
+	}
+
+	// Worktrees are detached. Find the backups by the commit.
+	refs, err := gw.ListRefs(ctx, "", backupRefPrefix)
+	if err != nil {
+		return nil, err
+	}
+	backups := map[string]string{}
+	for ref, hash := range refs {
+		backups[hash] = strings.TrimPrefix(ref, "refs/heads/")
+	}
+	for i := range worktrees {
+		worktrees[i].Backup = backups[worktrees[i].Hash]
+	}
+	return worktrees, nil
+}
+
+// worktreeDir returns the absolute path of the directory to extract the backup to.
+// The directory must be outside the workspace, so that it is not included in the backups.
+func (h *backupHandler) worktreeDir(ctx context.Context, provider Provider, dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	root, err := provider.GitWrapper().RunGitCommand(ctx, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	root = filepath.FromSlash(strings.TrimSpace(root))
+	target := dir
+	if resolved, err := filepath.EvalSymlinks(filepath.Dir(dir)); err == nil {
+		target = filepath.Join(resolved, filepath.Base(dir))
+	}
+	if rel, err := filepath.Rel(root, target); err == nil && !strings.HasPrefix(rel, "..") {
+		return "", invalidArgsErrorf("%s is inside the git workspace %s. choose a directory outside of it", dir, root)
+	}
+	return dir, nil
+}
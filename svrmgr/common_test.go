@@ -2,8 +2,8 @@ package svrmgr
 
 import (
 	"bytes"
-	"flag"
 	"io"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -12,14 +12,36 @@ import (
 	gomock "github.com/golang/mock/gomock"
 )
 
+// syncBuffer is a bytes.Buffer that is safe for concurrent use.
+type syncBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) ReadString(delim byte) (string, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.ReadString(delim)
+}
+
+func (b *syncBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
+
 type svrmgrTest struct {
 	ctrl             *gomock.Controller
 	sm               *ServerManager
 	stdinReader      *io.PipeReader
 	stdinWriter      *io.PipeWriter
-	stdoutReader     *io.PipeReader
-	stdoutWriter     *io.PipeWriter
-	stdoutLog        bytes.Buffer
+	stdoutLog        syncBuffer
 	gwMock           *MockGitWrapper
 	spMock           *MockServerProcess
 	done             bool
@@ -47,23 +69,6 @@ func (st *svrmgrTest) PushCommandAsync(str string) {
 	}
 }
 
-func (st *svrmgrTest) readStdout(t *testing.T) {
-	buf := make([]byte, 1024)
-	for {
-		n, err := st.stdoutReader.Read(buf)
-		if err != nil && err != io.EOF && !st.done {
-			t.Logf("stdout read error. %v", err)
-		}
-		if n == 0 {
-			break
-		}
-
-		if _, err := st.stdoutLog.Write(buf[:n]); err != nil {
-			t.Logf("unable to write to stdout log. %v", err)
-		}
-	}
-}
-
 func (st *svrmgrTest) ReadOutputLine(t *testing.T) string {
 	ln, err := st.stdoutLog.ReadString('\n')
 	if err != nil && !st.done {
@@ -72,17 +77,20 @@ func (st *svrmgrTest) ReadOutputLine(t *testing.T) string {
 	return ln
 }
 
+// expectStorageStats expects the status command to read the backup storage usage.
+func (st *svrmgrTest) expectStorageStats() {
+	st.gwMock.EXPECT().CountObjects(gomock.Any()).Return(GitObjectStats{SizePack: 2048}, nil)
+	st.gwMock.EXPECT().ListBranches(gomock.Any(), gomock.Any(), []string{"saves/*"}).Return(nil, nil)
+}
+
 func (st *svrmgrTest) close(t *testing.T) {
 	st.done = true
 	st.stdinWriter.Close()
 	st.stdinReader.Close()
-	st.stdoutReader.Close()
-	st.stdoutWriter.Close()
 	st.ctrl.Finish()
 }
 
 func newSvrMgrTest(t *testing.T) *svrmgrTest {
-	flag.Set("bedrock_exe", `c:\foo.exe`)
 	st := &svrmgrTest{
 		sm:    newServerManagerForTests(),
 		nowFn: time.Now,
@@ -90,14 +98,14 @@ func newSvrMgrTest(t *testing.T) *svrmgrTest {
 
 	st.stdinReader, st.stdinWriter = io.Pipe()
 	st.sm.stdin = st.stdinReader
-	st.stdoutReader, st.stdoutWriter = io.Pipe()
-	st.sm.stdout = st.stdoutWriter
+	st.sm.stdout = &st.stdoutLog
 	st.ctrl = gomock.NewController(t)
 	st.gwMock = NewMockGitWrapper(st.ctrl)
 	st.sm.gw = st.gwMock
+	// The backup deletions are recorded in the git directory.
+	st.gwMock.EXPECT().GitPath(gomock.Any(), deletedRefsFile).Return(filepath.Join(t.TempDir(), deletedRefsFile), nil).AnyTimes()
 	st.spMock = NewMockServerProcess(st.ctrl)
 	st.sm.serverProcess = st.spMock
-	go st.readStdout(t)
 
 	st.sm.loadPlugings()
 	bh := st.sm.handlers["backup"].(*backupHandler)
@@ -0,0 +1,457 @@
+package svrmgr
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+var configFile = flag.String("config", "bedrock_manager.json", "path to the config file. flags specified on the command line override the config file")
+
+// configKeyAliases is the config file key for the command aliases.
+// All other keys, except configKeyBackupSchedules and configKeyBackupRetention, are setting names.
+const configKeyAliases = "aliases"
+
+// configKeyBackupSchedules is the config file key for the cron style backup schedules.
+const configKeyBackupSchedules = "backup_schedules"
+
+// configKeyBackupRetention is the config file key for the backup retention policies.
+const configKeyBackupRetention = "backup_retention"
+
+// Sources of the setting values.
+const (
+	configSourceDefault     = "default"
+	configSourceCommandLine = "command line"
+	configSourceFile        = "config file"
+)
+
+// configSettingNames are the manager settings that can be set in the config file.
+// Settings with a reload hook registered with OnReload are applied when the
+// config is reloaded. The others are read only at startup.
+var configSettingNames = []string{
+	"api_address",
+	"api_token",
+	"backup_gc_schedule",
+	"backup_import_max_size",
+	"backup_interval",
+	"backup_only_when_active",
+	"backup_prune_cutoff",
+	"backup_prune_interval",
+	"backup_remotes",
+	"bedrock_exe",
+	"git_command_timeout",
+	"git_dry_run",
+	"git_exe",
+	"git_gc_timeout",
+	"git_long_command_timeout",
+	"git_workspace",
+	"player_sessions_file",
+	"restart_backoff",
+	"restart_backoff_max",
+	"restart_crash_window",
+	"restart_max_crashes",
+	"restart_policy",
+	"restart_times",
+	"restart_warning",
+	"server_exit_log_lines",
+	"server_log_buffer_lines",
+	"server_log_dir",
+	"server_log_max_size",
+	"server_log_retention",
+	"server_output_line_limit",
+	"server_stop_timeout",
+	"server_stop_warning",
+}
+
+// configHook applies a setting changed by a config reload.
+// value is the new value of the flag, or the schedules for backup_schedules.
+type configHook func(provider Provider, value interface{})
+
+// config manages the settings loaded from the config file.
+// The config file is a JSON object whose keys are setting names. For example:
+//
+//	{
+//		"backup_interval": "1h",
+//		"restart_policy": "always",
+//		"aliases": {"bb": "backup save"},
+//		"backup_schedules": [{"cron": "30 3 * * *", "type": "nightly", "description": "Nightly backup"}],
+//		"backup_retention": {"default": {"keep_all": "24h", "hourly": "7d", "daily": "30d", "weekly": "365d"}}
+//	}
+//
+// Flags specified on the command line take precedence over the config file.
+// The flags are set only by Load at startup. Reload passes the changed values
+// to the reload hooks, so the flags can be read without locking.
+type config struct {
+	lock      sync.Mutex
+	path      string
+	cmdLine   map[string]bool            // Flags set on the command line.
+	fromFile  map[string]string          // Flags set from the config file.
+	values    map[string]string          // Current values of the settings.
+	hooks     map[string]configHook      // Reload hooks by setting name.
+	aliases   map[string]string          // Aliases from the config file.
+	schedules []backupScheduleConfig     // Backup schedules from the config file.
+	retention map[string]retentionConfig // Backup retention policies by backup type from the config file.
+}
+
+// backupScheduleConfig is a backup schedule in the config file.
+type backupScheduleConfig struct {
+	Cron        string `json:"cron"`
+	Type        string `json:"type"`        // Backup type label. Defaults to periodic.
+	Description string `json:"description"` // Backup description. Defaults to the cron expression.
+}
+
+// configContent is the parsed and validated content of the config file.
+type configContent struct {
+	values    map[string]string
+	aliases   map[string]string
+	schedules []backupScheduleConfig
+	retention map[string]retentionConfig
+}
+
+// newConfig creates the config for the given file. Must be called after the
+// command line is parsed and before any config is applied.
+// If path is empty, no config file is used.
+func newConfig(path string) *config {
+	c := &config{
+		path:     path,
+		cmdLine:  map[string]bool{},
+		fromFile: map[string]string{},
+		values:   map[string]string{},
+		hooks:    map[string]configHook{},
+		aliases:  map[string]string{},
+	}
+	flag.Visit(func(f *flag.Flag) {
+		c.cmdLine[f.Name] = true
+	})
+	for _, name := range configSettingNames {
+		c.values[name] = flag.Lookup(name).Value.String()
+	}
+	return c
+}
+
+// Load reads the config file and sets the flags.
+// Must be called only at startup, before the flags are used.
+func (c *config) Load() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	file, err := c.read()
+	if err != nil {
+		return err
+	}
+	for name, v := range file.values {
+		if c.cmdLine[name] {
+			glog.Infof("config: %s is overridden by the command line", name)
+			continue
+		}
+		glog.Infof("config: %s = %s", name, v)
+		if err := flag.Set(name, v); err != nil {
+			return fmt.Errorf("invalid value for '%s'. %v", name, err)
+		}
+	}
+	for _, name := range configSettingNames {
+		c.values[name] = flag.Lookup(name).Value.String()
+	}
+	c.update(file)
+	return nil
+}
+
+// OnReload registers the hook that applies the setting when the config is reloaded.
+func (c *config) OnReload(name string, hook configHook) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.hooks[name] = hook
+}
+
+// Reload reads the config file again and calls the reload hooks of the changed settings.
+// Settings removed from the config file go back to their defaults.
+// Nothing is applied if the config file is invalid or changes a setting
+// that has no reload hook.
+func (c *config) Reload(provider Provider) error {
+	type change struct {
+		name  string
+		value interface{}
+		hook  configHook
+	}
+
+	c.lock.Lock()
+	file, err := c.read()
+	if err != nil {
+		c.lock.Unlock()
+		return err
+	}
+
+	var changes []change
+	values := map[string]string{}
+	for _, name := range configSettingNames {
+		values[name] = c.values[name]
+		if c.cmdLine[name] {
+			continue
+		}
+		f := flag.Lookup(name)
+		str, ok := file.values[name]
+		if !ok {
+			if _, ok := c.fromFile[name]; !ok {
+				continue
+			}
+			str = f.DefValue
+		}
+		v, err := parseFlagValue(f, str)
+		if err != nil {
+			c.lock.Unlock()
+			return fmt.Errorf("invalid value for '%s'. %v", name, err)
+		}
+		if v.String() == c.values[name] {
+			continue
+		}
+		hook, ok := c.hooks[name]
+		if !ok {
+			c.lock.Unlock()
+			return fmt.Errorf("'%s' cannot be changed by a reload. restart the manager to apply it", name)
+		}
+		values[name] = v.String()
+		changes = append(changes, change{name: name, value: v.Get(), hook: hook})
+	}
+	if !reflect.DeepEqual(file.schedules, c.schedules) {
+		if hook, ok := c.hooks[configKeyBackupSchedules]; ok {
+			changes = append(changes, change{name: configKeyBackupSchedules, value: file.schedules, hook: hook})
+		}
+	}
+
+	c.values = values
+	c.update(file)
+	c.lock.Unlock()
+
+	for _, ch := range changes {
+		glog.Infof("config: applying %s", ch.name)
+		ch.hook(provider, ch.value)
+	}
+	return nil
+}
+
+// read reads and validates the config file.
+// Must be called with the lock held.
+func (c *config) read() (*configContent, error) {
+	file := &configContent{
+		values:  map[string]string{},
+		aliases: map[string]string{},
+	}
+	if c.path == "" {
+		return file, nil
+	}
+	content, err := os.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		glog.Infof("config file %s not found", c.path)
+		return file, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config file %s. %v", c.path, err)
+	}
+	if file.values, file.aliases, err = parseConfig(content); err != nil {
+		return nil, fmt.Errorf("invalid config file %s. %v", c.path, err)
+	}
+	if file.schedules, err = parseConfigSchedules(content); err != nil {
+		return nil, fmt.Errorf("invalid config file %s. %v", c.path, err)
+	}
+	if file.retention, err = parseConfigRetention(content); err != nil {
+		return nil, fmt.Errorf("invalid config file %s. %v", c.path, err)
+	}
+
+	for name, v := range file.values {
+		f := configSetting(name)
+		if f == nil {
+			return nil, fmt.Errorf("unknown setting '%s' in config file", name)
+		}
+		if _, err := parseFlagValue(f, v); err != nil {
+			return nil, fmt.Errorf("invalid value for '%s'. %v", name, err)
+		}
+	}
+	return file, nil
+}
+
+// update records the content of the config file.
+// Must be called with the lock held.
+func (c *config) update(file *configContent) {
+	c.fromFile = file.values
+	c.aliases = file.aliases
+	c.schedules = file.schedules
+	c.retention = file.retention
+}
+
+// Alias returns the alias defined in the config file.
+func (c *config) Alias(name string) (string, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	al, ok := c.aliases[name]
+	return al, ok
+}
+
+// AliasNames returns the names of the aliases defined in the config file.
+func (c *config) AliasNames() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var names []string
+	for name := range c.aliases {
+		names = append(names, name)
+	}
+	return names
+}
+
+// BackupSchedules returns the backup schedules defined in the config file.
+func (c *config) BackupSchedules() []backupScheduleConfig {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]backupScheduleConfig{}, c.schedules...)
+}
+
+// BackupRetention returns the backup retention policies by backup type defined in the config file.
+func (c *config) BackupRetention() map[string]retentionConfig {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	result := map[string]retentionConfig{}
+	for k, v := range c.retention {
+		result[k] = v
+	}
+	return result
+}
+
+// Source returns where the value of the flag came from.
+func (c *config) Source(name string) string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.cmdLine[name] {
+		return configSourceCommandLine
+	}
+	if _, ok := c.fromFile[name]; ok {
+		return configSourceFile
+	}
+	return configSourceDefault
+}
+
+// Value returns the current value of the setting.
+func (c *config) Value(name string) string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.values[name]
+}
+
+// Path returns the config file path.
+func (c *config) Path() string {
+	return c.path
+}
+
+// parseConfig parses the config file content into flag values and aliases.
+func parseConfig(content []byte) (map[string]string, map[string]string, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(content, &raw); err != nil {
+		return nil, nil, err
+	}
+
+	values := map[string]string{}
+	aliases := map[string]string{}
+	for k, v := range raw {
+		if k == configKeyBackupSchedules || k == configKeyBackupRetention {
+			continue
+		}
+		if k == configKeyAliases {
+			if err := json.Unmarshal(v, &aliases); err != nil {
+				return nil, nil, fmt.Errorf("aliases must be an object of strings. %v", err)
+			}
+			continue
+		}
+
+		var str string
+		if err := json.Unmarshal(v, &str); err == nil {
+			values[k] = str
+			continue
+		}
+		var val interface{}
+		if err := json.Unmarshal(v, &val); err != nil {
+			return nil, nil, err
+		}
+		switch val.(type) {
+		case float64, bool:
+			values[k] = strings.TrimSpace(string(v))
+		default:
+			return nil, nil, fmt.Errorf("value of '%s' must be a string, number or boolean", k)
+		}
+	}
+	return values, aliases, nil
+}
+
+// parseConfigSchedules parses and validates the backup schedules in the config file content.
+func parseConfigSchedules(content []byte) ([]backupScheduleConfig, error) {
+	var raw struct {
+		Schedules []backupScheduleConfig `json:"backup_schedules"`
+	}
+	if err := json.Unmarshal(content, &raw); err != nil {
+		return nil, fmt.Errorf("backup_schedules must be a list of schedules. %v", err)
+	}
+	for _, sc := range raw.Schedules {
+		if _, err := newBackupSchedule(sc); err != nil {
+			return nil, err
+		}
+	}
+	return raw.Schedules, nil
+}
+
+// parseConfigRetention parses and validates the backup retention policies in the config file content.
+func parseConfigRetention(content []byte) (map[string]retentionConfig, error) {
+	var raw struct {
+		Retention map[string]retentionConfig `json:"backup_retention"`
+	}
+	if err := json.Unmarshal(content, &raw); err != nil {
+		return nil, fmt.Errorf("backup_retention must be an object of retention policies by backup type. %v", err)
+	}
+	for bt, rc := range raw.Retention {
+		if bt != retentionDefaultKey && !backupTypePattern.MatchString(bt) {
+			return nil, fmt.Errorf("invalid backup type '%s' in backup_retention", bt)
+		}
+		if _, err := newRetentionPolicy(rc); err != nil {
+			return nil, fmt.Errorf("invalid retention policy for '%s'. %v", bt, err)
+		}
+	}
+	return raw.Retention, nil
+}
+
+// parseFlagValue parses the value into a new value of the flag's type.
+// The flag is left unchanged.
+func parseFlagValue(f *flag.Flag, value string) (flag.Getter, error) {
+	v, ok := reflect.New(reflect.TypeOf(f.Value).Elem()).Interface().(flag.Getter)
+	if !ok {
+		return nil, fmt.Errorf("unsupported setting type %T", f.Value)
+	}
+	if err := v.Set(value); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// configSetting returns the flag of the manager setting. nil if there is no such setting.
+func configSetting(name string) *flag.Flag {
+	for _, n := range configSettingNames {
+		if n == name {
+			return flag.Lookup(name)
+		}
+	}
+	return nil
+}
+
+// configSettings returns the manager settings sorted by name.
+func configSettings() []*flag.Flag {
+	var result []*flag.Flag
+	for _, name := range configSettingNames {
+		result = append(result, flag.Lookup(name))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
@@ -0,0 +1,184 @@
+package svrmgr
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// writeTestConfig writes the config file and resets the flags it may change once the test ends.
+func writeTestConfig(t *testing.T, path, content string) {
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		for _, name := range []string{"backup_interval", "restart_policy", "server_output_line_limit", "git_dry_run"} {
+			f := flag.Lookup(name)
+			f.Value.Set(f.DefValue)
+		}
+	})
+}
+
+func TestParseConfig(t *testing.T) {
+	values, aliases, err := parseConfig([]byte(`{
+		"backup_interval": "1h",
+		"server_output_line_limit": 200,
+		"git_dry_run": true,
+		"aliases": {"bb": "backup save"}
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if values["backup_interval"] != "1h" || values["server_output_line_limit"] != "200" || values["git_dry_run"] != "true" {
+		t.Errorf("unexpected values %v", values)
+	}
+	if aliases["bb"] != "backup save" {
+		t.Errorf("unexpected aliases %v", aliases)
+	}
+
+	for _, content := range []string{`[]`, `{"aliases": "bb"}`, `{"backup_interval": ["1h"]}`} {
+		if _, _, err = parseConfig([]byte(content)); err == nil {
+			t.Errorf("expected error for %s", content)
+		}
+	}
+}
+
+func TestConfig_Load(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeTestConfig(t, path, `{"backup_interval": "1h", "server_output_line_limit": 200}`)
+
+	c := newConfig(path)
+	// Flags set by earlier tests are reported as set on the command line.
+	c.cmdLine = map[string]bool{"server_output_line_limit": true}
+	if err := c.Load(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if *autoBackupInterval != time.Hour {
+		t.Errorf("backup_interval not applied. %v", *autoBackupInterval)
+	}
+	if *maxLineLength != 100 {
+		t.Errorf("command line flag overridden by config. %v", *maxLineLength)
+	}
+	if src := c.Source("backup_interval"); src != configSourceFile {
+		t.Errorf("unexpected source %s", src)
+	}
+
+	// Removed settings go back to defaults. Reload applies them with the hooks only.
+	var applied interface{}
+	c.OnReload("backup_interval", func(provider Provider, value interface{}) {
+		applied = value
+	})
+	writeTestConfig(t, path, `{}`)
+	if err := c.Reload(nil); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if applied != time.Minute*30 || c.Value("backup_interval") != "30m0s" {
+		t.Errorf("backup_interval not reset. %v", applied)
+	}
+	if *autoBackupInterval != time.Hour {
+		t.Errorf("flag changed by reload. %v", *autoBackupInterval)
+	}
+
+	// Settings without a reload hook cannot be changed by a reload.
+	applied = nil
+	writeTestConfig(t, path, `{"backup_interval": "2h", "git_exe": "other-git"}`)
+	if err := c.Reload(nil); err == nil {
+		t.Errorf("expected error for git_exe")
+	}
+	if applied != nil || c.Value("backup_interval") != "30m0s" || c.Value("git_exe") != defaultGitExecutable {
+		t.Errorf("config partially applied. %v", applied)
+	}
+}
+
+func TestConfig_Settings(t *testing.T) {
+	names := map[string]bool{}
+	for _, f := range configSettings() {
+		if f == nil {
+			t.Fatalf("setting not defined. %v", configSettingNames)
+		}
+		names[f.Name] = true
+	}
+	for _, name := range []string{"config", "v", "logtostderr", "test.v"} {
+		if names[name] {
+			t.Errorf("%s must not be a setting", name)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeTestConfig(t, path, `{"logtostderr": true}`)
+	if err := newConfig(path).Load(); err == nil {
+		t.Errorf("expected error for logtostderr")
+	}
+}
+
+func TestConfig_LoadInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	for _, content := range []string{
+		`{"no_such_flag": "1"}`,
+		`{"backup_interval": "1h", "server_output_line_limit": "many"}`,
+		`{"backup_interval": "1h", "backup_schedules": [{"cron": "0 25 * * *"}]}`,
+		`{"backup_interval": "1h", "backup_schedules": [{"cron": "0 * * * *", "type": "../x"}]}`,
+		`{"backup_interval": "1h", "backup_schedules": {"cron": "0 * * * *"}}`,
+		`{"backup_interval": "1h", "backup_retention": {"periodic": {}}}`,
+		`{"backup_interval": "1h", "backup_retention": {"Periodic": {"daily": "7d"}}}`,
+	} {
+		writeTestConfig(t, path, content)
+		if err := newConfig(path).Load(); err == nil {
+			t.Errorf("expected error for %s", content)
+		}
+		if *autoBackupInterval != time.Minute*30 {
+			t.Errorf("invalid config partially applied")
+		}
+	}
+}
+
+func TestConfig_Missing(t *testing.T) {
+	c := newConfig(filepath.Join(t.TempDir(), "config.json"))
+	if err := c.Load(); err != nil {
+		t.Errorf("expecting nil, got %v", err)
+	}
+}
+
+func TestConfig_ReloadAndShow(t *testing.T) {
+	st := newSvrMgrTest(t)
+	defer st.close(t)
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeTestConfig(t, path, `{"backup_interval": "1h", "restart_policy": "never", "aliases": {"ping": "server list"}}`)
+	st.sm.config.path = path
+	// Flags set by other tests are not command line flags.
+	st.sm.config.cmdLine = map[string]bool{}
+
+	st.spMock.EXPECT().IsRunning().Return(true)
+	st.spMock.EXPECT().SendInput("list")
+	st.spMock.EXPECT().Stop(gomock.Any(), gomock.Any())
+
+	st.PushCommandAsync("config reload")
+	st.PushCommandAsync("config show backup_interval aliases")
+	st.PushCommandAsync("ping")
+	st.PushCommandAsync("quit")
+
+	err := st.sm.Process(context.Background(), []string{})
+	if err != nil {
+		t.Errorf("expecting nil, got %v", err)
+	}
+	out := st.stdoutLog.String()
+	for _, exp := range []string{
+		"backup interval set to 1h0m0s",
+		"restart policy set to never",
+		"config reloaded",
+		"backup_interval = 1h0m0s (config file)",
+		"ping = server list (config file)",
+		"bs = backup save (default)",
+	} {
+		if !strings.Contains(out, exp) {
+			t.Errorf("expected: %s, Got: %v", exp, out)
+		}
+	}
+}
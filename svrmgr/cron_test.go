@@ -0,0 +1,49 @@
+package svrmgr
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	for _, expr := range []string{"* * * * *", "0 */2 * * *", "30 3 * * *", "0,30 8-18/2 1,15 * 1-5", "5/15 * * 1-12 7"} {
+		if _, err := parseCron(expr); err != nil {
+			t.Errorf("%s: unexpected error %v", expr, err)
+		}
+	}
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("%s: expected error", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// Saturday.
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		expr string
+		exp  time.Time
+	}{
+		{"* * * * *", time.Date(2021, 1, 2, 3, 5, 0, 0, time.UTC)},
+		{"0 */2 * * *", time.Date(2021, 1, 2, 4, 0, 0, 0, time.UTC)},
+		{"30 3 * * *", time.Date(2021, 1, 2, 3, 30, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2021, 1, 3, 3, 0, 0, 0, time.UTC)},
+		{"0 0 * * 1", time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2021, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC)},
+		// Either day of month or day of week.
+		{"0 0 15 * 1", time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC)},
+		{"0 12 29 2 *", time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tc := range tests {
+		c, err := parseCron(tc.expr)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", tc.expr, err)
+		}
+		if next := c.Next(now); !next.Equal(tc.exp) {
+			t.Errorf("%s: expected %v, got %v", tc.expr, tc.exp, next)
+		}
+	}
+}
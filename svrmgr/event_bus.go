@@ -0,0 +1,165 @@
+package svrmgr
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// EventType identifies the kind of the event.
+type EventType string
+
+const (
+	// EventServerStarted - server started and is ready for players.
+	EventServerStarted EventType = "server_started"
+	// EventServerStopped - server exited with success or was stopped by the manager.
+	EventServerStopped EventType = "server_stopped"
+	// EventServerCrashed - server exited with failure without being asked to.
+	EventServerCrashed EventType = "server_crashed"
+	// EventServerOutput - a line of the server output.
+	EventServerOutput EventType = "server_output"
+	// EventPlayerJoined - player connected to the server.
+	EventPlayerJoined EventType = "player_joined"
+	// EventPlayerLeft - player disconnected from the server.
+	EventPlayerLeft EventType = "player_left"
+	// EventBackupStarted - backup started.
+	EventBackupStarted EventType = "backup_started"
+	// EventBackupFinished - backup completed, or skipped because nothing changed.
+	EventBackupFinished EventType = "backup_finished"
+	// EventBackupFailed - backup failed.
+	EventBackupFailed EventType = "backup_failed"
+)
+
+// defaultSubscriptionBuffer is the channel buffer size for the subscriptions.
+const defaultSubscriptionBuffer = 256
+
+// Event is published on the event bus.
+// Only the payload matching the event type is set.
+type Event struct {
+	Type EventType
+	Time time.Time
+	// Line is set for EventServerOutput.
+	Line *LogLine
+	// Exit is set for EventServerStopped and EventServerCrashed.
+	Exit *ServerExit
+	// Player is set for EventPlayerJoined and EventPlayerLeft.
+	Player *Player
+	// Backup is set for the backup events.
+	Backup *BackupEvent
+}
+
+// BackupEvent describes the backup for the backup events.
+type BackupEvent struct {
+	Type        backupType
+	Description string
+	Branch      string // Backup branch. Empty if the backup was skipped or failed.
+	Skipped     bool   // True if there was nothing to back up.
+	Err         error  // Set for EventBackupFailed.
+}
+
+// EventBus delivers the published events to all the subscribers.
+// Safe for concurrent use.
+type EventBus struct {
+	lock sync.Mutex
+	subs map[*Subscription]bool
+}
+
+// Subscription receives the subscribed events in the order they were published.
+type Subscription struct {
+	// C receives the events. It is never closed; use Done to detect Unsubscribe.
+	C     <-chan Event
+	ch    chan Event
+	types map[EventType]bool // Subscribed types. All types if empty.
+	bus   *EventBus
+	done  chan struct{}
+	once  sync.Once
+	// Number of server output events dropped because the buffer was full. Accessed atomically.
+	dropped int64
+}
+
+// NewEventBus creates an event bus.
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subs: map[*Subscription]bool{},
+	}
+}
+
+// Subscribe subscribes to the given event types, or to all events if none is given.
+// Events are buffered up to size. EventServerOutput events are dropped while the
+// buffer is full, so a slow subscriber does not stall the server output; see Dropped.
+// For the other events Publish blocks while the buffer is full, so the subscriber
+// must keep reading until it unsubscribes.
+func (b *EventBus) Subscribe(size int, types ...EventType) *Subscription {
+	ch := make(chan Event, size)
+	s := &Subscription{
+		C:     ch,
+		ch:    ch,
+		types: map[EventType]bool{},
+		bus:   b,
+		done:  make(chan struct{}),
+	}
+	for _, t := range types {
+		s.types[t] = true
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.subs[s] = true
+	return s
+}
+
+// Publish delivers the event to the subscribers of its type.
+// Time is set if not already set.
+func (b *EventBus) Publish(ev Event) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+
+	b.lock.Lock()
+	var subs []*Subscription
+	for s := range b.subs {
+		if len(s.types) == 0 || s.types[ev.Type] {
+			subs = append(subs, s)
+		}
+	}
+	b.lock.Unlock()
+
+	for _, s := range subs {
+		if ev.Type == EventServerOutput {
+			select {
+			case s.ch <- ev:
+			default:
+				if atomic.AddInt64(&s.dropped, 1) == 1 {
+					glog.Warningf("event subscriber is not keeping up. dropping server output")
+				}
+			}
+			continue
+		}
+		select {
+		case s.ch <- ev:
+		case <-s.done:
+		}
+	}
+}
+
+// Unsubscribe stops the delivery of the events. Safe to call more than once.
+func (s *Subscription) Unsubscribe() {
+	s.once.Do(func() {
+		s.bus.lock.Lock()
+		delete(s.bus.subs, s)
+		s.bus.lock.Unlock()
+		close(s.done)
+	})
+}
+
+// Dropped returns the number of server output events dropped because the buffer was full.
+func (s *Subscription) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
+
+// Done is closed when the subscription is cancelled.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
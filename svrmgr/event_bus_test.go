@@ -0,0 +1,155 @@
+package svrmgr
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// nextEvent returns the next event or fails the test after a timeout.
+func nextEvent(t *testing.T, sub *Subscription) Event {
+	select {
+	case ev := <-sub.C:
+		return ev
+	case <-time.After(time.Second * 10):
+		t.Fatalf("timed out waiting for event")
+	}
+	return Event{}
+}
+
+func TestEventBus_Subscribers(t *testing.T) {
+	bus := NewEventBus()
+	all := bus.Subscribe(10)
+	output := bus.Subscribe(10, EventServerOutput)
+	players := bus.Subscribe(10, EventPlayerJoined, EventPlayerLeft)
+
+	bus.Publish(Event{Type: EventServerOutput, Line: &LogLine{Line: "first"}})
+	bus.Publish(Event{Type: EventPlayerJoined, Player: &Player{Name: "Steve"}})
+	bus.Publish(Event{Type: EventServerOutput, Line: &LogLine{Line: "second"}})
+
+	for _, exp := range []EventType{EventServerOutput, EventPlayerJoined, EventServerOutput} {
+		if ev := nextEvent(t, all); ev.Type != exp || ev.Time.IsZero() {
+			t.Errorf("expected %s, got %v", exp, ev)
+		}
+	}
+	if ev := nextEvent(t, output); ev.Line.Line != "first" {
+		t.Errorf("unexpected event %v", ev)
+	}
+	if ev := nextEvent(t, output); ev.Line.Line != "second" {
+		t.Errorf("unexpected event %v", ev)
+	}
+	if ev := nextEvent(t, players); ev.Player.Name != "Steve" {
+		t.Errorf("unexpected event %v", ev)
+	}
+	if len(players.C) != 0 {
+		t.Errorf("unsubscribed events delivered")
+	}
+}
+
+func TestEventBus_Unsubscribe(t *testing.T) {
+	bus := NewEventBus()
+	sub := bus.Subscribe(1)
+	bus.Publish(Event{Type: EventServerStarted})
+
+	// Publish blocks while the buffer is full, until the subscriber unsubscribes.
+	published := make(chan struct{})
+	go func() {
+		bus.Publish(Event{Type: EventServerStopped})
+		close(published)
+	}()
+	select {
+	case <-published:
+		t.Fatalf("publish did not wait for the subscriber")
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	sub.Unsubscribe()
+	sub.Unsubscribe()
+	<-published
+	<-sub.Done()
+
+	bus.Publish(Event{Type: EventServerStarted})
+	if len(sub.C) != 1 {
+		t.Errorf("expected only the first event, got %d", len(sub.C))
+	}
+}
+
+func TestEventBus_DropsOutput(t *testing.T) {
+	bus := NewEventBus()
+	sub := bus.Subscribe(1)
+
+	// Server output is dropped instead of waiting for the slow subscriber.
+	published := make(chan struct{})
+	go func() {
+		for _, line := range []string{"first", "second", "third"} {
+			bus.Publish(Event{Type: EventServerOutput, Line: &LogLine{Line: line}})
+		}
+		close(published)
+	}()
+	select {
+	case <-published:
+	case <-time.After(time.Second * 10):
+		t.Fatalf("publish waited for the subscriber")
+	}
+	if sub.Dropped() != 2 {
+		t.Errorf("expected 2 dropped events, got %d", sub.Dropped())
+	}
+	if ev := nextEvent(t, sub); ev.Line.Line != "first" {
+		t.Errorf("unexpected event %v", ev)
+	}
+
+	bus.Publish(Event{Type: EventServerOutput, Line: &LogLine{Line: "fourth"}})
+	if ev := nextEvent(t, sub); ev.Line.Line != "fourth" || sub.Dropped() != 2 {
+		t.Errorf("unexpected event %v, dropped %d", ev, sub.Dropped())
+	}
+}
+
+func TestProcess_MultipleOutputReaders(t *testing.T) {
+	sm, out := newRealProcessTest(t)
+	ctx := context.Background()
+	lifecycle := sm.Events().Subscribe(10, EventServerStarted, EventServerStopped, EventServerCrashed)
+	defer lifecycle.Unsubscribe()
+
+	if err := sm.RunCommand(ctx, "start"); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	if ev := nextEvent(t, lifecycle); ev.Type != EventServerStarted {
+		t.Errorf("expected %s, got %v", EventServerStarted, ev)
+	}
+
+	proc := sm.GetServerProcess()
+	ch1, ch2 := make(chan string), make(chan string)
+	proc.StartReadOutput(ch1)
+	proc.StartReadOutput(ch2)
+	if err := sm.RunCommand(ctx, "server foo"); err != nil {
+		t.Errorf("expecting nil, got %v", err)
+	}
+	for i, ch := range []chan string{ch1, ch2} {
+		found := false
+		for l := range ch {
+			if found = strings.Contains(l, `Unknown command: "foo"`); found {
+				break
+			}
+		}
+		if !found {
+			t.Errorf("reader %d did not receive the output", i+1)
+		}
+	}
+
+	// Ended reader is closed while the other keeps reading until the server exits.
+	proc.EndReadOutput(ch1)
+	if _, ok := <-ch1; ok {
+		t.Errorf("reader not closed")
+	}
+	sm.RunCommand(ctx, "stop")
+	for range ch2 {
+	}
+	proc.EndReadOutput(ch2)
+
+	ev := nextEvent(t, lifecycle)
+	if ev.Type != EventServerStopped || ev.Exit == nil || !ev.Exit.Intentional {
+		t.Errorf("expected %s, got %v", EventServerStopped, ev)
+	}
+	waitForOutput(t, out, "server exited with success")
+}
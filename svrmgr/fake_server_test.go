@@ -0,0 +1,170 @@
+package svrmgr
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The test binary acts as the fake bedrock server when fakeServerEnv is set.
+// Tests script the fake server through the following environment variables,
+// which are inherited by the server process.
+const (
+	// fakeServerEnv is set when the test binary is started as the fake bedrock server.
+	fakeServerEnv = "BEDROCK_FAKE_SERVER"
+	// fakeServerStartupDelayEnv delays the startup messages by the given duration.
+	fakeServerStartupDelayEnv = "BEDROCK_FAKE_STARTUP_DELAY"
+	// fakeServerFailStartupEnv makes the server exit with failure before it is started.
+	fakeServerFailStartupEnv = "BEDROCK_FAKE_FAIL_STARTUP"
+	// fakeServerIgnoreStopEnv makes the server ignore the stop command.
+	fakeServerIgnoreStopEnv = "BEDROCK_FAKE_IGNORE_STOP"
+	// fakeServerSavePendingEnv is the number of `save query` calls that report the save is not complete.
+	fakeServerSavePendingEnv = "BEDROCK_FAKE_SAVE_PENDING"
+	// fakeServerWorldEnv is the world directory reported by `save query`.
+	fakeServerWorldEnv = "BEDROCK_FAKE_WORLD"
+)
+
+// fakeServerWriteTail is appended to the world database files after `save query`
+// to emulate the server writing past the reported lengths.
+const fakeServerWriteTail = "-partially-written"
+
+// TestMain runs the tests. When started as the bedrock server by the tests,
+// the test binary emulates the bedrock server console instead.
+func TestMain(m *testing.M) {
+	if os.Getenv(fakeServerEnv) == "1" {
+		os.Exit(runFakeServer(os.Stdin, os.Stdout))
+	}
+
+	exe, err := filepath.Abs(os.Args[0])
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv(fakeServerEnv, "1")
+	*bedrockServerExecutable = exe
+	os.Exit(m.Run())
+}
+
+// fakeServer emulates the bedrock server console protocol.
+type fakeServer struct {
+	stdout      io.Writer
+	holding     bool // True between `save hold` and `save resume`.
+	savePending int  // Remaining `save query` calls before the save completes.
+}
+
+// runFakeServer runs the fake bedrock server and returns the exit code.
+// Commands must be terminated by the platform new line.
+func runFakeServer(stdin io.Reader, stdout io.Writer) int {
+	s := &fakeServer{stdout: stdout}
+
+	s.println("[INFO] Starting Server")
+	if d, err := time.ParseDuration(os.Getenv(fakeServerStartupDelayEnv)); err == nil {
+		time.Sleep(d)
+	}
+	if os.Getenv(fakeServerFailStartupEnv) == "1" {
+		s.println("[ERROR] Failed to load the world")
+		return 1
+	}
+	s.println("[INFO] IPv6 supported, port: 19133")
+	s.println("[INFO] IPv6 supported, port: 19133")
+	s.println("[INFO] Server started.")
+
+	reader := bufio.NewReader(stdin)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return 1
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if runtime.GOOS == "windows" {
+			line = strings.TrimSuffix(line, "\r")
+		}
+
+		if code, exit := s.handle(line); exit {
+			return code
+		}
+	}
+}
+
+// handle handles a single command. Returns true along with the exit code if the server must exit.
+func (s *fakeServer) handle(line string) (int, bool) {
+	switch line {
+	case "stop":
+		s.println("[INFO] Server stop requested.")
+		if os.Getenv(fakeServerIgnoreStopEnv) == "1" {
+			return 0, false
+		}
+		s.println("[INFO] Stopping server...")
+		s.println("Quit correctly")
+		return 0, true
+	case "crash":
+		s.println("[ERROR] Crashing as requested")
+		return 3, true
+	case "list":
+		s.println("[INFO] There are 0/10 players online:")
+		s.println("")
+	case "save hold":
+		if s.holding {
+			s.println("[INFO] The command is already running")
+			break
+		}
+		s.holding = true
+		s.savePending, _ = strconv.Atoi(os.Getenv(fakeServerSavePendingEnv))
+		s.println("[INFO] Saving...")
+	case "save query":
+		if !s.holding || s.savePending > 0 {
+			s.savePending--
+			s.println("[INFO] A previous save has not been completed.")
+			break
+		}
+		s.println(backupSaveCompletedMarker + ".")
+		s.println(s.fileList())
+	case "save resume":
+		s.holding = false
+		s.println("[INFO] Changes to the level are resumed.")
+	default:
+		s.println(fmt.Sprintf("[INFO] Unknown command: %q. Please check that the command exists and that you have permission to use it.", line))
+	}
+	return 0, false
+}
+
+// fileList returns the `save query` file list for the world and then keeps
+// writing to the database files.
+func (s *fakeServer) fileList() string {
+	world := os.Getenv(fakeServerWorldEnv)
+	if world == "" {
+		return "world/level.dat:0"
+	}
+
+	var entries []string
+	var dbFiles []string
+	filepath.Walk(world, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(filepath.Dir(world), path)
+		entries = append(entries, fmt.Sprintf("%s:%d", filepath.ToSlash(rel), info.Size()))
+		if filepath.Base(filepath.Dir(path)) == "db" {
+			dbFiles = append(dbFiles, path)
+		}
+		return nil
+	})
+
+	for _, f := range dbFiles {
+		if fh, err := os.OpenFile(f, os.O_APPEND|os.O_WRONLY, 0644); err == nil {
+			io.WriteString(fh, fakeServerWriteTail)
+			fh.Close()
+		}
+	}
+	return strings.Join(entries, ", ")
+}
+
+func (s *fakeServer) println(line string) {
+	fmt.Fprintln(s.stdout, line)
+}
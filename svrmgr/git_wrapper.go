@@ -4,19 +4,26 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
+	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/fieryorc/BedrockServerManager/winutils"
 	"github.com/golang/glog"
 )
 
 //go:generate mockgen -package svrmgr -source=git_wrapper.go -destination=git_wrapper_mocks_test.go
 
-var gitExecutable = flag.String("git_exe", "git.exe", "path to the git executable (if git.exe is not in the PATH)")
+var gitExecutable = flag.String("git_exe", defaultGitExecutable, "path to the git executable (if git is not in the PATH)")
 var gitDryRun = flag.Bool("git_dry_run", false, "if specified, git update operations will not be performed")
 var commandTimeout = flag.Duration("git_command_timeout", time.Second*30, "Time to wait for git command to complete")
+var gcTimeout = flag.Duration("git_gc_timeout", time.Minute*30, "time to wait for git garbage collection and fsck to complete")
+var longCommandTimeout = flag.Duration("git_long_command_timeout", time.Minute*30, "time to wait for the git commands that read or copy the whole backup history, such as backup stats, export, sync and extract")
 
 // gitWrapper provides git functionality.
 type gitWrapper struct {
@@ -35,13 +42,14 @@ const (
 
 // GitReference type.
 type GitReference struct {
-	Ref                string
-	Type               GitReferenceType
-	IsHead             bool   // True if this is current head
-	Hash               string // Commit hash
-	Subject            string // Current commit subject line
-	CommitDate         time.Time
-	CommitDateRelative string
+	Ref                string           `json:"ref"`
+	Type               GitReferenceType `json:"type"`
+	IsHead             bool             `json:"is_head"` // True if this is current head
+	Hash               string           `json:"hash"`    // Commit hash
+	Subject            string           `json:"subject"` // Current commit subject line
+	CommitDate         time.Time        `json:"commit_date"`
+	CommitDateRelative string           `json:"commit_date_relative"`
+	Pinned             bool             `json:"pinned"` // True if the backup is protected from deletion
 }
 
 func (gr GitReference) String() string {
@@ -49,17 +57,107 @@ func (gr GitReference) String() string {
 	if gr.IsHead {
 		active = "*"
 	}
-	return fmt.Sprintf("%s %s %s %s (%s)", active, gr.Ref, gr.Hash, gr.Subject, gr.CommitDateRelative)
+	pinned := ""
+	if gr.Pinned {
+		pinned = " [pinned]"
+	}
+	return fmt.Sprintf("%s %s %s %s (%s)%s", active, gr.Ref, gr.Hash, gr.Subject, gr.CommitDateRelative, pinned)
 }
 
+// pinTagPrefix is the prefix of the tags that pin the backups.
+// Backup saves/manual/X is pinned by tag pinned/saves/manual/X.
+const pinTagPrefix = "pinned/"
+
 // GitWrapper provides wrapper for git.
 type GitWrapper interface {
 	RunGitCommand(ctx context.Context, args ...string) (string, error)
 	IsDirClean(ctx context.Context) (bool, error)
-	DeleteBranches(ctx context.Context, provider Provider, refs []GitReference) error
+	// ExcludePaths adds the paths inside the workspace to the git excludes, so they are not backed up.
+	ExcludePaths(ctx context.Context, paths []string) error
+	// GitPath returns the absolute path of the file in the git directory, such as info/exclude.
+	GitPath(ctx context.Context, name string) (string, error)
+	// DeleteBranches deletes the branches. Pinned branches are deleted only if force is set.
+	// Returns the deleted branches.
+	DeleteBranches(ctx context.Context, provider Provider, refs []GitReference, force bool) ([]GitReference, error)
+	// PinBranch protects the branch from deletion.
+	PinBranch(ctx context.Context, provider Provider, ref GitReference) error
+	// UnpinBranch removes the protection from the branch.
+	UnpinBranch(ctx context.Context, provider Provider, ref GitReference) error
 	GetCurrentHead(context.Context) (GitReference, error)
 	Checkout(context.Context, GitReference) error
 	ListBranches(ctx context.Context, provider Provider, filters []string) ([]GitReference, error)
+	StageSavedFiles(ctx context.Context, worldsDir string, files []savedFile) error
+	// CountObjects returns the object database statistics.
+	CountObjects(ctx context.Context) (GitObjectStats, error)
+	// CollectGarbage expires the reflog and removes the unreachable objects.
+	CollectGarbage(ctx context.Context, provider Provider) error
+	// Fsck verifies the integrity of the repository.
+	Fsck(ctx context.Context) error
+	// UniqueSizes returns the disk space used by the objects reachable from only one of the refs,
+	// by the short ref name. Refs pointing at the same commit share the objects.
+	// Lists the objects of every commit, so the cost grows with the number of backups times the world size.
+	UniqueSizes(ctx context.Context) (map[string]int64, error)
+	// DiffFiles returns the files changed between the refs.
+	// If to is empty, from is compared with the working tree, including the untracked files.
+	DiffFiles(ctx context.Context, from, to string) ([]FileChange, error)
+	// DiffText returns the textual diff of the paths between the refs.
+	// If to is empty, from is compared with the working tree.
+	DiffText(ctx context.Context, from, to string, paths []string) (string, error)
+	// Archive writes the zip archive of the paths in the tree to the output file.
+	// All files in the tree are archived if paths is empty.
+	Archive(ctx context.Context, treeish string, paths []string, output string) error
+	// ListRefs returns the hashes of the refs starting with any of the prefixes, by the full ref name.
+	// If remote is empty, the local refs are listed.
+	ListRefs(ctx context.Context, remote string, prefixes ...string) (map[string]string, error)
+	// PushRefs pushes the refspecs to the remote. Refs that would overwrite
+	// different commits on the remote are rejected and reported in the error.
+	PushRefs(ctx context.Context, provider Provider, remote string, refspecs []string) error
+	// AddWorktree checks out the ref into the directory, without changing the workspace.
+	AddWorktree(ctx context.Context, provider Provider, dir, ref string) error
+	// ListWorktrees returns the worktrees other than the workspace.
+	ListWorktrees(ctx context.Context) ([]GitWorktree, error)
+	// RemoveWorktree deletes the worktree directory. Modified worktrees are removed only if force is set.
+	RemoveWorktree(ctx context.Context, provider Provider, dir string, force bool) error
+}
+
+// GitWorktree is a directory the backup is extracted to.
+type GitWorktree struct {
+	Path   string `json:"path"`
+	Hash   string `json:"hash"`
+	Backup string `json:"backup"` // Backup checked out in the worktree. Empty if not known.
+}
+
+// FileChange is a file changed between two backups.
+type FileChange struct {
+	Path    string `json:"path"`
+	Status  string `json:"status"`  // A for added, D for deleted, M for modified, T for type changed.
+	Added   int    `json:"added"`   // Lines added. 0 for binary and untracked files.
+	Deleted int    `json:"deleted"` // Lines deleted. 0 for binary and untracked files.
+	Binary  bool   `json:"binary"`
+	OldSize int64  `json:"old_size"` // Size in bytes. 0 if added.
+	NewSize int64  `json:"new_size"` // Size in bytes. 0 if deleted.
+}
+
+// SizeDelta returns the change in size in bytes.
+func (fc FileChange) SizeDelta() int64 {
+	return fc.NewSize - fc.OldSize
+}
+
+// GitObjectStats is the output of `git count-objects -v`.
+type GitObjectStats struct {
+	Count         int64 `json:"count"`          // Number of loose objects.
+	Size          int64 `json:"size"`           // Disk space used by the loose objects in bytes.
+	InPack        int64 `json:"in_pack"`        // Number of packed objects.
+	Packs         int64 `json:"packs"`          // Number of packs.
+	SizePack      int64 `json:"size_pack"`      // Disk space used by the packs in bytes.
+	PrunePackable int64 `json:"prune_packable"` // Number of loose objects that are also packed.
+	Garbage       int64 `json:"garbage"`        // Number of garbage files.
+	SizeGarbage   int64 `json:"size_garbage"`   // Disk space used by the garbage files in bytes.
+}
+
+// TotalSize returns the disk space used by the object database in bytes.
+func (s GitObjectStats) TotalSize() int64 {
+	return s.Size + s.SizePack + s.SizeGarbage
 }
 
 // newGitWrapper returns new instance of git wrapper.
@@ -83,9 +181,18 @@ func newGitWrapper(wsDir string) *gitWrapper {
 // RunGitCommand runs git command and returs the results.
 // Output is not printed to the console.
 func (gw *gitWrapper) RunGitCommand(ctx context.Context, args ...string) (string, error) {
-	ctxTimeout, _ := context.WithTimeout(ctx, *commandTimeout)
+	return gw.runGitCommand(ctx, *commandTimeout, "", args...)
+}
+
+// runGitCommand runs git command with the given timeout. stdin is passed to the command if not empty.
+func (gw *gitWrapper) runGitCommand(ctx context.Context, timeout time.Duration, stdin string, args ...string) (string, error) {
+	ctxTimeout, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 	cmd := exec.CommandContext(ctxTimeout, gw.exe, args...)
 	cmd.Dir = gw.wsDir
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
 
 	glog.Infof("running %s %s", cmd.Path, strings.Join(cmd.Args, " "))
 	out, err := cmd.CombinedOutput()
@@ -117,6 +224,82 @@ func (gw *gitWrapper) IsDirClean(ctx context.Context) (bool, error) {
 	return strings.Contains(out, "nothing to commit, working tree clean"), nil
 }
 
+func (gw *gitWrapper) GitPath(ctx context.Context, name string) (string, error) {
+	out, err := gw.RunGitCommand(ctx, "rev-parse", "--git-path", name)
+	if err != nil {
+		return "", err
+	}
+	p := filepath.FromSlash(strings.TrimSpace(out))
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(gw.wsDir, p)
+	}
+	return p, nil
+}
+
+// ExcludePaths adds the paths to .git/info/exclude. Paths outside the workspace are ignored.
+// Files already committed stay in the existing backups.
+func (gw *gitWrapper) ExcludePaths(ctx context.Context, paths []string) error {
+	root, err := gw.RunGitCommand(ctx, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return err
+	}
+	root = filepath.FromSlash(strings.TrimSpace(root))
+	excludeFile, err := gw.GitPath(ctx, "info/exclude")
+	if err != nil {
+		return err
+	}
+
+	existing, err := os.ReadFile(excludeFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	patterns := map[string]bool{}
+	for _, l := range strings.Split(string(existing), "\n") {
+		patterns[strings.TrimSpace(l)] = true
+	}
+	var add []string
+	for _, p := range paths {
+		p, err := filepath.Abs(p)
+		if err != nil {
+			return err
+		}
+		// The path may not exist yet. git reports the workspace with the symlinks resolved.
+		if dir, err := filepath.EvalSymlinks(filepath.Dir(p)); err == nil {
+			p = filepath.Join(dir, filepath.Base(p))
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		pattern := "/" + filepath.ToSlash(rel)
+		if !patterns[pattern] {
+			patterns[pattern] = true
+			add = append(add, pattern)
+		}
+	}
+	if len(add) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(excludeFile), 0755); err != nil {
+		return err
+	}
+	content := strings.Join(add, "\n") + "\n"
+	if len(existing) > 0 && !strings.HasSuffix(string(existing), "\n") {
+		content = "\n" + content
+	}
+	f, err := os.OpenFile(excludeFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return err
+	}
+	glog.Infof("excluded %v from the backups", add)
+	return f.Close()
+}
+
 func (gw *gitWrapper) GetCurrentHead(ctx context.Context) (GitReference, error) {
 	cmdArgs := []string{
 		"rev-parse",
@@ -185,32 +368,96 @@ func (gw *gitWrapper) ListBranches(ctx context.Context, provider Provider, filte
 		})
 	}
 
+	if len(result) == 0 {
+		return result, nil
+	}
+	pins, err := gw.listPins(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range result {
+		result[i].Pinned = pins[result[i].Ref]
+	}
 	return result, nil
 }
 
-func (gw *gitWrapper) DeleteBranches(ctx context.Context, provider Provider, branches []GitReference) error {
+// listPins returns the pinned branch names.
+func (gw *gitWrapper) listPins(ctx context.Context) (map[string]bool, error) {
+	out, err := gw.RunGitCommand(ctx, "tag", "--list", pinTagPrefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	pins := map[string]bool{}
+	for _, l := range strings.Split(out, "\n") {
+		if l = strings.Trim(l, "\r\n\t "); l != "" {
+			pins[strings.TrimPrefix(l, pinTagPrefix)] = true
+		}
+	}
+	return pins, nil
+}
+
+func (gw *gitWrapper) PinBranch(ctx context.Context, provider Provider, ref GitReference) error {
+	if *gitDryRun {
+		provider.Log("*** dry run only. pin not performed ****")
+		return nil
+	}
+	if out, err := gw.RunGitCommand(ctx, "tag", pinTagPrefix+ref.Ref, ref.Ref); err != nil {
+		provider.Log(fmt.Sprintf("git tag failed. %s", out))
+		return err
+	}
+	return nil
+}
+
+func (gw *gitWrapper) UnpinBranch(ctx context.Context, provider Provider, ref GitReference) error {
+	if *gitDryRun {
+		provider.Log("*** dry run only. unpin not performed ****")
+		return nil
+	}
+	if out, err := gw.RunGitCommand(ctx, "tag", "-d", pinTagPrefix+ref.Ref); err != nil {
+		provider.Log(fmt.Sprintf("git tag -d failed. %s", out))
+		return err
+	}
+	return nil
+}
+
+func (gw *gitWrapper) DeleteBranches(ctx context.Context, provider Provider, branches []GitReference, force bool) ([]GitReference, error) {
 	var err error
 	if len(branches) == 0 {
-		return fmt.Errorf("must specify at least one branch to delete")
+		return nil, invalidArgsErrorf("must specify at least one branch to delete")
 	}
 
 	// Print warning if deleting active branch.
 	var logs []string
 	var branchList []string
+	var pinList []string
+	var deleted []GitReference
 	for _, b := range branches {
 		if b.IsHead {
 			if len(branches) == 1 {
-				return fmt.Errorf("active backup %s cannot be deleted", b.Ref)
+				return nil, conflictErrorf("active backup %s cannot be deleted", b.Ref)
 			} else {
 				provider.Log(fmt.Sprintf("active branch '%s' cannot be deleted", b.Ref))
 			}
+		} else if b.Pinned && !force {
+			if len(branches) == 1 {
+				return nil, conflictErrorf("backup %s is pinned. run 'backup unpin' or use --force to delete it", b.Ref)
+			}
+			provider.Log(fmt.Sprintf("pinned backup '%s' cannot be deleted", b.Ref))
 		} else {
 			logs = append(logs, b.String())
 			branchList = append(branchList, b.Ref)
+			deleted = append(deleted, b)
+			if b.Pinned {
+				pinList = append(pinList, pinTagPrefix+b.Ref)
+			}
 		}
 	}
+	if len(branchList) == 0 {
+		provider.Log("nothing to delete")
+		return nil, nil
+	}
 
-	provider.Log(fmt.Sprintf("deleting the following backups:\r\n%s", strings.Join(logs, "\r\n")))
+	provider.Log(fmt.Sprintf("deleting the following backups:%s%s", winutils.NewLine(), strings.Join(logs, winutils.NewLine())))
 	cmdArgs := []string{
 		"branch",
 		"-D",
@@ -218,15 +465,498 @@ func (gw *gitWrapper) DeleteBranches(ctx context.Context, provider Provider, bra
 
 	if *gitDryRun {
 		provider.Log("*** dry run only. deletion not performed ****")
-		return nil
+		return nil, nil
 	}
 
 	cmdArgs = append(cmdArgs, branchList...)
 	out, err := gw.RunGitCommand(ctx, cmdArgs...)
 	if err != nil {
 		provider.Log(fmt.Sprintf("git branch -D failed. %s", out))
+		return nil, err
+	}
+
+	if len(pinList) > 0 {
+		out, err = gw.RunGitCommand(ctx, append([]string{"tag", "-d"}, pinList...)...)
+		if err != nil {
+			provider.Log(fmt.Sprintf("git tag -d failed. %s", out))
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// StageSavedFiles replaces the staged world contents with the given files, truncated to
+// their reported lengths. Files of the same worlds that are not listed are removed from the index.
+// The files are first copied to a staging directory so that the live files are not modified.
+func (gw *gitWrapper) StageSavedFiles(ctx context.Context, worldsDir string, files []savedFile) error {
+	stagingDir, err := os.MkdirTemp("", "bedrock-save-")
+	if err != nil {
+		return fmt.Errorf("unable to create staging directory. %v", err)
+	}
+	defer os.RemoveAll(stagingDir)
+
+	relWorldsDir, err := filepath.Rel(gw.wsDir, worldsDir)
+	if err != nil || strings.HasPrefix(relWorldsDir, "..") {
+		return fmt.Errorf("worlds directory %s is not inside the git workspace %s", worldsDir, gw.wsDir)
+	}
+
+	var pathSpecs []string
+	levels := map[string]bool{}
+	for _, f := range files {
+		relPath := filepath.Join(relWorldsDir, filepath.FromSlash(f.Path))
+		if err = copyTruncated(filepath.Join(gw.wsDir, relPath), filepath.Join(stagingDir, relPath), f.Length); err != nil {
+			return err
+		}
+
+		level := strings.SplitN(filepath.ToSlash(f.Path), "/", 2)[0]
+		if !levels[level] {
+			levels[level] = true
+			pathSpecs = append(pathSpecs, filepath.ToSlash(filepath.Join(relWorldsDir, level)))
+		}
+	}
+
+	cmdArgs := []string{
+		"--work-tree=" + stagingDir,
+		"add",
+		"-A",
+		"--",
+	}
+	cmdArgs = append(cmdArgs, pathSpecs...)
+	out, err := gw.RunGitCommand(ctx, cmdArgs...)
+	if err != nil {
+		glog.Infof("staging saved files failed. %s", out)
 		return err
 	}
+	return nil
+}
 
+// copyTruncated copies the first length bytes of src to dst.
+func copyTruncated(src, dst string, length int64) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("unable to open %s. %v", src, err)
+	}
+	defer in.Close()
+
+	if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("unable to create directory for %s. %v", dst, err)
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("unable to create %s. %v", dst, err)
+	}
+	defer out.Close()
+
+	if _, err = io.CopyN(out, in, length); err != nil {
+		return fmt.Errorf("unable to copy %d bytes of %s. %v", length, src, err)
+	}
+	return nil
+}
+
+func (gw *gitWrapper) CountObjects(ctx context.Context) (GitObjectStats, error) {
+	out, err := gw.RunGitCommand(ctx, "count-objects", "-v")
+	if err != nil {
+		return GitObjectStats{}, err
+	}
+	return parseCountObjects(out)
+}
+
+// parseCountObjects parses the output of `git count-objects -v`.
+// Sizes are reported in KiB and converted to bytes.
+func parseCountObjects(out string) (GitObjectStats, error) {
+	var stats GitObjectStats
+	fields := map[string]*int64{
+		"count":          &stats.Count,
+		"size":           &stats.Size,
+		"in-pack":        &stats.InPack,
+		"packs":          &stats.Packs,
+		"size-pack":      &stats.SizePack,
+		"prune-packable": &stats.PrunePackable,
+		"garbage":        &stats.Garbage,
+		"size-garbage":   &stats.SizeGarbage,
+	}
+	for _, l := range strings.Split(out, "\n") {
+		parts := strings.SplitN(strings.TrimSpace(l), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		field, ok := fields[parts[0]]
+		if !ok {
+			continue
+		}
+		v, err := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64)
+		if err != nil {
+			return GitObjectStats{}, fmt.Errorf("unable to parse count-objects output '%s'", l)
+		}
+		*field = v
+	}
+	stats.Size *= 1024
+	stats.SizePack *= 1024
+	stats.SizeGarbage *= 1024
+	return stats, nil
+}
+
+func (gw *gitWrapper) CollectGarbage(ctx context.Context, provider Provider) error {
+	if *gitDryRun {
+		provider.Log("*** dry run only. garbage collection not performed ****")
+		return nil
+	}
+	for _, args := range [][]string{
+		{"reflog", "expire", "--all", "--expire-unreachable=now"},
+		{"gc", "--prune=now", "--quiet"},
+	} {
+		if out, err := gw.runGitCommand(ctx, *gcTimeout, "", args...); err != nil {
+			provider.Log(fmt.Sprintf("git %s failed. %s", args[0], out))
+			return err
+		}
+	}
+	return nil
+}
+
+func (gw *gitWrapper) Fsck(ctx context.Context) error {
+	out, err := gw.runGitCommand(ctx, *gcTimeout, "", "fsck", "--no-progress", "--no-dangling")
+	if err != nil {
+		return fmt.Errorf("git fsck failed. %s", strings.TrimSpace(out))
+	}
+	return nil
+}
+
+func (gw *gitWrapper) UniqueSizes(ctx context.Context) (map[string]int64, error) {
+	out, err := gw.RunGitCommand(ctx, "for-each-ref", "--format=%(objectname) %(refname:short)", "refs/heads", "refs/tags")
+	if err != nil {
+		return nil, err
+	}
+	refs := map[string][]string{} // Refs by commit.
+	for _, l := range strings.Split(out, "\n") {
+		parts := strings.Fields(l)
+		if len(parts) == 2 {
+			refs[parts[0]] = append(refs[parts[0]], parts[1])
+		}
+	}
+
+	// Find the objects reachable from only one commit.
+	owners := map[string]string{} // Commit of the object. Empty if reachable from several commits.
+	for commit := range refs {
+		out, err := gw.runGitCommand(ctx, *longCommandTimeout, "", "rev-list", "--objects", commit)
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range strings.Split(out, "\n") {
+			parts := strings.Fields(l)
+			if len(parts) == 0 {
+				continue
+			}
+			if owner, ok := owners[parts[0]]; ok && owner != commit {
+				owners[parts[0]] = ""
+			} else {
+				owners[parts[0]] = commit
+			}
+		}
+	}
+	var unique []string
+	for object, owner := range owners {
+		if owner != "" {
+			unique = append(unique, object)
+		}
+	}
+
+	sizes := map[string]int64{}
+	for _, rs := range refs {
+		for _, r := range rs {
+			sizes[r] = 0
+		}
+	}
+	if len(unique) == 0 {
+		return sizes, nil
+	}
+	out, err = gw.runGitCommand(ctx, *longCommandTimeout, strings.Join(unique, "\n")+"\n",
+		"cat-file", "--batch-check=%(objectname) %(objectsize:disk)")
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range strings.Split(out, "\n") {
+		parts := strings.Fields(l)
+		if len(parts) != 2 {
+			continue
+		}
+		size, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse cat-file output '%s'", l)
+		}
+		for _, r := range refs[owners[parts[0]]] {
+			sizes[r] += size
+		}
+	}
+	return sizes, nil
+}
+
+func (gw *gitWrapper) DiffFiles(ctx context.Context, from, to string) ([]FileChange, error) {
+	diffArgs := []string{"diff", "-z", "--no-renames", from}
+	if to != "" {
+		diffArgs = append(diffArgs, to)
+	}
+	diffArgs = append(diffArgs, "--")
+
+	// Raw output is ":OLD_MODE NEW_MODE OLD_HASH NEW_HASH STATUS\0PATH\0".
+	out, err := gw.RunGitCommand(ctx, append([]string{diffArgs[0], "--raw", "--no-abbrev"}, diffArgs[1:]...)...)
+	if err != nil {
+		return nil, err
+	}
+	var changes []*FileChange
+	byPath := map[string]*FileChange{}
+	hashes := map[string][]*int64{} // Size fields to fill in by object hash.
+	fields := strings.Split(out, "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		meta := strings.Fields(strings.TrimPrefix(fields[i], ":"))
+		if len(meta) != 5 {
+			return nil, fmt.Errorf("unable to parse git diff output '%s'", fields[i])
+		}
+		fc := &FileChange{Path: fields[i+1], Status: meta[4]}
+		changes = append(changes, fc)
+		byPath[fc.Path] = fc
+		if !isZeroHash(meta[2]) {
+			hashes[meta[2]] = append(hashes[meta[2]], &fc.OldSize)
+		}
+		if !isZeroHash(meta[3]) {
+			hashes[meta[3]] = append(hashes[meta[3]], &fc.NewSize)
+		} else if to == "" && fc.Status != "D" {
+			if fi, err := os.Stat(filepath.Join(gw.wsDir, fc.Path)); err == nil {
+				fc.NewSize = fi.Size()
+			}
+		}
+	}
+
+	// Numstat output is "ADDED\tDELETED\tPATH\0". Binary files have - for the line counts.
+	out, err = gw.RunGitCommand(ctx, append([]string{diffArgs[0], "--numstat"}, diffArgs[1:]...)...)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range strings.Split(out, "\x00") {
+		parts := strings.SplitN(l, "\t", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		fc, ok := byPath[parts[2]]
+		if !ok {
+			continue
+		}
+		if parts[0] == "-" {
+			fc.Binary = true
+			continue
+		}
+		fc.Added, _ = strconv.Atoi(parts[0])
+		fc.Deleted, _ = strconv.Atoi(parts[1])
+	}
+
+	if to == "" {
+		out, err = gw.RunGitCommand(ctx, "ls-files", "-z", "--others", "--exclude-standard")
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range strings.Split(out, "\x00") {
+			if path == "" {
+				continue
+			}
+			fc := &FileChange{Path: path, Status: "A"}
+			if fi, err := os.Stat(filepath.Join(gw.wsDir, path)); err == nil {
+				fc.NewSize = fi.Size()
+			}
+			changes = append(changes, fc)
+		}
+	}
+
+	if len(hashes) > 0 {
+		var input []string
+		for h := range hashes {
+			input = append(input, h)
+		}
+		out, err = gw.runGitCommand(ctx, *commandTimeout, strings.Join(input, "\n")+"\n",
+			"cat-file", "--batch-check=%(objectname) %(objectsize)")
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range strings.Split(out, "\n") {
+			parts := strings.Fields(l)
+			if len(parts) != 2 {
+				continue
+			}
+			size, err := strconv.ParseInt(parts[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse cat-file output '%s'", l)
+			}
+			for _, field := range hashes[parts[0]] {
+				*field = size
+			}
+		}
+	}
+
+	result := []FileChange{}
+	for _, fc := range changes {
+		result = append(result, *fc)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Path < result[j].Path
+	})
+	return result, nil
+}
+
+func (gw *gitWrapper) DiffText(ctx context.Context, from, to string, paths []string) (string, error) {
+	args := []string{"diff", "--no-renames", "--no-color", from}
+	if to != "" {
+		args = append(args, to)
+	}
+	args = append(args, "--")
+	args = append(args, paths...)
+	return gw.RunGitCommand(ctx, args...)
+}
+
+// isZeroHash returns true for the object hash git reports for missing and working tree files.
+func isZeroHash(hash string) bool {
+	return strings.Trim(hash, "0") == ""
+}
+
+func (gw *gitWrapper) Archive(ctx context.Context, treeish string, paths []string, output string) error {
+	args := []string{"archive", "--format=zip", "-o", output, treeish}
+	if len(paths) > 0 {
+		args = append(append(args, "--"), paths...)
+	}
+	if out, err := gw.runGitCommand(ctx, *longCommandTimeout, "", args...); err != nil {
+		return fmt.Errorf("git archive failed. %s", strings.TrimSpace(out))
+	}
+	return nil
+}
+
+func (gw *gitWrapper) ListRefs(ctx context.Context, remote string, prefixes ...string) (map[string]string, error) {
+	var out string
+	var err error
+	if remote == "" {
+		out, err = gw.RunGitCommand(ctx, append([]string{"for-each-ref", "--format=%(objectname)%09%(refname)"}, prefixes...)...)
+	} else {
+		out, err = gw.runGitCommand(ctx, *longCommandTimeout, "", "ls-remote", remote)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to list refs. %s", strings.TrimSpace(out))
+	}
+
+	refs := map[string]string{}
+	for _, l := range strings.Split(out, "\n") {
+		parts := strings.SplitN(strings.TrimSpace(l), "\t", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(parts[1], prefix) {
+				refs[parts[1]] = parts[0]
+				break
+			}
+		}
+	}
+	return refs, nil
+}
+
+// maxPushRefspecs limits the refspecs per push to keep the command line short.
+const maxPushRefspecs = 100
+
+func (gw *gitWrapper) PushRefs(ctx context.Context, provider Provider, remote string, refspecs []string) error {
+	if *gitDryRun {
+		provider.Log(fmt.Sprintf("*** dry run only. push to %s not performed ****", remote))
+		return nil
+	}
+	var rejected []string
+	for len(refspecs) > 0 {
+		n := len(refspecs)
+		if n > maxPushRefspecs {
+			n = maxPushRefspecs
+		}
+		args := append([]string{"push", "--porcelain", remote}, refspecs[:n]...)
+		out, err := gw.runGitCommand(ctx, *longCommandTimeout, "", args...)
+		if err != nil {
+			refs := parsePushRejected(out)
+			if len(refs) == 0 {
+				return fmt.Errorf("git push failed. %s", strings.TrimSpace(out))
+			}
+			rejected = append(rejected, refs...)
+		}
+		refspecs = refspecs[n:]
+	}
+	if len(rejected) > 0 {
+		return fmt.Errorf("push rejected for %s. the remote has different commits with the same names", strings.Join(rejected, ", "))
+	}
+	return nil
+}
+
+// parsePushRejected returns the refs rejected by the remote in the output of git push --porcelain.
+// Each ref is reported on a line of the form "FLAG<tab>FROM:TO<tab>SUMMARY", where "!" flags a rejected ref.
+func parsePushRejected(out string) []string {
+	var refs []string
+	for _, l := range strings.Split(strings.ReplaceAll(out, "\r\n", "\n"), "\n") {
+		parts := strings.Split(l, "\t")
+		if len(parts) < 2 || parts[0] != "!" {
+			continue
+		}
+		ref := parts[1]
+		if i := strings.Index(ref, ":"); i >= 0 {
+			ref = ref[i+1:]
+		}
+		refs = append(refs, shortRefName(ref))
+	}
+	return refs
+}
+
+func (gw *gitWrapper) AddWorktree(ctx context.Context, provider Provider, dir, ref string) error {
+	if *gitDryRun {
+		provider.Log("*** dry run only. worktree not created ****")
+		return nil
+	}
+	// Detached, so that the backup branch can still be restored in the workspace.
+	if out, err := gw.runGitCommand(ctx, *longCommandTimeout, "", "worktree", "add", "--detach", dir, ref); err != nil {
+		return fmt.Errorf("git worktree add failed. %s", strings.TrimSpace(out))
+	}
+	return nil
+}
+
+func (gw *gitWrapper) ListWorktrees(ctx context.Context) ([]GitWorktree, error) {
+	out, err := gw.RunGitCommand(ctx, "worktree", "list", "--porcelain")
+	if err != nil {
+		return nil, err
+	}
+	// Worktrees are separated by empty lines. The first one is the workspace.
+	result := []GitWorktree{}
+	for i, block := range strings.Split(strings.ReplaceAll(out, "\r\n", "\n"), "\n\n") {
+		if i == 0 {
+			continue
+		}
+		var wt GitWorktree
+		for _, l := range strings.Split(block, "\n") {
+			kv := strings.SplitN(l, " ", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch kv[0] {
+			case "worktree":
+				wt.Path = filepath.FromSlash(kv[1])
+			case "HEAD":
+				wt.Hash = kv[1]
+			}
+		}
+		if wt.Path != "" {
+			result = append(result, wt)
+		}
+	}
+	return result, nil
+}
+
+func (gw *gitWrapper) RemoveWorktree(ctx context.Context, provider Provider, dir string, force bool) error {
+	if *gitDryRun {
+		provider.Log("*** dry run only. worktree not removed ****")
+		return nil
+	}
+	args := []string{"worktree", "remove"}
+	if force {
+		args = append(args, "--force")
+	}
+	if out, err := gw.RunGitCommand(ctx, append(args, dir)...); err != nil {
+		return fmt.Errorf("git worktree remove failed. %s", strings.TrimSpace(out))
+	}
 	return nil
 }
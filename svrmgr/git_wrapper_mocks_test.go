@@ -34,6 +34,34 @@ func (m *MockGitWrapper) EXPECT() *MockGitWrapperMockRecorder {
 	return m.recorder
 }
 
+// AddWorktree mocks base method.
+func (m *MockGitWrapper) AddWorktree(ctx context.Context, provider Provider, dir, ref string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddWorktree", ctx, provider, dir, ref)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddWorktree indicates an expected call of AddWorktree.
+func (mr *MockGitWrapperMockRecorder) AddWorktree(ctx, provider, dir, ref interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddWorktree", reflect.TypeOf((*MockGitWrapper)(nil).AddWorktree), ctx, provider, dir, ref)
+}
+
+// Archive mocks base method.
+func (m *MockGitWrapper) Archive(ctx context.Context, treeish string, paths []string, output string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Archive", ctx, treeish, paths, output)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Archive indicates an expected call of Archive.
+func (mr *MockGitWrapperMockRecorder) Archive(ctx, treeish, paths, output interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Archive", reflect.TypeOf((*MockGitWrapper)(nil).Archive), ctx, treeish, paths, output)
+}
+
 // Checkout mocks base method.
 func (m *MockGitWrapper) Checkout(arg0 context.Context, arg1 GitReference) error {
 	m.ctrl.T.Helper()
@@ -48,18 +76,106 @@ func (mr *MockGitWrapperMockRecorder) Checkout(arg0, arg1 interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Checkout", reflect.TypeOf((*MockGitWrapper)(nil).Checkout), arg0, arg1)
 }
 
-// DeleteBranches mocks base method.
-func (m *MockGitWrapper) DeleteBranches(ctx context.Context, provider Provider, refs []GitReference) error {
+// CollectGarbage mocks base method.
+func (m *MockGitWrapper) CollectGarbage(ctx context.Context, provider Provider) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteBranches", ctx, provider, refs)
+	ret := m.ctrl.Call(m, "CollectGarbage", ctx, provider)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
+// CollectGarbage indicates an expected call of CollectGarbage.
+func (mr *MockGitWrapperMockRecorder) CollectGarbage(ctx, provider interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CollectGarbage", reflect.TypeOf((*MockGitWrapper)(nil).CollectGarbage), ctx, provider)
+}
+
+// CountObjects mocks base method.
+func (m *MockGitWrapper) CountObjects(ctx context.Context) (GitObjectStats, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountObjects", ctx)
+	ret0, _ := ret[0].(GitObjectStats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountObjects indicates an expected call of CountObjects.
+func (mr *MockGitWrapperMockRecorder) CountObjects(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountObjects", reflect.TypeOf((*MockGitWrapper)(nil).CountObjects), ctx)
+}
+
+// DeleteBranches mocks base method.
+func (m *MockGitWrapper) DeleteBranches(ctx context.Context, provider Provider, refs []GitReference, force bool) ([]GitReference, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteBranches", ctx, provider, refs, force)
+	ret0, _ := ret[0].([]GitReference)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
 // DeleteBranches indicates an expected call of DeleteBranches.
-func (mr *MockGitWrapperMockRecorder) DeleteBranches(ctx, provider, refs interface{}) *gomock.Call {
+func (mr *MockGitWrapperMockRecorder) DeleteBranches(ctx, provider, refs, force interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteBranches", reflect.TypeOf((*MockGitWrapper)(nil).DeleteBranches), ctx, provider, refs, force)
+}
+
+// DiffFiles mocks base method.
+func (m *MockGitWrapper) DiffFiles(ctx context.Context, from, to string) ([]FileChange, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DiffFiles", ctx, from, to)
+	ret0, _ := ret[0].([]FileChange)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DiffFiles indicates an expected call of DiffFiles.
+func (mr *MockGitWrapperMockRecorder) DiffFiles(ctx, from, to interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DiffFiles", reflect.TypeOf((*MockGitWrapper)(nil).DiffFiles), ctx, from, to)
+}
+
+// DiffText mocks base method.
+func (m *MockGitWrapper) DiffText(ctx context.Context, from, to string, paths []string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DiffText", ctx, from, to, paths)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DiffText indicates an expected call of DiffText.
+func (mr *MockGitWrapperMockRecorder) DiffText(ctx, from, to, paths interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DiffText", reflect.TypeOf((*MockGitWrapper)(nil).DiffText), ctx, from, to, paths)
+}
+
+// ExcludePaths mocks base method.
+func (m *MockGitWrapper) ExcludePaths(ctx context.Context, paths []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExcludePaths", ctx, paths)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ExcludePaths indicates an expected call of ExcludePaths.
+func (mr *MockGitWrapperMockRecorder) ExcludePaths(ctx, paths interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExcludePaths", reflect.TypeOf((*MockGitWrapper)(nil).ExcludePaths), ctx, paths)
+}
+
+// Fsck mocks base method.
+func (m *MockGitWrapper) Fsck(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Fsck", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Fsck indicates an expected call of Fsck.
+func (mr *MockGitWrapperMockRecorder) Fsck(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteBranches", reflect.TypeOf((*MockGitWrapper)(nil).DeleteBranches), ctx, provider, refs)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Fsck", reflect.TypeOf((*MockGitWrapper)(nil).Fsck), ctx)
 }
 
 // GetCurrentHead mocks base method.
@@ -77,6 +193,21 @@ func (mr *MockGitWrapperMockRecorder) GetCurrentHead(arg0 interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCurrentHead", reflect.TypeOf((*MockGitWrapper)(nil).GetCurrentHead), arg0)
 }
 
+// GitPath mocks base method.
+func (m *MockGitWrapper) GitPath(ctx context.Context, name string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GitPath", ctx, name)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GitPath indicates an expected call of GitPath.
+func (mr *MockGitWrapperMockRecorder) GitPath(ctx, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GitPath", reflect.TypeOf((*MockGitWrapper)(nil).GitPath), ctx, name)
+}
+
 // IsDirClean mocks base method.
 func (m *MockGitWrapper) IsDirClean(ctx context.Context) (bool, error) {
 	m.ctrl.T.Helper()
@@ -107,6 +238,83 @@ func (mr *MockGitWrapperMockRecorder) ListBranches(ctx, provider, filters interf
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListBranches", reflect.TypeOf((*MockGitWrapper)(nil).ListBranches), ctx, provider, filters)
 }
 
+// ListRefs mocks base method.
+func (m *MockGitWrapper) ListRefs(ctx context.Context, remote string, prefixes ...string) (map[string]string, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, remote}
+	for _, a := range prefixes {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "ListRefs", varargs...)
+	ret0, _ := ret[0].(map[string]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListRefs indicates an expected call of ListRefs.
+func (mr *MockGitWrapperMockRecorder) ListRefs(ctx, remote interface{}, prefixes ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, remote}, prefixes...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListRefs", reflect.TypeOf((*MockGitWrapper)(nil).ListRefs), varargs...)
+}
+
+// ListWorktrees mocks base method.
+func (m *MockGitWrapper) ListWorktrees(ctx context.Context) ([]GitWorktree, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListWorktrees", ctx)
+	ret0, _ := ret[0].([]GitWorktree)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListWorktrees indicates an expected call of ListWorktrees.
+func (mr *MockGitWrapperMockRecorder) ListWorktrees(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListWorktrees", reflect.TypeOf((*MockGitWrapper)(nil).ListWorktrees), ctx)
+}
+
+// PinBranch mocks base method.
+func (m *MockGitWrapper) PinBranch(ctx context.Context, provider Provider, ref GitReference) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PinBranch", ctx, provider, ref)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PinBranch indicates an expected call of PinBranch.
+func (mr *MockGitWrapperMockRecorder) PinBranch(ctx, provider, ref interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PinBranch", reflect.TypeOf((*MockGitWrapper)(nil).PinBranch), ctx, provider, ref)
+}
+
+// PushRefs mocks base method.
+func (m *MockGitWrapper) PushRefs(ctx context.Context, provider Provider, remote string, refspecs []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PushRefs", ctx, provider, remote, refspecs)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PushRefs indicates an expected call of PushRefs.
+func (mr *MockGitWrapperMockRecorder) PushRefs(ctx, provider, remote, refspecs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PushRefs", reflect.TypeOf((*MockGitWrapper)(nil).PushRefs), ctx, provider, remote, refspecs)
+}
+
+// RemoveWorktree mocks base method.
+func (m *MockGitWrapper) RemoveWorktree(ctx context.Context, provider Provider, dir string, force bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveWorktree", ctx, provider, dir, force)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveWorktree indicates an expected call of RemoveWorktree.
+func (mr *MockGitWrapperMockRecorder) RemoveWorktree(ctx, provider, dir, force interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveWorktree", reflect.TypeOf((*MockGitWrapper)(nil).RemoveWorktree), ctx, provider, dir, force)
+}
+
 // RunGitCommand mocks base method.
 func (m *MockGitWrapper) RunGitCommand(ctx context.Context, args ...string) (string, error) {
 	m.ctrl.T.Helper()
@@ -126,3 +334,46 @@ func (mr *MockGitWrapperMockRecorder) RunGitCommand(ctx interface{}, args ...int
 	varargs := append([]interface{}{ctx}, args...)
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunGitCommand", reflect.TypeOf((*MockGitWrapper)(nil).RunGitCommand), varargs...)
 }
+
+// StageSavedFiles mocks base method.
+func (m *MockGitWrapper) StageSavedFiles(ctx context.Context, worldsDir string, files []savedFile) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StageSavedFiles", ctx, worldsDir, files)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StageSavedFiles indicates an expected call of StageSavedFiles.
+func (mr *MockGitWrapperMockRecorder) StageSavedFiles(ctx, worldsDir, files interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StageSavedFiles", reflect.TypeOf((*MockGitWrapper)(nil).StageSavedFiles), ctx, worldsDir, files)
+}
+
+// UniqueSizes mocks base method.
+func (m *MockGitWrapper) UniqueSizes(ctx context.Context) (map[string]int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UniqueSizes", ctx)
+	ret0, _ := ret[0].(map[string]int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UniqueSizes indicates an expected call of UniqueSizes.
+func (mr *MockGitWrapperMockRecorder) UniqueSizes(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UniqueSizes", reflect.TypeOf((*MockGitWrapper)(nil).UniqueSizes), ctx)
+}
+
+// UnpinBranch mocks base method.
+func (m *MockGitWrapper) UnpinBranch(ctx context.Context, provider Provider, ref GitReference) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UnpinBranch", ctx, provider, ref)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UnpinBranch indicates an expected call of UnpinBranch.
+func (mr *MockGitWrapperMockRecorder) UnpinBranch(ctx, provider, ref interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnpinBranch", reflect.TypeOf((*MockGitWrapper)(nil).UnpinBranch), ctx, provider, ref)
+}
@@ -0,0 +1,89 @@
+package svrmgr
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/fieryorc/BedrockServerManager/winutils"
+)
+
+// configHandler implements config command.
+type configHandler struct {
+	cfg *config
+}
+
+func initConfigHandler(provider Provider, cfg *config) {
+	provider.Register("config", &configHandler{
+		cfg: cfg,
+	})
+}
+
+// Handle handles the config sub commands.
+func (h *configHandler) Handle(ctx context.Context, provider Provider, cmd []string) error {
+	if len(cmd) < 2 {
+		return invalidArgsErrorf("invalid command. try help")
+	}
+	switch cmd[1] {
+	case "show":
+		return h.Show(ctx, provider, cmd[2:])
+	case "reload":
+		return h.Reload(ctx, provider)
+	default:
+		return invalidArgsErrorf("unknown command. try help")
+	}
+}
+
+// Show prints the current settings along with where the value came from.
+// Optionally accepts the setting names to print.
+func (h *configHandler) Show(ctx context.Context, provider Provider, args []string) error {
+	filter := map[string]bool{}
+	for _, a := range args {
+		filter[a] = true
+	}
+
+	var out []string
+	out = append(out, fmt.Sprintf("config file: %s", h.cfg.Path()))
+	for _, f := range configSettings() {
+		if len(filter) > 0 && !filter[f.Name] {
+			continue
+		}
+		out = append(out, fmt.Sprintf("  %s = %s (%s)", f.Name, h.cfg.Value(f.Name), h.cfg.Source(f.Name)))
+	}
+
+	if len(filter) == 0 || filter[configKeyAliases] {
+		var names []string
+		for name := range aliases {
+			names = append(names, name)
+		}
+		for _, name := range h.cfg.AliasNames() {
+			if _, ok := aliases[name]; !ok {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		out = append(out, "aliases:")
+		for _, name := range names {
+			al, ok := h.cfg.Alias(name)
+			source := configSourceFile
+			if !ok {
+				al = aliases[name]
+				source = configSourceDefault
+			}
+			out = append(out, fmt.Sprintf("  %s = %s (%s)", name, al, source))
+		}
+	}
+	provider.Printfln("%s", strings.Join(out, winutils.NewLine()))
+	return nil
+}
+
+// Reload reloads the config file.
+func (h *configHandler) Reload(ctx context.Context, provider Provider) error {
+	if err := provider.ReloadConfig(); err != nil {
+		return fmt.Errorf("failed to reload config. %v", err)
+	}
+	provider.Log("config reloaded")
+	return nil
+}
@@ -13,7 +13,7 @@ func initHelpHandler(provider Provider) {
 }
 
 func (h *helpHandler) Handle(ctx context.Context, provider Provider, cmd []string) error {
-	fmt.Printf(`Welcome to Minecraft Bedrock Server Manager for Windows.
+	fmt.Printf(`Welcome to Minecraft Bedrock Server Manager.
 
 Syntax:
 	help
@@ -23,12 +23,59 @@ Syntax:
 	$ COMMAND
 		Execute the shell command directly and print output.
 	status
-		Status of the bedrock server
+		Status of the bedrock server, including the number of players online.
 		alias: s
 	start
 		Start the bedrock server
-	stop
-		Stop the bedrock server
+	stop [WARNING_PERIOD]
+		Stop the bedrock server gracefully. If the server does not stop in time, it is killed.
+		If WARNING_PERIOD is specified, players are warned before the server is stopped.
+		Example: stop 5m
+	supervisor [status]
+		Show the automatic restart status.
+		alias: sv
+	supervisor policy POLICY
+		Set when the server is restarted after it exits. POLICY is one of:
+			never - never restart automatically.
+			on-failure - restart if the server crashed.
+			always - restart whenever the server exits without 'stop'.
+		Restarts are delayed with exponential backoff. After repeated crashes, restarts are suspended.
+	supervisor crashes [COUNT]
+		List the recent crashes along with the last lines of server output.
+	supervisor reset
+		Clear the crash history and resume suspended restarts.
+	restart [status]
+		Show the next scheduled restart. Daily restart times are set with -restart_times.
+	restart now [WARNING_PERIOD]
+		Back up the world, stop the server and start it again.
+		If WARNING_PERIOD is specified, players are warned before the restart.
+		The countdown runs in the background and can be stopped with 'restart cancel'.
+	restart at HH:MM
+		Restart the server once at the next HH:MM, replacing the next scheduled restart.
+		Players are warned for -restart_warning before the restart.
+	restart cancel
+		Cancel the next restart. Daily restarts continue from the following scheduled time.
+	log [tail [COUNT]]
+		Print the most recent server output. Prints 20 lines if COUNT is not specified.
+	log grep PATTERN
+		Print the server output lines matching the regular expression PATTERN.
+		Example: log grep Player (dis)?connected
+	log since DURATION
+		Print the server output logged within DURATION.
+		Example: log since 10m
+	players [list]
+		List the players currently online along with their XUID and connect time.
+	players history NAME
+		Print the sessions and total playtime of the player. NAME can be any name the player used or the XUID.
+	players top [COUNT]
+		Print the players with the most playtime. Default COUNT is 10.
+	config show [SETTING ...]
+		Print the current settings and where they came from (default, config file or command line).
+		alias: cfg
+	config reload
+		Reload the config file. backup_interval, backup_only_when_active, backup_schedules, backup_retention,
+		backup_gc_schedule, backup_remotes, restart_policy, restart_times, restart_warning and aliases are
+		applied immediately. Changing any other setting fails; restart the manager to apply it.
 	quit
 		Exit the server manager shell. If server is running, will be stopped.
 		alias: q, exit
@@ -49,12 +96,25 @@ Syntax:
 	backup period INTERVAL
 		Set automatic backup perid. Set to 0 to disable. If set, new timer is started.
 		Example formats: 1h - 1 hour, 20m - 20 minutes, 30s - 30 seconds
+		With -backup_only_when_active, periodic backups are skipped unless a player was online since
+		the last backup, and a backup is taken when the last player leaves.
 		alias: bp
-	backup delete BACKUP_NAME
+	backup delete [--force] BACKUP_NAME
 		Delete the specified backup. You can specify wildcard as well.
 		Example: backup delete saves/manual/202102* will delete all backups starting saves/manual/202102*.
+		Pinned backups are skipped unless --force is specified.
 		alias: bd
-	backup prune CUTOFF_TIME INTERVAL
+	backup pin BACKUP_NAME
+		Pin the backup to protect it from deletion and pruning. Pinned backups are marked [pinned] in backup list.
+		The pin is stored as the git tag pinned/BACKUP_NAME.
+	backup unpin BACKUP_NAME
+		Remove the pin from the backup.
+	backup schedule list
+		List the cron style backup schedules along with their next run.
+		Schedules are defined by backup_schedules in the config file. For example:
+			"backup_schedules": [{"cron": "0 */2 * * *"}, {"cron": "30 3 * * *", "type": "nightly", "description": "Nightly backup"}]
+		Fields are minute, hour, day of month, month and day of week. Backups are saved as saves/TYPE/DATE_TIME.
+	backup prune [--dry-run] [--force] [CUTOFF_TIME INTERVAL]
 		Cleanup periodic backups older than CUTOFF_TIME. Keep the backups for every INTERVAL.
 		For example, 'backup prune 3d 8h' will cleanup backups older than 3days. It will leave
 		one backup every 8hours. The backup that is retained is chosen such that each backup is spaced at 8h.
@@ -62,8 +122,55 @@ Syntax:
 			backup prune 3d 1d - Prune all backups older than 3days keeping one backup per day.
 			In other words, turn into daily backup for backups older than 3d. Backups within last 3days will
 			not be touched.
+		Without CUTOFF_TIME and INTERVAL, the backup_retention policies in the config file are applied.
+		These are also applied automatically after each automatic backup. For example:
+			"backup_retention": {"default": {"keep_all": "24h", "hourly": "7d", "daily": "30d", "weekly": "365d"}}
+		keeps all backups for 24h, then the newest backup of every hour for 7 days, every day for 30 days
+		and every week for a year. "default" applies to the automatic backup types. Manual and imported backups
+		are pruned only if they have their own policy.
+		With --dry-run, the backups that would be deleted are listed instead.
+		Pinned backups are pruned only if --force is specified. The automatic pruning never deletes them.
 		Warning: Once deleted, backups cannot be restored through BedrockServerManager. You can
 			salvage git commits through git.
+	backup gc
+		Free the space used by the deleted backups. Expires the git reflog, runs git gc and verifies the
+		repository using git fsck. Reports the space reclaimed. Cannot run while a backup is in progress.
+		Set -backup_gc_schedule to a cron expression to run it automatically, for example "0 5 * * 0".
+	backup stats
+		Show the repository size, the number of backups by type, the oldest and newest backups and the
+		approximate space used only by each backup (freed by deleting the backup and running backup gc).
+		Finding the space used by each backup walks all the files of every backup, so it can take minutes
+		with many backups of a large world. Each git command is limited by -git_long_command_timeout.
+		The summary is also shown by the status command, without the space used by each backup.
+	backup diff BACKUP_NAME [BACKUP_NAME]
+		Show the files changed between the two backups, with the size changes. With one backup, the backup
+		is compared with the current workspace. Changes to server.properties, permissions.json and the
+		allowlist are shown in full.
+	backup export BACKUP_NAME [PATH]
+		Export the world in the backup. A PATH ending with .mcworld creates a world file that can be imported
+		into Minecraft. A PATH ending with .zip also includes server.properties, permissions.json and the
+		allowlist. Defaults to BACKUP_NAME.mcworld in the current directory, with / replaced by _.
+		The backup is read from git, so the server can keep running.
+	backup import [--level-name LEVEL_NAME] FILE DESCRIPTION
+		Load the world in the .mcworld or .zip file and save it as backup saves/imported/DATE_TIME.
+		The world replaces worlds/LEVEL_NAME, which defaults to the level-name in server.properties.
+		If a different LEVEL_NAME is given, server.properties is updated to load the imported world.
+		The server must be stopped and there must be no changes since the last backup.
+		Worlds larger than -backup_import_max_size (8GB by default) are refused.
+		Example: backup import Skyblock.mcworld Skyblock from Steve
+	backup sync [status]
+		Push the backups and their pins to the git remotes in -backup_remotes. Backups deleted or
+		unpinned by backup delete, prune and unpin are deleted or unpinned on the remotes as well.
+		Other backups on the remotes are never deleted. This also runs in the background after each
+		backup, prune, delete, pin and unpin. With status, only lists the backups that are not synced yet.
+		Backups are never overwritten on the remotes. A backup with the same name but different commits is reported.
+	backup extract BACKUP_NAME DIR
+		Check out the backup into DIR using git worktree, for example to copy a file from an old world.
+		The live world is not changed, so the server can keep running. DIR must be outside the workspace.
+	backup worktree list
+		List the directories the backups are extracted to.
+	backup worktree remove [--force] DIR
+		Delete the extracted backup. Use --force if files in DIR were changed.
 	workspace clean
 		Restore the current state to currently active backup. This deletes the modified files (since last backup).
 		Current contents are backed as 'saved/temp/DATE_TIME'.
@@ -0,0 +1,122 @@
+package svrmgr
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fieryorc/BedrockServerManager/winutils"
+)
+
+// defaultLogTailLines is the number of lines printed by `log tail` when no count is given.
+const defaultLogTailLines = 20
+
+// logHandler implements log command.
+// Reads the recent server output kept in memory.
+type logHandler struct {
+	nowFn func() time.Time
+}
+
+func initLogHandler(provider Provider) {
+	provider.Register("log", &logHandler{
+		nowFn: time.Now,
+	})
+}
+
+// Handle handles the log sub commands.
+func (h *logHandler) Handle(ctx context.Context, provider Provider, cmd []string) error {
+	lines, err := h.HandleResult(ctx, provider, cmd)
+	if err != nil {
+		return err
+	}
+	printLogLines(provider, lines.([]LogLine))
+	return nil
+}
+
+// HandleResult returns the matching []LogLine.
+func (h *logHandler) HandleResult(ctx context.Context, provider Provider, cmd []string) (interface{}, error) {
+	var lines []LogLine
+	var err error
+	if len(cmd) < 2 {
+		cmd = []string{"log", "tail"}
+	}
+	switch cmd[1] {
+	case "tail":
+		lines, err = h.Tail(ctx, provider, cmd[2:])
+	case "grep":
+		lines, err = h.Grep(ctx, provider, cmd[2:])
+	case "since":
+		lines, err = h.Since(ctx, provider, cmd[2:])
+	default:
+		return nil, invalidArgsErrorf("unknown command. try help")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if lines == nil {
+		lines = []LogLine{}
+	}
+	return lines, nil
+}
+
+// Tail returns the most recent lines.
+// Optionally accepts the line count.
+func (h *logHandler) Tail(ctx context.Context, provider Provider, args []string) ([]LogLine, error) {
+	count := defaultLogTailLines
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 0 {
+			return nil, invalidArgsErrorf("invalid line count '%s'", args[0])
+		}
+		count = n
+	}
+
+	return provider.GetServerProcess().Logs().Tail(count), nil
+}
+
+// Grep returns the lines matching the regular expression.
+func (h *logHandler) Grep(ctx context.Context, provider Provider, args []string) ([]LogLine, error) {
+	if len(args) == 0 {
+		return nil, invalidArgsErrorf("invalid args. must specify PATTERN. try 'help' for usage")
+	}
+	re, err := regexp.Compile(strings.Join(args, " "))
+	if err != nil {
+		return nil, invalidArgsErrorf("invalid pattern. %v", err)
+	}
+
+	return provider.GetServerProcess().Logs().Grep(re), nil
+}
+
+// Since returns the lines logged within the given duration.
+func (h *logHandler) Since(ctx context.Context, provider Provider, args []string) ([]LogLine, error) {
+	if len(args) != 1 {
+		return nil, invalidArgsErrorf("invalid args. must specify DURATION. try 'help' for usage")
+	}
+	d, err := parseDuration(args[0])
+	if err != nil {
+		return nil, invalidArgsErrorf("invalid duration. %v", err)
+	}
+
+	return provider.GetServerProcess().Logs().Since(h.nowFn().Add(-d)), nil
+}
+
+// printLogLines prints the lines with their timestamps. stderr lines are tagged.
+func printLogLines(provider Provider, lines []LogLine) {
+	if len(lines) == 0 {
+		provider.Log("no matching log lines")
+		return
+	}
+
+	var out []string
+	for _, l := range lines {
+		tag := ""
+		if l.Source == LogSourceStderr {
+			tag = "[stderr] "
+		}
+		out = append(out, fmt.Sprintf("[%s] %s%s", l.Time.Local().Format("20060102-15:04:05"), tag, l.Line))
+	}
+	provider.Printfln("%s", strings.Join(out, winutils.NewLine()))
+}
@@ -0,0 +1,299 @@
+package svrmgr
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fieryorc/BedrockServerManager/winutils"
+)
+
+// playerEventPattern matches the bedrock server lines such as
+// `[2021-10-02 12:00:00:000 INFO] Player connected: Steve, xuid: 2535412345678901`.
+// Newer servers append fields after the xuid, such as `, pfid: 1a2b3c4d5e6f7a8b`.
+var playerEventPattern = regexp.MustCompile(`Player (connected|disconnected): (.+?), xuid: ?(\d*)(?:, \w+: ?[^,]*)*\s*$`)
+
+// Player is a player currently connected to the server.
+type Player struct {
+	Name        string    `json:"name"`
+	XUID        string    `json:"xuid"`
+	ConnectedAt time.Time `json:"connected_at"`
+}
+
+// playerEvent is a player connecting to or disconnecting from the server.
+type playerEvent struct {
+	Player    Player
+	Connected bool
+}
+
+// parsePlayerEvent parses the player connected/disconnected line.
+// Returns false if the line is not a player event.
+func parsePlayerEvent(line LogLine) (playerEvent, bool) {
+	m := playerEventPattern.FindStringSubmatch(line.Line)
+	if m == nil {
+		return playerEvent{}, false
+	}
+	return playerEvent{
+		Player: Player{
+			Name:        strings.TrimSpace(m[2]),
+			XUID:        m[3],
+			ConnectedAt: line.Time,
+		},
+		Connected: m[1] == "connected",
+	}, true
+}
+
+// defaultPlayersTopCount is the number of players printed by `players top` when no count is given.
+const defaultPlayersTopCount = 10
+
+// playersHandler implements players command.
+// Tracks the online players from the server output and records their sessions.
+type playersHandler struct {
+	lock   sync.Mutex
+	online map[string]Player // Online players by name.
+	store  *playerSessionStore
+	nowFn  func() time.Time
+}
+
+func initPlayersHandler(provider Provider) {
+	provider.Register("players", &playersHandler{
+		online: map[string]Player{},
+		store:  newPlayerSessionStore(""),
+		nowFn:  time.Now,
+	})
+}
+
+// Handle handles the players sub commands.
+func (h *playersHandler) Handle(ctx context.Context, provider Provider, cmd []string) error {
+	result, err := h.HandleResult(ctx, provider, cmd)
+	if err != nil {
+		return err
+	}
+
+	switch r := result.(type) {
+	case []Player:
+		h.printOnline(provider, r)
+	case *PlayerHistory:
+		h.printHistory(provider, r)
+	case []PlayerStats:
+		h.printTop(provider, r)
+	}
+	return nil
+}
+
+// HandleResult returns the online []Player, the *PlayerHistory or the top []PlayerStats.
+func (h *playersHandler) HandleResult(ctx context.Context, provider Provider, cmd []string) (interface{}, error) {
+	if len(cmd) < 2 || cmd[1] == "list" {
+		return h.Online(), nil
+	}
+	switch cmd[1] {
+	case "history":
+		return h.History(ctx, provider, cmd[2:])
+	case "top":
+		return h.Top(ctx, provider, cmd[2:])
+	default:
+		return nil, invalidArgsErrorf("unknown command. try help")
+	}
+}
+
+// History returns the sessions of the player.
+// The player is matched by any of the names used or by XUID.
+func (h *playersHandler) History(ctx context.Context, provider Provider, args []string) (*PlayerHistory, error) {
+	if len(args) == 0 {
+		return nil, invalidArgsErrorf("invalid args. must specify NAME. try 'help' for usage")
+	}
+	name := strings.Join(args, " ")
+
+	all := h.allSessions()
+	var key string
+	for _, s := range all {
+		if strings.EqualFold(s.Name, name) || s.XUID == name {
+			key = s.playerKey()
+		}
+	}
+	if key == "" {
+		return nil, notFoundErrorf("no sessions found for '%s'", name)
+	}
+
+	var sessions []PlayerSession
+	for _, s := range all {
+		if s.playerKey() == key {
+			sessions = append(sessions, s)
+		}
+	}
+	return &PlayerHistory{
+		Stats:    playerStats(sessions, h.nowFn())[0],
+		Sessions: sortSessions(sessions),
+	}, nil
+}
+
+// Top returns the players with the most playtime.
+// Optionally accepts the player count.
+func (h *playersHandler) Top(ctx context.Context, provider Provider, args []string) ([]PlayerStats, error) {
+	count := defaultPlayersTopCount
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return nil, invalidArgsErrorf("invalid player count '%s'", args[0])
+		}
+		count = n
+	}
+
+	stats := playerStats(h.allSessions(), h.nowFn())
+	if len(stats) > count {
+		stats = stats[:count]
+	}
+	if stats == nil {
+		stats = []PlayerStats{}
+	}
+	return stats, nil
+}
+
+// Online returns the online players, earliest connected first.
+// Called by other modules.
+func (h *playersHandler) Online() []Player {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	players := []Player{}
+	for _, p := range h.online {
+		players = append(players, p)
+	}
+	sort.Slice(players, func(i, j int) bool {
+		if players[i].ConnectedAt.Equal(players[j].ConnectedAt) {
+			return players[i].Name < players[j].Name
+		}
+		return players[i].ConnectedAt.Before(players[j].ConnectedAt)
+	})
+	return players
+}
+
+// Count returns the number of online players.
+// Called by other modules.
+func (h *playersHandler) Count() int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return len(h.online)
+}
+
+// onServerOutput updates the online players, records the completed sessions
+// and publishes the player events.
+func (h *playersHandler) onServerOutput(provider Provider, line LogLine) {
+	ev, ok := parsePlayerEvent(line)
+	if !ok {
+		return
+	}
+
+	h.lock.Lock()
+	joined, wasOnline := h.online[ev.Player.Name]
+	if ev.Connected {
+		h.online[ev.Player.Name] = ev.Player
+	} else {
+		delete(h.online, ev.Player.Name)
+	}
+	h.lock.Unlock()
+
+	// Reconnect without disconnect closes the previous session as well.
+	if wasOnline {
+		h.closeSession(provider, joined, line.Time, sessionEndDisconnect)
+	}
+
+	evType := EventPlayerLeft
+	if ev.Connected {
+		evType = EventPlayerJoined
+	}
+	provider.Events().Publish(Event{Type: evType, Time: line.Time, Player: &ev.Player})
+}
+
+// onServerExit closes the sessions of the online players. All the players are
+// disconnected when the server exits, including crashes.
+func (h *playersHandler) onServerExit(provider Provider, exit ServerExit) {
+	h.lock.Lock()
+	online := h.online
+	h.online = map[string]Player{}
+	h.lock.Unlock()
+
+	for _, p := range online {
+		h.closeSession(provider, p, exit.Time, sessionEndServerExit)
+	}
+}
+
+// closeSession records the completed session.
+func (h *playersHandler) closeSession(provider Provider, p Player, left time.Time, reason string) {
+	err := h.store.Add(PlayerSession{
+		Name:      p.Name,
+		XUID:      p.XUID,
+		Joined:    p.ConnectedAt,
+		Left:      left,
+		EndReason: reason,
+	})
+	if err != nil {
+		provider.Log(fmt.Sprintf("unable to record the session of %s. %v", p.Name, err))
+	}
+}
+
+// allSessions returns the completed sessions along with the open sessions of the online players.
+func (h *playersHandler) allSessions() []PlayerSession {
+	sessions := h.store.Sessions()
+	for _, p := range h.Online() {
+		sessions = append(sessions, PlayerSession{Name: p.Name, XUID: p.XUID, Joined: p.ConnectedAt})
+	}
+	return sessions
+}
+
+func (h *playersHandler) printOnline(provider Provider, online []Player) {
+	if len(online) == 0 {
+		provider.Log("no players online")
+		return
+	}
+	out := []string{fmt.Sprintf("%d players online:", len(online))}
+	for _, p := range online {
+		out = append(out, fmt.Sprintf("    %s (xuid: %s) connected at %s, online for %v",
+			p.Name, p.XUID, p.ConnectedAt.Local().Format("20060102-15:04:05"), h.nowFn().Sub(p.ConnectedAt).Round(time.Second)))
+	}
+	provider.Printfln("%s", strings.Join(out, winutils.NewLine()))
+}
+
+func (h *playersHandler) printHistory(provider Provider, history *PlayerHistory) {
+	st := history.Stats
+	out := []string{fmt.Sprintf("%s (xuid: %s): %d sessions, playtime %v, first seen %s, last seen %s",
+		st.Name, st.XUID, st.Sessions, time.Duration(st.Playtime).Round(time.Second),
+		st.FirstSeen.Local().Format("20060102-15:04:05"), st.LastSeen.Local().Format("20060102-15:04:05"))}
+	if len(st.Names) > 1 {
+		out = append(out, fmt.Sprintf("    names: %s", strings.Join(st.Names, ", ")))
+	}
+	for _, s := range history.Sessions {
+		left := "online now"
+		if !s.Left.IsZero() {
+			left = s.Left.Local().Format("20060102-15:04:05")
+		}
+		line := fmt.Sprintf("    %s - %s (%v)", s.Joined.Local().Format("20060102-15:04:05"), left, s.Duration(h.nowFn()).Round(time.Second))
+		if s.EndReason == sessionEndServerExit {
+			line += " ended by server exit"
+		}
+		out = append(out, line)
+	}
+	provider.Printfln("%s", strings.Join(out, winutils.NewLine()))
+}
+
+func (h *playersHandler) printTop(provider Provider, stats []PlayerStats) {
+	if len(stats) == 0 {
+		provider.Log("no player sessions recorded")
+		return
+	}
+	var out []string
+	for i, st := range stats {
+		online := ""
+		if st.Online {
+			online = ", online now"
+		}
+		out = append(out, fmt.Sprintf("%d. %s %v (%d sessions, last seen %s%s)",
+			i+1, st.Name, time.Duration(st.Playtime).Round(time.Second), st.Sessions, st.LastSeen.Local().Format("20060102-15:04:05"), online))
+	}
+	provider.Printfln("%s", strings.Join(out, winutils.NewLine()))
+}
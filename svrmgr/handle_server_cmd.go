@@ -2,7 +2,6 @@ package svrmgr
 
 import (
 	"context"
-	"fmt"
 	"strings"
 
 	"github.com/golang/glog"
@@ -21,7 +20,7 @@ func (h *serverCmdHandler) Handle(ctx context.Context, provider Provider, args [
 		return nil
 	}
 	if !provider.GetServerProcess().IsRunning() {
-		return fmt.Errorf("cannot send command. server is not running")
+		return conflictErrorf("cannot send command. server is not running")
 	}
 	glog.Infof("sending command to bedrock server: %s %s", args[1], strings.Join(args[2:], " "))
 	return provider.GetServerProcess().SendInput(strings.Join(args[1:], " "))
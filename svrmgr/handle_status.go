@@ -3,35 +3,84 @@ package svrmgr
 import (
 	"context"
 	"fmt"
+
+	"github.com/golang/glog"
 )
 
 // statusHandler implements status command.
 type statusHandler struct{}
 
-func initStatusHandler(provider Provider) {
-	provider.Register("status", &statusHandler{})
+// ServerStatus is the result of the status command.
+type ServerStatus struct {
+	ServerRunning  bool             `json:"server_running"`
+	Players        int              `json:"players"` // Number of online players.
+	WorkspaceClean bool             `json:"workspace_clean"`
+	Backup         BackupStatus     `json:"backup"`
+	Storage        *BackupStats     `json:"storage"` // nil if the storage usage is not available.
+	Supervisor     SupervisorStatus `json:"supervisor"`
+	Restart        RestartStatus    `json:"restart"`
 }
 
-func (h *statusHandler) Handle(ctx context.Context, provider Provider, cmd []string) error {
+func (s *ServerStatus) String() string {
 	serverState := "not running"
-	if provider.GetServerProcess().IsRunning() {
-		serverState = "running"
+	if s.ServerRunning {
+		serverState = fmt.Sprintf("running with %d players online", s.Players)
+	}
+	wsState := "clean"
+	if !s.WorkspaceClean {
+		wsState = "dirty"
 	}
+	str := fmt.Sprintf(`server is %s, workspace is %s, %s, %s, %s`, serverState, wsState, s.Backup, s.Supervisor, s.Restart)
+	if s.Storage != nil {
+		str += fmt.Sprintf(", %s", s.Storage)
+	}
+	return str
+}
 
-	isClean, err := provider.GitWrapper().IsDirClean(ctx)
+func initStatusHandler(provider Provider) {
+	provider.Register("status", &statusHandler{})
+}
+
+func (h *statusHandler) Handle(ctx context.Context, provider Provider, cmd []string) error {
+	status, err := h.HandleResult(ctx, provider, cmd)
 	if err != nil {
 		return err
 	}
+	provider.Log(status.(*ServerStatus).String())
+	return nil
+}
 
-	wsState := "clean"
-	if !isClean {
-		wsState = "dirty"
+// HandleResult returns the *ServerStatus.
+func (h *statusHandler) HandleResult(ctx context.Context, provider Provider, cmd []string) (interface{}, error) {
+	isClean, err := provider.GitWrapper().IsDirClean(ctx)
+	if err != nil {
+		return nil, err
 	}
 
 	bhI, _ := provider.GetHandler("backup")
 	bh := bhI.(*backupHandler)
-	backupStatus := bh.Status(ctx, provider)
 
-	provider.Log(fmt.Sprintf(`server is %s, workspace is %s, %s`, serverState, wsState, backupStatus))
-	return nil
+	shI, _ := provider.GetHandler("supervisor")
+	sh := shI.(*supervisorHandler)
+
+	rhI, _ := provider.GetHandler("restart")
+	rh := rhI.(*restartHandler)
+
+	phI, _ := provider.GetHandler("players")
+	ph := phI.(*playersHandler)
+
+	storage, err := bh.stats(ctx, provider, false)
+	if err != nil {
+		glog.Infof("unable to get the backup storage usage. %v", err)
+	}
+
+	return &ServerStatus{
+		ServerRunning:  provider.GetServerProcess().IsRunning(),
+		Players:        ph.Count(),
+		WorkspaceClean: isClean,
+		Backup:         bh.Status(ctx, provider),
+		Storage:        storage,
+		Supervisor:     sh.Status(ctx, provider),
+		Restart:        rh.Status(ctx, provider),
+	}, nil
 }
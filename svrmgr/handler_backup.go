@@ -4,16 +4,21 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/fieryorc/BedrockServerManager/winutils"
 	"github.com/golang/glog"
 )
 
 var autoBackupInterval = flag.Duration("backup_interval", time.Minute*30, "automatic backup interval.")
+var autoPruneCutoff = flag.Duration("backup_prune_cutoff", 0, "if set along with backup_prune_interval, periodic backups older than this are pruned after each periodic backup")
+var autoPruneInterval = flag.Duration("backup_prune_interval", 0, "interval between the periodic backups retained by automatic pruning")
+var backupOnlyWhenActive = flag.Bool("backup_only_when_active", false, "take periodic backups only if a player was online since the last backup, and take a backup when the last player leaves")
 
 const backupSaveCompletedMarker = "Data saved. Files are now ready to be copied"
 const FormatBackupTimestamp = "20060102-150405"
@@ -27,40 +32,105 @@ const (
 	backupTypePeriodic backupType = "periodic"
 	// backupTypeTemp - temporary saves as a result of running clean.
 	backupTypeTemp backupType = "temp"
+	// backupTypeImported - worlds loaded using import.
+	backupTypeImported backupType = "imported"
 )
 
 // backupHandler handles the backup logic.
 // Supports multiple sub commands.
 type backupHandler struct {
-	lock           sync.Mutex    // All operations are atomic.
-	timer          *time.Timer   // Periodic backup timer
-	backupInterval time.Duration // Automatic backup interval.
+	lock           sync.Mutex     // All operations are atomic.
+	timer          *time.Timer    // Periodic backup timer
+	backupInterval time.Duration  // Automatic backup interval.
+	onlyWhenActive bool           // Periodic backups only if players were online since the last backup.
+	lastPlayerLeft chan time.Time // Asks the backup loop for the backup after the last player left.
+	worldsDir      string         // Bedrock worlds directory.
 	nowFn          func() time.Time
+	afterFn        func(d time.Duration) <-chan time.Time
+
+	cfg              *config
+	schedules        []*BackupSchedule // Cron style schedules from the config file.
+	schedulesChanged chan struct{}     // Wakes up the schedule loop when the schedules change.
+	gcCron           *cronSchedule     // Git maintenance schedule. nil if disabled.
+	gcNext           time.Time         // Next scheduled git maintenance.
+
+	activityLock sync.Mutex // Guards lastBackup, lastActivity and saving. Not held during the backup.
+	lastBackup   time.Time  // Start time of the last successful backup. Zero if none since start.
+	lastActivity time.Time  // Time of the last player join or leave.
+	saving       bool       // True while a backup is in progress.
+
+	syncLock     sync.Mutex                  // Serializes the syncs. Guards remotes and syncState.
+	remotes      []string                    // Remotes the backups are replicated to.
+	syncState    map[string]*remoteSyncState // Result of the last sync by remote.
+	syncRequests chan struct{}               // Wakes up the sync loop.
+
+	deletedLock sync.Mutex      // Guards deleted and deletedFile. Not held during the sync.
+	deleted     map[string]bool // Full names of the refs deleted by the manager, to delete from the remotes.
+	deletedFile string          // File the deletions are persisted to. Empty until read.
 }
 
 // initBackupHandler initializes the backup plugin and starts the
-// periodic backup.
-func initBackupHandler(provider Provider) {
+// periodic and scheduled backups.
+func initBackupHandler(provider Provider, cfg *config) {
 	bh := &backupHandler{
-		timer: time.NewTimer(time.Hour), // Will be reset immediately.
-		nowFn: time.Now,
+		timer:            time.NewTimer(time.Hour), // Will be reset immediately.
+		worldsDir:        filepath.Join(filepath.Dir(getBedrockServerPath()), "worlds"),
+		nowFn:            time.Now,
+		onlyWhenActive:   *backupOnlyWhenActive,
+		afterFn:          time.After,
+		cfg:              cfg,
+		schedulesChanged: make(chan struct{}, 1),
+		syncState:        map[string]*remoteSyncState{},
+		syncRequests:     make(chan struct{}, 1),
+		deleted:          map[string]bool{},
+		lastPlayerLeft:   make(chan time.Time, 1),
 	}
 	bh.setPeriod(context.Background(), provider, *autoBackupInterval)
 
+	bh.applySchedules(provider)
+	bh.applyGCSchedule(provider, *backupGCSchedule)
+	bh.setRemotes(*backupRemotes)
+
+	cfg.OnReload(configKeyBackupSchedules, func(provider Provider, value interface{}) {
+		bh.applySchedules(provider)
+	})
+	cfg.OnReload("backup_gc_schedule", func(provider Provider, value interface{}) {
+		bh.applyGCSchedule(provider, value.(string))
+	})
+	cfg.OnReload("backup_remotes", func(provider Provider, value interface{}) {
+		bh.setRemotes(value.(string))
+		bh.requestSync()
+	})
+	cfg.OnReload("backup_only_when_active", func(provider Provider, value interface{}) {
+		bh.lock.Lock()
+		defer bh.lock.Unlock()
+		bh.onlyWhenActive = value.(bool)
+	})
+	cfg.OnReload("backup_interval", func(provider Provider, value interface{}) {
+		bh.lock.Lock()
+		defer bh.lock.Unlock()
+		if err := bh.setPeriod(context.Background(), provider, value.(time.Duration)); err != nil {
+			provider.Log(fmt.Sprintf("unable to apply backup_interval. %v", err))
+		}
+	})
+
 	provider.Register("backup", bh)
 	go bh.runBackupLoop(context.Background(), provider)
+	go bh.runScheduleLoop(context.Background(), provider)
+	go bh.runSyncLoop(context.Background(), provider)
+	go bh.runActivityLoop(context.Background(), provider, provider.Events().Subscribe(defaultSubscriptionBuffer, EventPlayerJoined, EventPlayerLeft))
 }
 
 // Handle handles the main logic.
 func (h *backupHandler) Handle(ctx context.Context, provider Provider, cmd []string) error {
 	if len(cmd) < 2 {
-		return fmt.Errorf("invalid command. try help")
+		return invalidArgsErrorf("invalid command. try help")
 	}
 	switch cmd[1] {
 	case "save":
 		msg := strings.Join(cmd[2:], " ")
 		if msg == "" {
-			return fmt.Errorf("backup description must be specified")
+			return invalidArgsErrorf("backup description must be specified")
 		}
 		return h.Save(ctx, provider, msg)
 	case "list":
@@ -73,13 +143,81 @@ func (h *backupHandler) Handle(ctx context.Context, provider Provider, cmd []str
 		return h.Clean(ctx, provider, cmd[2:])
 	case "delete":
 		return h.Delete(ctx, provider, cmd[2:])
+	case "pin":
+		return h.Pin(ctx, provider, cmd[2:], true)
+	case "unpin":
+		return h.Pin(ctx, provider, cmd[2:], false)
 	case "prune":
 		return h.Prune(ctx, provider, cmd[2:])
+	case "schedule":
+		return h.Schedule(ctx, provider, cmd[2:])
+	case "gc":
+		return h.GC(ctx, provider, cmd[2:])
+	case "stats":
+		return h.Stats(ctx, provider, cmd[2:])
+	case "diff":
+		return h.Diff(ctx, provider, cmd[2:])
+	case "export":
+		return h.Export(ctx, provider, cmd[2:])
+	case "import":
+		return h.Import(ctx, provider, cmd[2:])
+	case "sync":
+		return h.Sync(ctx, provider, cmd[2:])
+	case "extract":
+		return h.Extract(ctx, provider, cmd[2:])
+	case "worktree":
+		return h.Worktree(ctx, provider, cmd[2:])
 	default:
-		return fmt.Errorf("unknown command. try help")
+		return invalidArgsErrorf("unknown command. try help")
 	}
 }
 
+// HandleResult returns the []GitReference for the list and prune --dry-run commands,
+// the []BackupSchedule for the schedule list command, the GCResult for the gc command and
+// the BackupStats for the stats command, the BackupDiff for the diff command and
+// the []RemoteSyncStatus for the sync command and the []GitWorktree for the worktree list command.
+func (h *backupHandler) HandleResult(ctx context.Context, provider Provider, cmd []string) (interface{}, error) {
+	if dryRun, args := parseDryRun(cmd); dryRun && len(args) >= 2 && args[1] == "prune" {
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		force, args := parseFlag(args[2:], "--force")
+		expired, err := h.pruneCandidates(ctx, provider, args, force)
+		if expired == nil && err == nil {
+			expired = []GitReference{}
+		}
+		return expired, err
+	}
+	if len(cmd) >= 2 && cmd[1] == "schedule" {
+		return h.scheduleList(ctx, provider, cmd[2:])
+	}
+	if len(cmd) == 2 && cmd[1] == "gc" {
+		return h.collectGarbage(ctx, provider)
+	}
+	if len(cmd) == 2 && cmd[1] == "stats" {
+		return h.stats(ctx, provider, true)
+	}
+	if len(cmd) >= 2 && cmd[1] == "diff" {
+		return h.diff(ctx, provider, cmd[2:])
+	}
+	if len(cmd) >= 2 && cmd[1] == "sync" {
+		return h.sync(ctx, provider, cmd[2:])
+	}
+	if len(cmd) >= 2 && cmd[1] == "worktree" && (len(cmd) == 2 || cmd[2] == "list") {
+		return h.worktreeList(ctx, provider, cmd[2:])
+	}
+	if len(cmd) >= 2 && cmd[1] == "list" {
+		refs, err := h.list(ctx, provider, cmd[2:])
+		if err != nil {
+			return nil, err
+		}
+		if refs == nil {
+			refs = []GitReference{}
+		}
+		return refs, nil
+	}
+	return nil, h.Handle(ctx, provider, cmd)
+}
+
 // Save the backup using git.
 // If the server is running, then issue `save hold` and then run backup.
 // Once the backup is complete, issue `save resume`.
@@ -90,6 +228,14 @@ func (h *backupHandler) Save(ctx context.Context, provider Provider, msg string)
 	return h.save(ctx, provider, backupTypeManual, msg)
 }
 
+// SaveAutomatic takes a periodic backup without pruning the old ones.
+// Called by other modules.
+func (h *backupHandler) SaveAutomatic(ctx context.Context, provider Provider, msg string) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.save(ctx, provider, backupTypePeriodic, msg)
+}
+
 // Restore from backup.
 // To restore, working directory must be clean and server must NOT be running.
 func (h *backupHandler) Restore(ctx context.Context, provider Provider, args []string) error {
@@ -97,12 +243,12 @@ func (h *backupHandler) Restore(ctx context.Context, provider Provider, args []s
 	defer h.lock.Unlock()
 
 	if len(args) != 1 {
-		return fmt.Errorf("invalid args. Must specify HASH to restore. try help for syntax")
+		return invalidArgsErrorf("invalid args. Must specify HASH to restore. try help for syntax")
 	}
 	gitHash := args[0]
 
 	if provider.GetServerProcess().IsRunning() {
-		return fmt.Errorf("stop the server before restoring the backup")
+		return conflictErrorf("stop the server before restoring the backup")
 	}
 
 	isClean, err := provider.GitWrapper().IsDirClean(ctx)
@@ -110,12 +256,16 @@ func (h *backupHandler) Restore(ctx context.Context, provider Provider, args []s
 		return err
 	}
 	if !isClean {
-		return fmt.Errorf("there are changes since last backup. run 'backup save' or 'backup clean' to clean up")
+		return conflictErrorf("there are changes since last backup. run 'backup save' or 'backup clean' to clean up")
 	}
 
-	ctxTimeout, _ := context.WithTimeout(ctx, *commandTimeout)
-	_, err = provider.GitWrapper().RunGitCommand(ctxTimeout, "checkout", gitHash)
+	ctxTimeout, cancel := context.WithTimeout(ctx, *commandTimeout)
+	defer cancel()
+	out, err := provider.GitWrapper().RunGitCommand(ctxTimeout, "checkout", gitHash)
 	if err != nil {
+		if strings.Contains(out, "did not match any") {
+			return notFoundErrorf("backup %s not found", gitHash)
+		}
 		return err
 	}
 
@@ -124,13 +274,9 @@ func (h *backupHandler) Restore(ctx context.Context, provider Provider, args []s
 }
 
 // List recent backups.
-// Optionally accepts the max item count.
+// Optionally accepts the filters.
 func (h *backupHandler) List(ctx context.Context, provider Provider, args []string) error {
-	h.lock.Lock()
-	defer h.lock.Unlock()
-	var err error
-
-	branches, err := provider.GitWrapper().ListBranches(ctx, provider, args)
+	branches, err := h.list(ctx, provider, args)
 	if err != nil {
 		return err
 	}
@@ -139,26 +285,30 @@ func (h *backupHandler) List(ctx context.Context, provider Provider, args []stri
 	for _, b := range branches {
 		branchList = append(branchList, b.String())
 	}
-	provider.Printfln("%s", strings.Join(branchList, "\r\n"))
-	if err != nil {
-		return err
-	}
-
+	provider.Printfln("%s", strings.Join(branchList, winutils.NewLine()))
 	return nil
 }
 
+// list returns the backups matching the filters.
+func (h *backupHandler) list(ctx context.Context, provider Provider, args []string) ([]GitReference, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return provider.GitWrapper().ListBranches(ctx, provider, args)
+}
+
 // SetPeriod sets backup interval for periodic backup.
 func (h *backupHandler) SetPeriod(ctx context.Context, provider Provider, args []string) error {
 	h.lock.Lock()
 	defer h.lock.Unlock()
 
 	if len(args) != 1 {
-		return fmt.Errorf("invalid args. must specify INTERVAL. try 'help' for usage")
+		return invalidArgsErrorf("invalid args. must specify INTERVAL. try 'help' for usage")
 	}
 
 	interval, err := parseDuration(args[0])
 	if err != nil {
-		return fmt.Errorf("failed to set backup interval. %v", err)
+		return invalidArgsErrorf("failed to set backup interval. %v", err)
 	}
 
 	return h.setPeriod(ctx, provider, interval)
@@ -170,7 +320,7 @@ func (h *backupHandler) Clean(ctx context.Context, provider Provider, args []str
 	defer h.lock.Unlock()
 
 	if provider.GetServerProcess().IsRunning() {
-		return fmt.Errorf("cannot clean. server is running")
+		return conflictErrorf("cannot clean. server is running")
 	}
 
 	curCommit, err := provider.GitWrapper().GetCurrentHead(ctx)
@@ -192,13 +342,15 @@ func (h *backupHandler) Clean(ctx context.Context, provider Provider, args []str
 
 // Delete the specified backup
 // Wildcards are not supported
+// Pinned backups are deleted only with --force.
 func (h *backupHandler) Delete(ctx context.Context, provider Provider, args []string) error {
 	h.lock.Lock()
 	defer h.lock.Unlock()
 
 	var err error
+	force, args := parseFlag(args, "--force")
 	if len(args) == 0 {
-		return fmt.Errorf("must specify at least one branch to delete")
+		return invalidArgsErrorf("must specify at least one branch to delete")
 	}
 
 	branches, err := provider.GitWrapper().ListBranches(ctx, provider, args)
@@ -206,93 +358,244 @@ func (h *backupHandler) Delete(ctx context.Context, provider Provider, args []st
 		return err
 	}
 
-	return provider.GitWrapper().DeleteBranches(ctx, provider, branches)
+	deleted, err := provider.GitWrapper().DeleteBranches(ctx, provider, branches, force)
+	h.recordDeleted(ctx, provider, deleted)
+	if err != nil {
+		return err
+	}
+	h.requestSync()
+	return nil
+}
+
+// Pin protects the backup from deletion and pruning. If pin is false, the protection is removed.
+func (h *backupHandler) Pin(ctx context.Context, provider Provider, args []string, pin bool) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if len(args) != 1 {
+		return invalidArgsErrorf("invalid args. must specify the backup name. try 'help' for usage")
+	}
+	ref, err := findBackup(ctx, provider, args[0])
+	if err != nil {
+		return err
+	}
+
+	if ref.Pinned == pin {
+		if pin {
+			provider.Log(fmt.Sprintf("backup %s is already pinned", ref.Ref))
+		} else {
+			provider.Log(fmt.Sprintf("backup %s is not pinned", ref.Ref))
+		}
+		return nil
+	}
+	if pin {
+		if err := provider.GitWrapper().PinBranch(ctx, provider, *ref); err != nil {
+			return err
+		}
+		provider.Log(fmt.Sprintf("backup %s pinned", ref.Ref))
+		h.requestSync()
+		return nil
+	}
+	if err := provider.GitWrapper().UnpinBranch(ctx, provider, *ref); err != nil {
+		return err
+	}
+	provider.Log(fmt.Sprintf("backup %s unpinned", ref.Ref))
+	h.recordDeletedRefs(ctx, provider, pinRefPrefix+strings.TrimPrefix(ref.Ref, "refs/heads/"))
+	h.requestSync()
+	return nil
 }
 
 // Prune the backups
+// Without CUTOFF_TIME and INTERVAL, the retention policies are applied.
+// With --dry-run, the backups are listed instead of deleted.
 func (h *backupHandler) Prune(ctx context.Context, provider Provider, args []string) error {
 	h.lock.Lock()
 	defer h.lock.Unlock()
 
+	dryRun, args := parseDryRun(args)
+	force, args := parseFlag(args, "--force")
+	expired, err := h.pruneCandidates(ctx, provider, args, force)
+	if err != nil {
+		return err
+	}
+	if !dryRun {
+		return h.prune(ctx, provider, expired, force)
+	}
+	if len(expired) == 0 {
+		provider.Log("nothing to prune")
+		return nil
+	}
+	out := []string{"the following backups would be deleted:"}
+	for _, b := range expired {
+		out = append(out, b.String())
+	}
+	provider.Printfln("%s", strings.Join(out, winutils.NewLine()))
+	return nil
+}
+
+// pruneCandidates returns the backups to delete for the prune command.
+// Pinned backups are included only if force is true.
+// Must be called with the lock held.
+func (h *backupHandler) pruneCandidates(ctx context.Context, provider Provider, args []string, force bool) ([]GitReference, error) {
+	if len(args) == 0 {
+		return h.retentionCandidates(ctx, provider, force)
+	}
 	if len(args) != 2 {
-		return fmt.Errorf("invalid arguments. try 'help'")
+		return nil, invalidArgsErrorf("invalid arguments. try 'help'")
 	}
 	startTime, err := parseDuration(args[0])
 	if err != nil {
-		return fmt.Errorf("invalid start time. %v", err)
+		return nil, invalidArgsErrorf("invalid start time. %v", err)
 	}
 
 	pruneInterval, err := parseDuration(args[1])
 	if err != nil {
-		return fmt.Errorf("invalid interval. %v", err)
+		return nil, invalidArgsErrorf("invalid interval. %v", err)
 	}
+	return h.intervalCandidates(ctx, provider, startTime, pruneInterval, force)
+}
 
-	branches, err := provider.GitWrapper().ListBranches(ctx, provider, []string{"saves/periodic/*"})
-	if err != nil {
-		return err
+// parseDryRun removes --dry-run from the args.
+// Returns true if it was present.
+func parseDryRun(args []string) (bool, []string) {
+	return parseFlag(args, "--dry-run")
+}
+
+// parseFlag removes the flag from the args.
+// Returns true if it was present.
+func parseFlag(args []string, flag string) (bool, []string) {
+	var rest []string
+	found := false
+	for _, a := range args {
+		if a == flag {
+			found = true
+			continue
+		}
+		rest = append(rest, a)
 	}
-	// Sort by ascending order
-	sort.Slice(branches, func(i, j int) bool {
-		return branches[i].CommitDate.Before(branches[j].CommitDate)
-	})
-	prunedBranches, err := h.getDeletionCanditates(ctx, provider, branches, startTime, pruneInterval)
-	if err != nil {
-		return err
+	return found, rest
+}
+
+// BackupStatus is the backup part of the server status.
+type BackupStatus struct {
+	// Interval is the automatic backup interval. 0 if disabled.
+	Interval Duration `json:"interval"`
+	// OnlyWhenActive is true if periodic backups are skipped while no players are online.
+	OnlyWhenActive bool `json:"only_when_active"`
+}
+
+func (s BackupStatus) String() string {
+	if s.Interval == 0 {
+		return "automatic backup disabled"
+	}
+	if s.OnlyWhenActive {
+		return fmt.Sprintf("automatic backup interval: %v (only when players were online)", s.Interval)
 	}
-	return provider.GitWrapper().DeleteBranches(ctx, provider, prunedBranches)
+	return fmt.Sprintf("automatic backup interval: %v", s.Interval)
 }
 
 // Status returns the current backup status.
 // Called by other modules.
-func (h *backupHandler) Status(ctx context.Context, provider Provider) string {
-	output := ""
-	if h.backupInterval == 0 {
-		output += "automatic backup disabled"
-	} else {
-		output += fmt.Sprintf("automatic backup interval: %v", h.backupInterval)
+func (h *backupHandler) Status(ctx context.Context, provider Provider) BackupStatus {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return BackupStatus{
+		Interval:       Duration(h.backupInterval),
+		OnlyWhenActive: h.onlyWhenActive,
 	}
-
-	return output
 }
 
+// save takes the backup and publishes the backup events.
 func (h *backupHandler) save(ctx context.Context, provider Provider, bt backupType, msg string) error {
+	provider.Events().Publish(Event{Type: EventBackupStarted, Backup: &BackupEvent{Type: bt, Description: msg}})
+
+	h.activityLock.Lock()
+	h.saving = true
+	h.activityLock.Unlock()
+
+	start := h.nowFn()
+	branch, err := h.saveWorld(ctx, provider, bt, msg)
+	h.activityLock.Lock()
+	h.saving = false
+	if err == nil {
+		h.lastBackup = start
+	}
+	h.activityLock.Unlock()
+	if branch != "" {
+		h.requestSync()
+	}
+	ev := Event{
+		Type: EventBackupFinished,
+		Backup: &BackupEvent{
+			Type:        bt,
+			Description: msg,
+			Branch:      branch,
+			Skipped:     err == nil && branch == "",
+			Err:         err,
+		},
+	}
+	if err != nil {
+		ev.Type = EventBackupFailed
+	}
+	provider.Events().Publish(ev)
+	return err
+}
+
+// saveWorld backs up the world. If the server is running, saving is paused
+// during the backup. Returns the backup branch, or empty if the backup was skipped.
+func (h *backupHandler) saveWorld(ctx context.Context, provider Provider, bt backupType, msg string) (string, error) {
 	var err error
 	ch := make(chan string, 10)
 
 	if !provider.GetServerProcess().IsRunning() {
-		return h.backupWithGit(ctx, provider, bt, msg)
+		return h.backupWithGit(ctx, provider, bt, msg, nil)
 	}
 
 	provider.GetServerProcess().StartReadOutput(ch)
-	defer provider.GetServerProcess().EndReadOutput()
+	// The output must not be left unread during the backup. Publishing the output
+	// blocks on the full channel, which would stall the server while git runs.
+	reading := true
+	endReadOutput := func() {
+		if reading {
+			reading = false
+			provider.GetServerProcess().EndReadOutput(ch)
+		}
+	}
+	defer endReadOutput()
 
 	if err = provider.GetServerProcess().SendInput("save hold"); err != nil {
-		return fmt.Errorf("unable to communicate with bedrock server. %v", err)
+		return "", fmt.Errorf("unable to communicate with bedrock server. %v", err)
 	}
 	defer provider.GetServerProcess().SendInput("save resume")
 	time.Sleep(time.Millisecond * 250)
 
 	// Wait till server is ready for copy.
-	timeout, _ := context.WithTimeout(ctx, *commandTimeout)
+	timeout, cancel := context.WithTimeout(ctx, *commandTimeout)
+	defer cancel()
 	for {
 		select {
 		// Read the data from channel until we get ready message.
-		case l := <-ch:
+		case l, ok := <-ch:
+			if !ok {
+				return "", fmt.Errorf("server exited before the save completed")
+			}
 			glog.Infof("got from channel: %v", l)
 			if strings.Contains(l, backupSaveCompletedMarker) {
-				// Read the next line. This is the list of files
-				<-ch
-				if err = h.backupWithGit(ctx, provider, bt, msg); err != nil {
-					return err
+				// Read the next line. This is the list of files along with
+				// the lengths that are safe to copy.
+				files, err := parseSaveQueryFiles(<-ch)
+				if err != nil {
+					provider.Log(fmt.Sprintf("unable to parse saved file list. backing up all files. %v", err))
 				}
-				return nil
+				endReadOutput()
+				return h.backupWithGit(ctx, provider, bt, msg, files)
 			}
 		case <-timeout.Done():
-			return fmt.Errorf("timed out waiting for server. bailing out")
+			return "", fmt.Errorf("timed out waiting for server. bailing out")
 		default:
 			glog.Infof("waiting for save to be ready")
 			if err = provider.GetServerProcess().SendInput("save query"); err != nil {
-				return fmt.Errorf("unable to communicate with bedrock server. %v", err)
+				return "", fmt.Errorf("unable to communicate with bedrock server. %v", err)
 			}
 			time.Sleep(time.Millisecond * 500)
 		}
@@ -300,26 +603,37 @@ func (h *backupHandler) save(ctx context.Context, provider Provider, bt backupTy
 }
 
 // backupWithGit implements the backup logic.
-func (h *backupHandler) backupWithGit(ctx context.Context, provider Provider, bt backupType, description string) error {
+// If files is set, world files are backed up only up to their saved lengths.
+// Returns the backup branch, or empty if there was nothing to back up.
+func (h *backupHandler) backupWithGit(ctx context.Context, provider Provider, bt backupType, description string, files []savedFile) (string, error) {
 	var err error
 
 	isClean, err := provider.GitWrapper().IsDirClean(ctx)
 	if err != nil {
-		return err
+		return "", err
 	}
 	if isClean {
 		provider.Log("skipping backup. no dirty files")
-		return nil
+		return "", nil
 	}
 
-	ctxTimeout, _ := context.WithTimeout(ctx, *commandTimeout)
+	ctxTimeout, cancel := context.WithTimeout(ctx, *commandTimeout)
+	defer cancel()
 	out, err := provider.GitWrapper().RunGitCommand(ctxTimeout, "add", ".")
 	if err != nil {
 		provider.Log(out)
-		return err
+		return "", err
+	}
+
+	if len(files) > 0 {
+		if err = provider.GitWrapper().StageSavedFiles(ctx, h.worldsDir, files); err != nil {
+			provider.Log(fmt.Sprintf("backup failed. %v", err))
+			return "", err
+		}
 	}
 
-	ctxTimeout, _ = context.WithTimeout(ctx, *commandTimeout)
+	ctxTimeout, cancel = context.WithTimeout(ctx, *commandTimeout)
+	defer cancel()
 	if description == "" {
 		panic("backup description not set")
 	}
@@ -329,28 +643,27 @@ func (h *backupHandler) backupWithGit(ctx context.Context, provider Provider, bt
 	if err != nil {
 		provider.Log(out)
 		provider.Log(fmt.Sprintf("backup failed. %v", err))
-		return err
+		return "", err
 	}
 
 	out, err = provider.GitWrapper().RunGitCommand(ctxTimeout, "commit", "--allow-empty", "-m", description)
 	if err != nil {
 		provider.Log(out)
 		provider.Log(fmt.Sprintf("backup failed. %v", err))
-		return err
+		return "", err
 	}
 	provider.Log("backup success")
-	return nil
-
+	return branch, nil
 }
 
 // SetPeriod sets backup interval for periodic backup.
 func (h *backupHandler) setPeriod(ctx context.Context, provider Provider, interval time.Duration) error {
 	if interval < 0 {
-		return fmt.Errorf("backup period cannot be negative")
+		return invalidArgsErrorf("backup period cannot be negative")
 	}
 
 	if interval > 0 && interval < time.Second {
-		return fmt.Errorf("backup period cannot be shorter than a second")
+		return invalidArgsErrorf("backup period cannot be shorter than a second")
 	}
 
 	if !h.timer.Stop() {
@@ -371,21 +684,231 @@ func (h *backupHandler) periodicBackup(ctx context.Context, provider Provider) e
 	h.lock.Lock()
 	defer h.lock.Unlock()
 
-	return h.save(ctx, provider, backupTypePeriodic, "Automatic periodic backup")
+	if h.onlyWhenActive {
+		reason, ok := h.playersActive(provider)
+		if !ok {
+			provider.Log(fmt.Sprintf("skipping periodic backup. %s", reason))
+			return nil
+		}
+		provider.Log(fmt.Sprintf("taking periodic backup. %s", reason))
+	}
+	return h.autoBackup(ctx, provider, backupTypePeriodic, "Automatic periodic backup")
+}
+
+// autoBackup takes the automatic backup and prunes the old ones.
+// Must be called with the lock held.
+func (h *backupHandler) autoBackup(ctx context.Context, provider Provider, bt backupType, msg string) error {
+	if err := h.save(ctx, provider, bt, msg); err != nil {
+		return err
+	}
+
+	if *autoPruneCutoff > 0 && *autoPruneInterval > 0 {
+		expired, err := h.intervalCandidates(ctx, provider, *autoPruneCutoff, *autoPruneInterval, false)
+		if err != nil {
+			return err
+		}
+		if err = h.prune(ctx, provider, expired, false); err != nil {
+			return err
+		}
+	}
+	if len(h.cfg.BackupRetention()) > 0 {
+		expired, err := h.retentionCandidates(ctx, provider, false)
+		if err != nil {
+			return err
+		}
+		return h.prune(ctx, provider, expired, false)
+	}
+	return nil
+}
+
+// prune deletes the given backups. Pinned backups are deleted only if force is true.
+func (h *backupHandler) prune(ctx context.Context, provider Provider, expired []GitReference, force bool) error {
+	if len(expired) == 0 {
+		provider.Log("nothing to prune")
+		return nil
+	}
+	deleted, err := provider.GitWrapper().DeleteBranches(ctx, provider, expired, force)
+	h.recordDeleted(ctx, provider, deleted)
+	if err != nil {
+		return err
+	}
+	h.requestSync()
+	return nil
+}
+
+// withoutPinned returns the backups that are not pinned. The pinned backups are
+// pruned only with --force. If force is true, all the backups are returned.
+func withoutPinned(backups []GitReference, force bool) []GitReference {
+	if force {
+		return backups
+	}
+	var result []GitReference
+	for _, b := range backups {
+		if !b.Pinned {
+			result = append(result, b)
+		}
+	}
+	return result
+}
+
+// intervalCandidates returns the periodic backups older than the cutoff, keeping one backup per interval.
+// Pinned backups are included only if force is true.
+func (h *backupHandler) intervalCandidates(ctx context.Context, provider Provider, cutoff, pruneInterval time.Duration, force bool) ([]GitReference, error) {
+	branches, err := provider.GitWrapper().ListBranches(ctx, provider, []string{"saves/periodic/*"})
+	if err != nil {
+		return nil, err
+	}
+	// Sort by ascending order
+	sort.Slice(branches, func(i, j int) bool {
+		return branches[i].CommitDate.Before(branches[j].CommitDate)
+	})
+	expired, err := h.getDeletionCanditates(ctx, provider, branches, cutoff, pruneInterval)
+	if err != nil {
+		return nil, err
+	}
+	return withoutPinned(expired, force), nil
+}
+
+// retentionCandidates returns the backups not kept by the retention policies, oldest first.
+// Pinned backups are included only if force is true.
+func (h *backupHandler) retentionCandidates(ctx context.Context, provider Provider, force bool) ([]GitReference, error) {
+	policies := map[backupType]*retentionPolicy{}
+	for bt, rc := range h.cfg.BackupRetention() {
+		p, err := newRetentionPolicy(rc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retention policy for '%s'. %v", bt, err)
+		}
+		policies[backupType(bt)] = p
+	}
+	if len(policies) == 0 {
+		return nil, invalidArgsErrorf("no retention policies. add backup_retention to the config file or specify CUTOFF_TIME and INTERVAL")
+	}
+
+	branches, err := provider.GitWrapper().ListBranches(ctx, provider, []string{"saves/*"})
+	if err != nil {
+		return nil, err
+	}
+	byType := map[backupType][]GitReference{}
+	for _, b := range branches {
+		if bt := backupTypeOf(b.Ref); bt != "" {
+			byType[bt] = append(byType[bt], b)
+		}
+	}
+
+	var result []GitReference
+	for bt, backups := range byType {
+		p, ok := policies[bt]
+		if !ok && bt != backupTypeManual && bt != backupTypeTemp && bt != backupTypeImported {
+			p, ok = policies[retentionDefaultKey]
+		}
+		if !ok {
+			continue
+		}
+		glog.Infof("applying retention policy for %s: %v", bt, p)
+		result = append(result, withoutPinned(p.expired(backups, h.nowFn()), force)...)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CommitDate.Before(result[j].CommitDate)
+	})
+	return result, nil
+}
+
+// playersActive returns true if a player was online since the last backup,
+// along with the reason for the decision.
+func (h *backupHandler) playersActive(provider Provider) (string, bool) {
+	if count := onlinePlayerCount(provider); count > 0 {
+		return fmt.Sprintf("%d players online", count), true
+	}
+
+	h.activityLock.Lock()
+	defer h.activityLock.Unlock()
+	if h.lastBackup.IsZero() {
+		return "no backup taken since start", true
+	}
+	if h.lastActivity.After(h.lastBackup) {
+		return "players were online since the last backup", true
+	}
+	return "no players online since the last backup", false
+}
+
+// onPlayerEvent records the player activity. When the last player leaves,
+// the backup loop is asked to take the final backup, so the event subscriber
+// never waits for a backup.
+func (h *backupHandler) onPlayerEvent(ctx context.Context, provider Provider, ev Event) {
+	h.activityLock.Lock()
+	if ev.Time.After(h.lastActivity) {
+		h.lastActivity = ev.Time
+	}
+	h.activityLock.Unlock()
+
+	if ev.Type != EventPlayerLeft || onlinePlayerCount(provider) > 0 {
+		return
+	}
+	select {
+	case h.lastPlayerLeft <- ev.Time:
+	default:
+		glog.Infof("backup after the last player left already requested")
+	}
+}
+
+// lastPlayerLeftBackup takes the final backup after the last player left at the given time.
+func (h *backupHandler) lastPlayerLeftBackup(ctx context.Context, provider Provider, left time.Time) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if !h.onlyWhenActive || h.backupInterval == 0 {
+		return
+	}
+	h.activityLock.Lock()
+	backedUp := h.lastBackup.After(left)
+	h.activityLock.Unlock()
+	if backedUp {
+		provider.Log("skipping backup. already backed up after the last player left")
+		return
+	}
+	provider.Log("taking backup. last player left")
+	if err := h.autoBackup(ctx, provider, backupTypePeriodic, "Automatic backup after the last player left"); err != nil {
+		provider.Log(fmt.Sprintf("backup failed. %v", err))
+	}
+}
+
+// runActivityLoop tracks the player activity until the subscription is cancelled.
+func (h *backupHandler) runActivityLoop(ctx context.Context, provider Provider, sub *Subscription) {
+	for {
+		select {
+		case ev := <-sub.C:
+			h.onPlayerEvent(ctx, provider, ev)
+		case <-sub.Done():
+			return
+		}
+	}
+}
+
+// onlinePlayerCount returns the number of online players.
+func onlinePlayerCount(provider Provider) int {
+	phI, err := provider.GetHandler("players")
+	if err != nil {
+		return 0
+	}
+	return phI.(*playersHandler).Count()
 }
 
 // runBackupLoop runs the main backup loop.
+// Takes the periodic backups and the backups after the last player left.
 func (h *backupHandler) runBackupLoop(ctx context.Context, prov Provider) {
 	for {
-		_, more := <-h.timer.C
-		h.periodicBackup(context.Background(), prov)
-		if !more {
-			// Channel closed.
-			glog.Infof("periodic backup ending")
-			return
+		select {
+		case _, more := <-h.timer.C:
+			h.periodicBackup(context.Background(), prov)
+			if !more {
+				// Channel closed.
+				glog.Infof("periodic backup ending")
+				return
+			}
+			// Restart timer
+			h.timer.Reset(h.backupInterval)
+		case left := <-h.lastPlayerLeft:
+			h.lastPlayerLeftBackup(context.Background(), prov, left)
 		}
-		// Restart timer
-		h.timer.Reset(h.backupInterval)
 	}
 }
 
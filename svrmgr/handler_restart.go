@@ -0,0 +1,360 @@
+package svrmgr
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+var restartTimes = flag.String("restart_times", "", "comma separated times of day (HH:MM) to restart the server. empty to disable scheduled restarts")
+var restartWarning = flag.Duration("restart_warning", time.Minute*10, "players are warned this long before a scheduled restart")
+
+// timeOfDay is the time of day for the scheduled restarts.
+type timeOfDay struct {
+	hour   int
+	minute int
+}
+
+func (t timeOfDay) String() string {
+	return fmt.Sprintf("%02d:%02d", t.hour, t.minute)
+}
+
+// parseTimeOfDay parses the HH:MM time.
+func parseTimeOfDay(str string) (timeOfDay, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(str))
+	if err != nil {
+		return timeOfDay{}, invalidArgsErrorf("invalid time of day '%s'. must be HH:MM", str)
+	}
+	return timeOfDay{t.Hour(), t.Minute()}, nil
+}
+
+// parseTimesOfDay parses the comma separated list of HH:MM times.
+func parseTimesOfDay(str string) ([]timeOfDay, error) {
+	var times []timeOfDay
+	for _, s := range strings.Split(str, ",") {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		t, err := parseTimeOfDay(s)
+		if err != nil {
+			return nil, err
+		}
+		times = append(times, t)
+	}
+	sort.Slice(times, func(i, j int) bool {
+		return times[i].String() < times[j].String()
+	})
+	return times, nil
+}
+
+// next returns the first occurrence of the time of day after the given time.
+func (t timeOfDay) next(after time.Time) time.Time {
+	after = after.Local()
+	at := time.Date(after.Year(), after.Month(), after.Day(), t.hour, t.minute, 0, 0, time.Local)
+	if !at.After(after) {
+		at = time.Date(after.Year(), after.Month(), after.Day()+1, t.hour, t.minute, 0, 0, time.Local)
+	}
+	return at
+}
+
+// restartHandler restarts the server at the scheduled times.
+// Players are warned before the restart and a backup is taken before stopping.
+type restartHandler struct {
+	lock       sync.Mutex
+	times      []timeOfDay        // Daily restart times.
+	warning    time.Duration      // Countdown before the scheduled restarts.
+	next       time.Time          // Next restart. Zero if none.
+	oneOff     bool               // True if the next restart was scheduled by `restart at`.
+	cancel     context.CancelFunc // Cancels the pending restart. nil if none.
+	inProgress bool               // True while restarting.
+	nowFn      func() time.Time
+	afterFn    func(d time.Duration) <-chan time.Time
+}
+
+// initRestartHandler initializes the restart plugin and schedules the first restart.
+func initRestartHandler(provider Provider, cfg *config) {
+	h := &restartHandler{
+		warning: *restartWarning,
+		nowFn:   time.Now,
+		afterFn: time.After,
+	}
+	times, err := parseTimesOfDay(*restartTimes)
+	if err != nil {
+		glog.Errorf("%v. scheduled restarts disabled", err)
+	}
+	h.setTimes(provider, times)
+
+	cfg.OnReload("restart_warning", func(provider Provider, value interface{}) {
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		h.warning = value.(time.Duration)
+	})
+	cfg.OnReload("restart_times", func(provider Provider, value interface{}) {
+		times, err := parseTimesOfDay(value.(string))
+		if err != nil {
+			provider.Log(fmt.Sprintf("unable to apply restart_times. %v", err))
+			return
+		}
+		h.setTimes(provider, times)
+	})
+	provider.Register("restart", h)
+}
+
+// Handle handles the restart sub commands.
+func (h *restartHandler) Handle(ctx context.Context, provider Provider, cmd []string) error {
+	if len(cmd) < 2 || cmd[1] == "status" {
+		provider.Log(h.Status(ctx, provider).String())
+		return nil
+	}
+	switch cmd[1] {
+	case "now":
+		return h.Now(ctx, provider, cmd[2:])
+	case "at":
+		return h.At(ctx, provider, cmd[2:])
+	case "cancel":
+		return h.Cancel(ctx, provider)
+	default:
+		return invalidArgsErrorf("unknown command. try help")
+	}
+}
+
+// HandleResult returns the RestartStatus for the status command.
+func (h *restartHandler) HandleResult(ctx context.Context, provider Provider, cmd []string) (interface{}, error) {
+	if len(cmd) < 2 || cmd[1] == "status" {
+		return h.Status(ctx, provider), nil
+	}
+	return nil, h.Handle(ctx, provider, cmd)
+}
+
+// Now restarts the server immediately.
+// Optionally accepts the warning period to announce to players before restarting.
+// The countdown runs in the background, so that the console stays usable and `restart cancel` can stop it.
+func (h *restartHandler) Now(ctx context.Context, provider Provider, args []string) error {
+	var warning time.Duration
+	if len(args) > 0 {
+		var err error
+		if warning, err = parseDuration(args[0]); err != nil {
+			return invalidArgsErrorf("invalid warning period. %v", err)
+		}
+	}
+	if warning == 0 {
+		return h.restart(ctx, provider, 0)
+	}
+	if !provider.GetServerProcess().IsRunning() {
+		return conflictErrorf("server not running")
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.inProgress {
+		return conflictErrorf("restart already in progress")
+	}
+	h.scheduleLocked(provider, h.nowFn().Add(warning), true, warning)
+	provider.Log(fmt.Sprintf("server restart in %v. run 'restart cancel' to cancel", warning))
+	return nil
+}
+
+// At schedules a one time restart at the next occurrence of the given time of day.
+// Replaces the next scheduled restart.
+func (h *restartHandler) At(ctx context.Context, provider Provider, args []string) error {
+	if len(args) != 1 {
+		return invalidArgsErrorf("invalid args. must specify HH:MM. try 'help' for usage")
+	}
+	t, err := parseTimeOfDay(args[0])
+	if err != nil {
+		return err
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.scheduleLocked(provider, t.next(h.nowFn()), true, h.warning)
+	provider.Log(fmt.Sprintf("server restart scheduled at %s", h.next.Format("20060102-15:04")))
+	return nil
+}
+
+// Cancel cancels the next restart. Daily restarts continue from the following scheduled time.
+func (h *restartHandler) Cancel(ctx context.Context, provider Provider) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.next.IsZero() {
+		return notFoundErrorf("no restart scheduled")
+	}
+	cancelled := h.next
+	after := cancelled
+	if h.oneOff {
+		after = h.nowFn()
+	}
+	h.scheduleLocked(provider, h.nextDailyLocked(after), false, h.warning)
+
+	msg := fmt.Sprintf("restart at %s cancelled", cancelled.Format("20060102-15:04"))
+	if !h.next.IsZero() {
+		msg += fmt.Sprintf(". next restart at %s", h.next.Format("20060102-15:04"))
+	}
+	provider.Log(msg)
+	return nil
+}
+
+// RestartStatus is the scheduled restart part of the server status.
+type RestartStatus struct {
+	Times []string   `json:"times"` // Daily restart times.
+	Next  *time.Time `json:"next"`  // Next restart. nil if none.
+}
+
+func (s RestartStatus) String() string {
+	if s.Next == nil {
+		return "no restart scheduled"
+	}
+	return fmt.Sprintf("next restart at %s", s.Next.Local().Format("20060102-15:04"))
+}
+
+// Status returns the scheduled restart status.
+// Called by other modules.
+func (h *restartHandler) Status(ctx context.Context, provider Provider) RestartStatus {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	status := RestartStatus{Times: []string{}}
+	for _, t := range h.times {
+		status.Times = append(status.Times, t.String())
+	}
+	if !h.next.IsZero() {
+		next := h.next
+		status.Next = &next
+	}
+	return status
+}
+
+// setTimes sets the daily restart times and schedules the next restart.
+func (h *restartHandler) setTimes(provider Provider, times []timeOfDay) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.times = times
+	h.scheduleLocked(provider, h.nextDailyLocked(h.nowFn()), false, h.warning)
+	if !h.next.IsZero() {
+		provider.Log(fmt.Sprintf("next server restart at %s", h.next.Format("20060102-15:04")))
+	}
+}
+
+// nextDailyLocked returns the first daily restart after the given time. Zero if none.
+// Must be called with the lock held.
+func (h *restartHandler) nextDailyLocked(after time.Time) time.Time {
+	var next time.Time
+	for _, t := range h.times {
+		if at := t.next(after); next.IsZero() || at.Before(next) {
+			next = at
+		}
+	}
+	return next
+}
+
+// scheduleLocked replaces the pending restart. Nothing is scheduled if at is zero.
+// Players are warned for the warning period before the restart.
+// Must be called with the lock held.
+func (h *restartHandler) scheduleLocked(provider Provider, at time.Time, oneOff bool, warning time.Duration) {
+	if h.cancel != nil {
+		h.cancel()
+		h.cancel = nil
+	}
+	h.next = at
+	h.oneOff = oneOff
+	if at.IsZero() {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h.cancel = cancel
+	go h.waitAndRestart(ctx, provider, at, warning)
+}
+
+// waitAndRestart restarts the server at the given time unless cancelled,
+// then schedules the next daily restart.
+func (h *restartHandler) waitAndRestart(ctx context.Context, provider Provider, at time.Time, warning time.Duration) {
+	select {
+	case <-h.afterFn(at.Sub(h.nowFn()) - warning):
+	case <-ctx.Done():
+		glog.Infof("scheduled restart at %v cancelled", at)
+		return
+	}
+
+	remaining := at.Sub(h.nowFn())
+	if remaining > warning {
+		remaining = warning
+	}
+	err := h.restart(ctx, provider, remaining)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		provider.Log(fmt.Sprintf("scheduled restart failed. %v", err))
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.next.Equal(at) {
+		h.scheduleLocked(provider, h.nextDailyLocked(at), false, h.warning)
+	}
+}
+
+// restart warns the players, backs up the world, stops the server and starts it again.
+// Only the countdown can be cancelled through ctx.
+func (h *restartHandler) restart(ctx context.Context, provider Provider, warning time.Duration) error {
+	h.lock.Lock()
+	if h.inProgress {
+		h.lock.Unlock()
+		return conflictErrorf("restart already in progress")
+	}
+	h.inProgress = true
+	h.lock.Unlock()
+	defer func() {
+		h.lock.Lock()
+		h.inProgress = false
+		h.lock.Unlock()
+	}()
+
+	proc := provider.GetServerProcess()
+	if !proc.IsRunning() {
+		return conflictErrorf("server not running")
+	}
+
+	if warning > 0 {
+		if err := broadcastCountdown(ctx, proc, warning, "restarting"); err != nil {
+			if ctx.Err() != nil {
+				proc.SendInput("say Server restart cancelled")
+			}
+			return err
+		}
+	}
+
+	// Once the countdown is over, the restart runs to completion.
+	ctx = context.Background()
+	provider.Log("restarting server")
+	if bhI, err := provider.GetHandler("backup"); err == nil {
+		if err = bhI.(*backupHandler).SaveAutomatic(ctx, provider, "Automatic backup before restart"); err != nil {
+			provider.Log(fmt.Sprintf("backup before restart failed. %v", err))
+		}
+	}
+
+	// Restart overrides any pending automatic restart.
+	if shI, err := provider.GetHandler("supervisor"); err == nil {
+		shI.(*supervisorHandler).cancelRestart()
+	}
+	if err := proc.Stop(ctx, *stopTimeout); err != nil {
+		return fmt.Errorf("unable to stop server. %v", err)
+	}
+	start, err := provider.GetHandler("start")
+	if err != nil {
+		return err
+	}
+	if err = start.Handle(ctx, provider, []string{"start"}); err != nil {
+		return fmt.Errorf("unable to start server. %v", err)
+	}
+	return nil
+}
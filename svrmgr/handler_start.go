@@ -8,6 +8,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/golang/glog"
 )
@@ -15,15 +16,17 @@ import (
 // startHandler - start bedrock server.
 type startHandler struct {
 	bedrockPath string
+	lock        *sync.Mutex // Shared with the stop handler.
 }
 
 var serverOutputMarker = "INFO] IPv6 supported, port:"
 
-var bedrockServerExecutable = flag.String("bedrock_exe", "bedrock_server.exe", "Bedrock executable path. Defaults to current directory")
+var bedrockServerExecutable = flag.String("bedrock_exe", defaultBedrockExecutable, "Bedrock executable path. Defaults to current directory")
 
-func initStartHandler(provider Provider) {
+func initStartHandler(provider Provider, lock *sync.Mutex) {
 	provider.Register("start", &startHandler{
 		bedrockPath: getBedrockServerPath(),
+		lock:        lock,
 	})
 }
 
@@ -34,7 +37,9 @@ var bedrockPath string
 func getBedrockServerPath() string {
 	if bedrockPath == "" {
 		exePath := *bedrockServerExecutable
-		if !filepath.IsAbs(exePath) {
+		if filepath.IsAbs(exePath) {
+			bedrockPath = exePath
+		} else {
 			st, err := os.Stat(filepath.Join(".", *bedrockServerExecutable))
 			if err == nil && !st.IsDir() {
 				wd, _ := os.Getwd()
@@ -54,9 +59,11 @@ func getBedrockServerPath() string {
 
 // Handle - starts the server and waits for specific marker messages.
 func (h *startHandler) Handle(ctx context.Context, provider Provider, command []string) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
 
 	if provider.GetServerProcess().IsRunning() {
-		return fmt.Errorf("server already running")
+		return conflictErrorf("server already running")
 	}
 
 	glog.Infof("initializing server")
@@ -65,7 +72,7 @@ func (h *startHandler) Handle(ctx context.Context, provider Provider, command []
 
 	ch := make(chan string)
 	proc.StartReadOutput(ch)
-	defer proc.EndReadOutput()
+	defer proc.EndReadOutput(ch)
 
 	glog.Infof("starting server")
 	err := proc.Start(ctx, provider)
@@ -86,6 +93,7 @@ func (h *startHandler) Handle(ctx context.Context, provider Provider, command []
 			count += 1
 			if count == 2 {
 				glog.Infof("server started successfully")
+				provider.Events().Publish(Event{Type: EventServerStarted})
 				return nil
 			}
 		}
@@ -2,24 +2,93 @@ package svrmgr
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
 )
 
+var stopTimeout = flag.Duration("server_stop_timeout", time.Second*30, "time to wait for the server to shut down before killing it")
+var stopWarning = flag.Duration("server_stop_warning", 0, "if set, players are warned this long before the server is stopped")
+
+// countdownMarks are the remaining times at which players are warned.
+var countdownMarks = []time.Duration{
+	time.Minute * 10,
+	time.Minute * 5,
+	time.Minute,
+	time.Second * 30,
+	time.Second * 10,
+}
+
 // stopHandler - Stop running server.
-type stopHandler struct{}
+type stopHandler struct {
+	lock *sync.Mutex // Shared with the start handler. Not held during the countdown.
+}
 
-func initStopHandler(provider Provider) {
-	provider.Register("stop", &stopHandler{})
+func initStopHandler(provider Provider, lock *sync.Mutex) {
+	provider.Register("stop", &stopHandler{
+		lock: lock,
+	})
 }
 
+// Handle stops the server gracefully.
+// Optionally accepts the warning period to announce to players before stopping.
 func (h *stopHandler) Handle(ctx context.Context, provider Provider, cmd []string) error {
 	var err error
 	proc := provider.GetServerProcess()
 	if proc == nil {
-		return fmt.Errorf("server not started")
+		return conflictErrorf("server not started")
+	}
+
+	warning := *stopWarning
+	if len(cmd) > 1 {
+		if warning, err = parseDuration(cmd[1]); err != nil {
+			return invalidArgsErrorf("invalid warning period. %v", err)
+		}
+	}
+
+	// Explicit stop overrides any pending automatic restart.
+	if shI, err := provider.GetHandler("supervisor"); err == nil {
+		shI.(*supervisorHandler).cancelRestart()
 	}
-	if err = proc.Kill(); err != nil {
-		return fmt.Errorf("unable to stop server")
+
+	if warning > 0 && proc.IsRunning() {
+		if err = broadcastCountdown(ctx, proc, warning, "stopping"); err != nil {
+			return err
+		}
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if err = proc.Stop(ctx, *stopTimeout); err != nil {
+		return fmt.Errorf("unable to stop server. %v", err)
+	}
+	return nil
+}
+
+// broadcastCountdown announces the upcoming action to the players and
+// returns once the given duration has elapsed.
+func broadcastCountdown(ctx context.Context, proc ServerProcess, remaining time.Duration, action string) error {
+	marks := []time.Duration{remaining}
+	for _, m := range countdownMarks {
+		if m < remaining {
+			marks = append(marks, m)
+		}
+	}
+	marks = append(marks, 0)
+
+	for i, m := range marks[:len(marks)-1] {
+		glog.Infof("countdown: server %s in %v", action, m)
+		if err := proc.SendInput(fmt.Sprintf("say Server %s in %v", action, m)); err != nil {
+			return fmt.Errorf("unable to warn players. %v", err)
+		}
+		select {
+		case <-time.After(m - marks[i+1]):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
 	return nil
 }
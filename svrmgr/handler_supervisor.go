@@ -0,0 +1,311 @@
+package svrmgr
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fieryorc/BedrockServerManager/winutils"
+	"github.com/golang/glog"
+)
+
+var restartPolicyFlag = flag.String("restart_policy", string(restartPolicyOnFailure), "when to restart the server after it exits. one of never, on-failure, always")
+var restartMaxCrashes = flag.Int("restart_max_crashes", 5, "stop restarting the server after this many crashes within restart_crash_window")
+var restartCrashWindow = flag.Duration("restart_crash_window", time.Minute*10, "window used for crash loop protection")
+var restartBackoff = flag.Duration("restart_backoff", time.Second*5, "delay before the first restart. doubled for every crash within restart_crash_window")
+var restartBackoffMax = flag.Duration("restart_backoff_max", time.Minute*5, "max delay before restarting the server")
+
+// maxCrashRecords is the number of crashes remembered for reporting.
+const maxCrashRecords = 20
+
+type restartPolicy string
+
+const (
+	// restartPolicyNever - never restart the server automatically.
+	restartPolicyNever restartPolicy = "never"
+	// restartPolicyOnFailure - restart only if the server crashed.
+	restartPolicyOnFailure restartPolicy = "on-failure"
+	// restartPolicyAlways - restart whenever the server exits without being stopped by the manager.
+	restartPolicyAlways restartPolicy = "always"
+)
+
+// parseRestartPolicy validates the restart policy string.
+func parseRestartPolicy(str string) (restartPolicy, error) {
+	switch p := restartPolicy(str); p {
+	case restartPolicyNever, restartPolicyOnFailure, restartPolicyAlways:
+		return p, nil
+	default:
+		return "", invalidArgsErrorf("invalid restart policy '%s'. must be one of never, on-failure, always", str)
+	}
+}
+
+// supervisorHandler watches the server and restarts it when it exits unexpectedly.
+type supervisorHandler struct {
+	lock    sync.Mutex
+	policy  restartPolicy
+	crashes []ServerExit  // Most recent crashes, oldest first.
+	gaveUp  bool          // True if the crash loop protection kicked in.
+	pending chan struct{} // Closed to cancel the pending restart. nil if none.
+	nowFn   func() time.Time
+	afterFn func(d time.Duration) <-chan time.Time
+}
+
+// initSupervisorHandler initializes the supervisor plugin.
+func initSupervisorHandler(provider Provider, cfg *config) {
+	policy, err := parseRestartPolicy(*restartPolicyFlag)
+	if err != nil {
+		glog.Errorf("%v. restart disabled", err)
+		policy = restartPolicyNever
+	}
+
+	h := &supervisorHandler{
+		policy:  policy,
+		nowFn:   time.Now,
+		afterFn: time.After,
+	}
+	cfg.OnReload("restart_policy", func(provider Provider, value interface{}) {
+		if err := h.SetPolicy(context.Background(), provider, []string{value.(string)}); err != nil {
+			provider.Log(fmt.Sprintf("unable to apply restart_policy. %v", err))
+		}
+	})
+	provider.Register("supervisor", h)
+}
+
+// Handle handles the supervisor sub commands.
+func (h *supervisorHandler) Handle(ctx context.Context, provider Provider, cmd []string) error {
+	if len(cmd) < 2 || cmd[1] == "status" {
+		provider.Log(h.Status(ctx, provider).String())
+		return nil
+	}
+	switch cmd[1] {
+	case "policy":
+		return h.SetPolicy(ctx, provider, cmd[2:])
+	case "crashes":
+		return h.Crashes(ctx, provider, cmd[2:])
+	case "reset":
+		return h.Reset(ctx, provider)
+	default:
+		return invalidArgsErrorf("unknown command. try help")
+	}
+}
+
+// HandleResult returns the SupervisorStatus for the status command.
+func (h *supervisorHandler) HandleResult(ctx context.Context, provider Provider, cmd []string) (interface{}, error) {
+	if len(cmd) < 2 || cmd[1] == "status" {
+		return h.Status(ctx, provider), nil
+	}
+	return nil, h.Handle(ctx, provider, cmd)
+}
+
+// SetPolicy changes the restart policy.
+func (h *supervisorHandler) SetPolicy(ctx context.Context, provider Provider, args []string) error {
+	if len(args) != 1 {
+		return invalidArgsErrorf("invalid args. must specify POLICY. try 'help' for usage")
+	}
+	policy, err := parseRestartPolicy(args[0])
+	if err != nil {
+		return err
+	}
+
+	h.lock.Lock()
+	h.policy = policy
+	h.lock.Unlock()
+	if policy == restartPolicyNever {
+		h.cancelRestart()
+	}
+	provider.Log(fmt.Sprintf("restart policy set to %s", policy))
+	return nil
+}
+
+// Crashes prints the recorded crashes along with the last server output.
+// Optionally accepts the max crash count.
+func (h *supervisorHandler) Crashes(ctx context.Context, provider Provider, args []string) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	count := len(h.crashes)
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 0 {
+			return invalidArgsErrorf("invalid crash count '%s'", args[0])
+		}
+		if n < count {
+			count = n
+		}
+	}
+
+	if len(h.crashes) == 0 {
+		provider.Log("no crashes recorded")
+		return nil
+	}
+
+	var out []string
+	for _, c := range h.crashes[len(h.crashes)-count:] {
+		out = append(out, fmt.Sprintf("crash at %s: %v", c.Time.Local().Format("20060102-15:04:05"), c.Err))
+		for _, l := range c.LastLines {
+			out = append(out, fmt.Sprintf("    [%s] %s", l.Time.Local().Format("20060102-15:04:05"), l.Line))
+		}
+	}
+	provider.Printfln("%s", strings.Join(out, winutils.NewLine()))
+	return nil
+}
+
+// Reset clears the crash history and re-enables restarts.
+func (h *supervisorHandler) Reset(ctx context.Context, provider Provider) error {
+	h.lock.Lock()
+	h.crashes = nil
+	h.gaveUp = false
+	h.lock.Unlock()
+
+	provider.Log("crash history cleared")
+	return nil
+}
+
+// SupervisorStatus is the supervisor part of the server status.
+type SupervisorStatus struct {
+	Policy         restartPolicy `json:"policy"`
+	RecentCrashes  int           `json:"recent_crashes"` // Crashes within the crash window.
+	CrashWindow    Duration      `json:"crash_window"`
+	Suspended      bool          `json:"suspended"` // True if restarts are suspended after repeated crashes.
+	RestartPending bool          `json:"restart_pending"`
+}
+
+func (s SupervisorStatus) String() string {
+	output := fmt.Sprintf("restart policy: %s", s.Policy)
+	if s.RecentCrashes > 0 {
+		output += fmt.Sprintf(" (%d crashes in last %v)", s.RecentCrashes, s.CrashWindow)
+	}
+	if s.Suspended {
+		output += " (restart suspended after repeated crashes)"
+	} else if s.RestartPending {
+		output += " (restart pending)"
+	}
+	return output
+}
+
+// Status returns the current supervisor status.
+// Called by other modules.
+func (h *supervisorHandler) Status(ctx context.Context, provider Provider) SupervisorStatus {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return SupervisorStatus{
+		Policy:         h.policy,
+		RecentCrashes:  h.recentCrashCount(),
+		CrashWindow:    Duration(*restartCrashWindow),
+		Suspended:      h.gaveUp,
+		RestartPending: h.pending != nil,
+	}
+}
+
+// onServerExit is called when the server process exits.
+func (h *supervisorHandler) onServerExit(provider Provider, exit ServerExit) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if exit.IsCrash() {
+		h.crashes = append(h.crashes, exit)
+		if len(h.crashes) > maxCrashRecords {
+			h.crashes = h.crashes[len(h.crashes)-maxCrashRecords:]
+		}
+	}
+
+	if !h.shouldRestart(exit) {
+		return
+	}
+
+	recent := h.recentCrashCount()
+	if exit.IsCrash() && recent >= *restartMaxCrashes {
+		h.gaveUp = true
+		provider.Log(fmt.Sprintf("server crashed %d times in %v. not restarting. run 'supervisor reset' to re-enable", recent, *restartCrashWindow))
+		return
+	}
+
+	delay := restartDelay(recent)
+	provider.Log(fmt.Sprintf("restarting server in %v", delay))
+
+	h.cancelRestartLocked()
+	cancel := make(chan struct{})
+	h.pending = cancel
+	go h.restart(provider, delay, cancel)
+}
+
+// shouldRestart returns true if the policy requires restarting after the exit.
+// Must be called with the lock held.
+func (h *supervisorHandler) shouldRestart(exit ServerExit) bool {
+	if exit.Intentional || h.gaveUp {
+		return false
+	}
+	switch h.policy {
+	case restartPolicyAlways:
+		return true
+	case restartPolicyOnFailure:
+		return exit.IsCrash()
+	default:
+		return false
+	}
+}
+
+// restart waits for the delay and starts the server unless cancelled.
+func (h *supervisorHandler) restart(provider Provider, delay time.Duration, cancel chan struct{}) {
+	select {
+	case <-h.afterFn(delay):
+	case <-cancel:
+		glog.Infof("pending restart cancelled")
+		return
+	}
+
+	h.lock.Lock()
+	if h.pending == cancel {
+		h.pending = nil
+	}
+	h.lock.Unlock()
+
+	glog.Infof("restarting server")
+	provider.RunCommand(context.Background(), "start")
+}
+
+// cancelRestart cancels the pending restart, if any.
+func (h *supervisorHandler) cancelRestart() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.cancelRestartLocked()
+}
+
+// cancelRestartLocked cancels the pending restart.
+// Must be called with the lock held.
+func (h *supervisorHandler) cancelRestartLocked() {
+	if h.pending != nil {
+		close(h.pending)
+		h.pending = nil
+	}
+}
+
+// recentCrashCount returns the number of crashes within the crash window.
+// Must be called with the lock held.
+func (h *supervisorHandler) recentCrashCount() int {
+	cutoff := h.nowFn().Add(-*restartCrashWindow)
+	count := 0
+	for _, c := range h.crashes {
+		if c.Time.After(cutoff) {
+			count++
+		}
+	}
+	return count
+}
+
+// restartDelay returns the exponential backoff delay for the given number of recent crashes.
+func restartDelay(recentCrashes int) time.Duration {
+	delay := *restartBackoff
+	for i := 1; i < recentCrashes && delay < *restartBackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > *restartBackoffMax {
+		delay = *restartBackoffMax
+	}
+	return delay
+}
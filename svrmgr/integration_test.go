@@ -0,0 +1,866 @@
+package svrmgr
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// integrationTest runs the fake bedrock server against a real git workspace.
+type integrationTest struct {
+	sm       *ServerManager
+	out      *syncBuffer
+	gw       *gitWrapper
+	wsDir    string
+	worldDir string
+	manifest string // Contents of the world database manifest before the server started.
+	ctx      context.Context
+}
+
+// newIntegrationTest creates a bedrock server directory with a world and
+// initializes the git workspace in it. The fake server reports the world files on `save query`.
+func newIntegrationTest(t *testing.T) *integrationTest {
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git not found")
+	}
+
+	it := &integrationTest{
+		wsDir:    t.TempDir(),
+		manifest: "manifest contents",
+		ctx:      context.Background(),
+	}
+	it.worldDir = filepath.Join(it.wsDir, "worlds", "world")
+	it.gw = &gitWrapper{exe: gitPath, wsDir: it.wsDir}
+
+	writeFile := func(path, content string) {
+		path = filepath.Join(it.wsDir, path)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("server.properties", "level-name=world")
+	writeFile("worlds/world/level.dat", "level data")
+	writeFile("worlds/world/db/CURRENT", "MANIFEST-000001")
+	writeFile("worlds/world/db/MANIFEST-000001", it.manifest)
+
+	for _, args := range [][]string{
+		{"init", "."},
+		{"config", "user.email", "test@example.com"},
+		{"config", "user.name", "test"},
+		{"add", "."},
+		{"commit", "-m", "initial"},
+	} {
+		if out, err := it.gw.RunGitCommand(it.ctx, args...); err != nil {
+			t.Fatalf("git %v failed. %v %s", args, err, out)
+		}
+	}
+	t.Setenv(fakeServerWorldEnv, it.worldDir)
+
+	it.sm, it.out = newRealProcessTest(t)
+	it.sm.gw = it.gw
+	it.sm.handlers["backup"].(*backupHandler).worldsDir = filepath.Join(it.wsDir, "worlds")
+	t.Cleanup(func() {
+		it.sm.GetServerProcess().Kill()
+	})
+	return it
+}
+
+// git runs the git command in the workspace and returns the output.
+func (it *integrationTest) git(t *testing.T, args ...string) string {
+	out, err := it.gw.RunGitCommand(it.ctx, args...)
+	if err != nil {
+		t.Fatalf("git %v failed. %v %s", args, err, out)
+	}
+	return out
+}
+
+func TestIntegration_BackupWhileRunning(t *testing.T) {
+	t.Setenv(fakeServerSavePendingEnv, "2")
+	it := newIntegrationTest(t)
+
+	if err := it.sm.RunCommand(it.ctx, "start"); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	backups := it.sm.Events().Subscribe(10, EventBackupStarted, EventBackupFinished, EventBackupFailed)
+	defer backups.Unsubscribe()
+	if err := it.sm.RunCommand(it.ctx, "backup save integration test"); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	waitForOutput(t, it.out, "backup success")
+	waitForOutput(t, it.out, "Changes to the level are resumed")
+	if n := strings.Count(it.out.String(), "A previous save has not been completed"); n < 2 {
+		t.Errorf("expected the backup to wait for the save to complete, got %d pending replies. %v", n, it.out.String())
+	}
+
+	branches := strings.Fields(it.git(t, "branch", "--list", "--format=%(refname:short)", "saves/manual/*"))
+	if len(branches) != 1 {
+		t.Fatalf("expected one manual backup, got %v", branches)
+	}
+	if ev := nextEvent(t, backups); ev.Type != EventBackupStarted || ev.Backup.Description != "integration test" {
+		t.Errorf("expected %s, got %v", EventBackupStarted, ev)
+	}
+	if ev := nextEvent(t, backups); ev.Type != EventBackupFinished || ev.Backup.Branch != branches[0] || ev.Backup.Type != backupTypeManual {
+		t.Errorf("expected %s for %s, got %v", EventBackupFinished, branches[0], ev.Backup)
+	}
+	if msg := it.git(t, "log", "-1", "--format=%s", branches[0]); strings.TrimSpace(msg) != "integration test" {
+		t.Errorf("unexpected backup description %q", msg)
+	}
+
+	// The server kept writing after reporting the file lengths. Only the saved lengths are backed up.
+	backedUp := it.git(t, "show", branches[0]+":worlds/world/db/MANIFEST-000001")
+	if backedUp != it.manifest {
+		t.Errorf("expected manifest %q, got %q", it.manifest, backedUp)
+	}
+	live, _ := os.ReadFile(filepath.Join(it.worldDir, "db", "MANIFEST-000001"))
+	if string(live) != it.manifest+fakeServerWriteTail {
+		t.Errorf("expected the live manifest to be written by the server, got %q", live)
+	}
+
+	if err := it.sm.RunCommand(it.ctx, "stop"); err != nil {
+		t.Errorf("expecting nil, got %v", err)
+	}
+	waitForOutput(t, it.out, "server exited with success")
+}
+
+func TestIntegration_BackupWhileStopped(t *testing.T) {
+	it := newIntegrationTest(t)
+	os.WriteFile(filepath.Join(it.worldDir, "level.dat"), []byte("updated level data"), 0644)
+
+	if err := it.sm.RunCommand(it.ctx, "backup save offline"); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	waitForOutput(t, it.out, "backup success")
+	if strings.Contains(it.out.String(), ">save hold") {
+		t.Errorf("save hold sent to a stopped server. %v", it.out.String())
+	}
+
+	branches := strings.Fields(it.git(t, "branch", "--list", "--format=%(refname:short)", "saves/manual/*"))
+	if len(branches) != 1 {
+		t.Fatalf("expected one manual backup, got %v", branches)
+	}
+	if out := it.git(t, "show", branches[0]+":worlds/world/level.dat"); out != "updated level data" {
+		t.Errorf("unexpected backed up level.dat %q", out)
+	}
+}
+
+func TestIntegration_PinnedBackups(t *testing.T) {
+	it := newIntegrationTest(t)
+	it.git(t, "branch", "saves/manual/20210101-000000")
+	it.git(t, "branch", "saves/manual/20210102-000000")
+	it.git(t, "branch", "saves/manual/20210103-000000")
+	pinned := "saves/manual/20210101-000000"
+
+	if err := it.sm.RunCommand(it.ctx, "backup pin "+pinned); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	it.sm.RunCommand(it.ctx, "backup pin saves/manual/missing")
+	waitForOutput(t, it.out, "backup saves/manual/missing not found")
+	if tags := strings.TrimSpace(it.git(t, "tag", "--list")); tags != pinTagPrefix+pinned {
+		t.Errorf("unexpected tags %q", tags)
+	}
+	refs, err := it.gw.ListBranches(it.ctx, it.sm, []string{"saves/manual/*"})
+	if err != nil || len(refs) != 3 || !refs[0].Pinned || refs[1].Pinned || !strings.HasSuffix(refs[0].String(), "[pinned]") {
+		t.Errorf("unexpected branches %v %v", refs, err)
+	}
+
+	it.sm.RunCommand(it.ctx, "backup delete "+pinned)
+	waitForOutput(t, it.out, "backup "+pinned+" is pinned")
+	if err := it.sm.RunCommand(it.ctx, "backup delete saves/manual/20210101-000000 saves/manual/20210102-000000"); err != nil {
+		t.Errorf("expecting nil, got %v", err)
+	}
+	branches := strings.Fields(it.git(t, "branch", "--list", "--format=%(refname:short)", "saves/manual/*"))
+	if len(branches) != 2 || branches[0] != pinned {
+		t.Errorf("expected the pinned backup to be kept, got %v", branches)
+	}
+
+	if err := it.sm.RunCommand(it.ctx, "backup delete --force "+pinned); err != nil {
+		t.Errorf("expecting nil, got %v", err)
+	}
+	if tags := strings.TrimSpace(it.git(t, "tag", "--list")); tags != "" {
+		t.Errorf("expected the pin to be deleted with the backup, got %q", tags)
+	}
+
+	if err := it.sm.RunCommand(it.ctx, "backup pin saves/manual/20210103-000000"); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	if err := it.sm.RunCommand(it.ctx, "backup unpin saves/manual/20210103-000000"); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	if err := it.sm.RunCommand(it.ctx, "backup delete saves/manual/20210103-000000"); err != nil {
+		t.Errorf("expecting nil, got %v", err)
+	}
+	if branches := strings.TrimSpace(it.git(t, "branch", "--list", "saves/*")); branches != "" {
+		t.Errorf("expected all backups to be deleted, got %q", branches)
+	}
+}
+
+func TestIntegration_GC(t *testing.T) {
+	it := newIntegrationTest(t)
+	initial := strings.TrimSpace(it.git(t, "rev-parse", "--abbrev-ref", "HEAD"))
+	os.WriteFile(filepath.Join(it.worldDir, "level.dat"), []byte("level data to be deleted"), 0644)
+	if err := it.sm.RunCommand(it.ctx, "backup save to be deleted"); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	waitForOutput(t, it.out, "backup success")
+	branch := strings.TrimSpace(it.git(t, "branch", "--list", "--format=%(refname:short)", "saves/manual/*"))
+	hash := strings.TrimSpace(it.git(t, "rev-parse", branch))
+	it.git(t, "checkout", "-q", "-f", initial)
+	it.git(t, "branch", "-D", branch)
+
+	*gitDryRun = true
+	r, err := it.sm.handlers["backup"].(*backupHandler).collectGarbage(it.ctx, it.sm)
+	*gitDryRun = false
+	if err != nil || !r.DryRun {
+		t.Fatalf("unexpected dry run result %v %v", r, err)
+	}
+	if _, err := it.gw.RunGitCommand(it.ctx, "cat-file", "-e", hash); err != nil {
+		t.Errorf("deleted backup removed in dry run")
+	}
+
+	if err := it.sm.RunCommand(it.ctx, "backup gc"); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	waitForOutput(t, it.out, "git maintenance complete. reclaimed")
+	if _, err := it.gw.RunGitCommand(it.ctx, "cat-file", "-e", hash); err == nil {
+		t.Errorf("deleted backup %s not garbage collected", hash)
+	}
+}
+
+func TestIntegration_BackupStats(t *testing.T) {
+	it := newIntegrationTest(t)
+	for _, content := range []string{"first level data", "second level data"} {
+		os.WriteFile(filepath.Join(it.worldDir, "level.dat"), []byte(content), 0644)
+		if err := it.sm.RunCommand(it.ctx, "backup save "+content); err != nil {
+			t.Fatalf("expecting nil, got %v", err)
+		}
+		waitForOutput(t, it.out, "backup success")
+		time.Sleep(time.Second) // Backup names have second resolution.
+	}
+
+	s, err := it.sm.handlers["backup"].(*backupHandler).stats(it.ctx, it.sm, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Backups != 2 || s.ByType[backupTypeManual] != 2 || s.RepositorySize == 0 || s.Objects == 0 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+	if s.Oldest == nil || s.Newest == nil || s.Oldest.Ref >= s.Newest.Ref {
+		t.Errorf("unexpected oldest and newest %v %v", s.Oldest, s.Newest)
+	}
+	// Each backup has its own level.dat and commit. The rest is shared.
+	if len(s.Usage) != 2 || s.Usage[0].UniqueSize == 0 || s.Usage[1].UniqueSize == 0 {
+		t.Errorf("unexpected usage %+v", s.Usage)
+	}
+
+	if err := it.sm.RunCommand(it.ctx, "backup stats"); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	waitForOutput(t, it.out, "2 backups (manual: 2) using")
+}
+
+func TestIntegration_BackupDiff(t *testing.T) {
+	it := newIntegrationTest(t)
+	save := func(desc string) string {
+		if err := it.sm.RunCommand(it.ctx, "backup save "+desc); err != nil {
+			t.Fatalf("expecting nil, got %v", err)
+		}
+		waitForOutput(t, it.out, "backup success")
+		time.Sleep(time.Second) // Backup names have second resolution.
+		return strings.TrimSpace(it.git(t, "rev-parse", "--abbrev-ref", "HEAD"))
+	}
+	os.WriteFile(filepath.Join(it.worldDir, "level.dat"), []byte("first level data"), 0644)
+	first := save("first")
+	os.WriteFile(filepath.Join(it.wsDir, "server.properties"), []byte("level-name=world\ndifficulty=hard\n"), 0644)
+	os.WriteFile(filepath.Join(it.wsDir, "permissions.json"), []byte("[]\n"), 0644)
+	os.WriteFile(filepath.Join(it.worldDir, "level.dat"), []byte("longer level data"), 0644)
+	second := save("second")
+
+	bh := it.sm.handlers["backup"].(*backupHandler)
+	d, err := bh.diff(it.ctx, it.sm, []string{first, second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Files) != 3 || d.Files[0].Path != "permissions.json" || d.Files[0].Status != "A" || d.Files[0].NewSize != 3 {
+		t.Fatalf("unexpected changes %+v", d.Files)
+	}
+	if props := d.Files[1]; props.Path != "server.properties" || props.Added != 2 || props.Deleted != 1 {
+		t.Errorf("unexpected server.properties change %+v", props)
+	}
+	if level := d.Files[2]; level.Path != "worlds/world/level.dat" || level.Status != "M" || level.SizeDelta() != int64(len("longer level data")-len("first level data")) {
+		t.Errorf("unexpected level.dat change %+v", level)
+	}
+	for _, exp := range []string{"+difficulty=hard", "+[]"} {
+		if !strings.Contains(d.ConfigDiff, exp) {
+			t.Errorf("expected %s in the config diff. %s", exp, d.ConfigDiff)
+		}
+	}
+
+	// Compare with the workspace, including the untracked files.
+	os.WriteFile(filepath.Join(it.worldDir, "db", "000005.ldb"), []byte("new table"), 0644)
+	os.Remove(filepath.Join(it.wsDir, "permissions.json"))
+	d, err = bh.diff(it.ctx, it.sm, []string{second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Files) != 2 || d.Files[0].Status != "D" || d.Files[1].Path != "worlds/world/db/000005.ldb" || d.Files[1].NewSize != 9 {
+		t.Fatalf("unexpected changes %+v", d.Files)
+	}
+	if d.SizeDelta != 9-3 || !strings.Contains(d.ConfigDiff, "-[]") {
+		t.Errorf("unexpected diff %+v", d)
+	}
+
+	if err := it.sm.RunCommand(it.ctx, "backup diff "+first+" "+second); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	waitForOutput(t, it.out, "3 files changed")
+	waitForOutput(t, it.out, "server settings changes:")
+}
+
+func TestIntegration_BackupExport(t *testing.T) {
+	it := newIntegrationTest(t)
+	os.WriteFile(filepath.Join(it.worldDir, "level.dat"), []byte("exported level data"), 0644)
+	if err := it.sm.RunCommand(it.ctx, "backup save export"); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	waitForOutput(t, it.out, "backup success")
+	branch := strings.TrimSpace(it.git(t, "rev-parse", "--abbrev-ref", "HEAD"))
+	// Changes after the backup are not exported.
+	os.WriteFile(filepath.Join(it.worldDir, "level.dat"), []byte("live level data"), 0644)
+
+	dir := t.TempDir()
+	readZip := func(name string) map[string]string {
+		r, err := zip.OpenReader(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("unable to open %s. %v", name, err)
+		}
+		defer r.Close()
+		files := map[string]string{}
+		for _, f := range r.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			rc, _ := f.Open()
+			b, _ := io.ReadAll(rc)
+			rc.Close()
+			files[f.Name] = string(b)
+		}
+		return files
+	}
+
+	if err := it.sm.RunCommand(it.ctx, "backup export "+branch+" "+filepath.Join(dir, "world.mcworld")); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	waitForOutput(t, it.out, "exported to")
+	if files := readZip("world.mcworld"); len(files) != 3 || files["level.dat"] != "exported level data" || files["db/CURRENT"] == "" {
+		t.Errorf("unexpected .mcworld contents %v", files)
+	}
+
+	if err := it.sm.RunCommand(it.ctx, "backup export "+branch+" "+filepath.Join(dir, "server.zip")); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	files := readZip("server.zip")
+	if len(files) != 4 || files["worlds/world/level.dat"] != "exported level data" || files["server.properties"] != "level-name=world" {
+		t.Errorf("unexpected .zip contents %v", files)
+	}
+
+	it.sm.RunCommand(it.ctx, "backup export "+branch+" "+filepath.Join(dir, "server.zip"))
+	waitForOutput(t, it.out, "server.zip already exists")
+	it.sm.RunCommand(it.ctx, "backup export "+branch+" "+filepath.Join(dir, "world.tar"))
+	waitForOutput(t, it.out, "must end with .mcworld or .zip")
+}
+
+func TestIntegration_BackupImport(t *testing.T) {
+	it := newIntegrationTest(t)
+	dir := t.TempDir()
+	writeZip := func(name string, files map[string]string) string {
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		w := zip.NewWriter(f)
+		for name, content := range files {
+			fw, _ := w.Create(name)
+			io.WriteString(fw, content)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	invalid := writeZip("invalid.mcworld", map[string]string{"level.dat": "no db"})
+	it.sm.RunCommand(it.ctx, "backup import "+invalid+" invalid world")
+	waitForOutput(t, it.out, "db folder not found")
+
+	world := writeZip("Skyblock.mcworld", map[string]string{
+		"level.dat":     "skyblock level data",
+		"levelname.txt": "Skyblock",
+		"db/CURRENT":    "MANIFEST-000002",
+	})
+	if err := it.sm.RunCommand(it.ctx, "backup import --level-name skyblock "+world+" Skyblock from Steve"); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	waitForOutput(t, it.out, "backup success")
+
+	branches := strings.Fields(it.git(t, "branch", "--list", "--format=%(refname:short)", "saves/imported/*"))
+	if len(branches) != 1 {
+		t.Fatalf("expected one imported backup, got %v", branches)
+	}
+	if out := it.git(t, "show", branches[0]+":worlds/skyblock/level.dat"); out != "skyblock level data" {
+		t.Errorf("unexpected imported level.dat %q", out)
+	}
+	if out := it.git(t, "show", branches[0]+":server.properties"); out != "level-name=skyblock" {
+		t.Errorf("unexpected server.properties %q", out)
+	}
+	if msg := strings.TrimSpace(it.git(t, "log", "-1", "--format=%s", branches[0])); msg != "Skyblock from Steve" {
+		t.Errorf("unexpected backup description %q", msg)
+	}
+	// The original world is kept.
+	if out := it.git(t, "show", branches[0]+":worlds/world/level.dat"); out != "level data" {
+		t.Errorf("unexpected level.dat %q", out)
+	}
+
+	// Oversized worlds are refused before the world is replaced.
+	old := *importMaxSize
+	*importMaxSize = 10
+	it.sm.RunCommand(it.ctx, "backup import --level-name skyblock "+world+" too large")
+	*importMaxSize = old
+	waitForOutput(t, it.out, "larger than the limit of 10 B")
+	if content, _ := os.ReadFile(filepath.Join(it.wsDir, "worlds", "skyblock", "level.dat")); string(content) != "skyblock level data" {
+		t.Errorf("expected the world to be kept, got %q", content)
+	}
+
+	os.WriteFile(filepath.Join(it.worldDir, "level.dat"), []byte("dirty"), 0644)
+	it.sm.RunCommand(it.ctx, "backup import "+world+" again")
+	waitForOutput(t, it.out, "there are changes since last backup")
+
+	if err := it.sm.RunCommand(it.ctx, "start"); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	it.sm.RunCommand(it.ctx, "backup import "+world+" while running")
+	waitForOutput(t, it.out, "stop the server before importing the world")
+	if err := it.sm.RunCommand(it.ctx, "stop"); err != nil {
+		t.Errorf("expecting nil, got %v", err)
+	}
+	waitForOutput(t, it.out, "server exited with success")
+	if branches := strings.Fields(it.git(t, "branch", "--list", "--format=%(refname:short)", "saves/imported/*")); len(branches) != 1 {
+		t.Errorf("expected only the first import to be saved, got %v", branches)
+	}
+}
+
+func TestIntegration_BackupSync(t *testing.T) {
+	it := newIntegrationTest(t)
+	remote := t.TempDir()
+	it.git(t, "init", "--bare", remote)
+	bh := it.sm.handlers["backup"].(*backupHandler)
+	bh.setRemotes(remote)
+	remoteBackups := func() []string {
+		return strings.Fields(it.git(t, "--git-dir="+remote, "for-each-ref", "--format=%(refname:short)", "refs/heads/saves"))
+	}
+	waitForRemote := func(exp int) []string {
+		deadline := time.Now().Add(time.Second * 10)
+		for {
+			backups := remoteBackups()
+			if len(backups) == exp {
+				return backups
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %d backups on the remote, got %v", exp, backups)
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+	}
+
+	// A branch made outside the manager is reported as unsynced.
+	it.git(t, "branch", "saves/manual/20210101-000000")
+	statuses, _ := bh.sync(it.ctx, it.sm, []string{"status"})
+	if len(statuses) != 1 || len(statuses[0].ToPush) != 1 || statuses[0].LastSync != nil {
+		t.Fatalf("unexpected status %+v", statuses)
+	}
+
+	os.WriteFile(filepath.Join(it.worldDir, "level.dat"), []byte("synced level data"), 0644)
+	if err := it.sm.RunCommand(it.ctx, "backup save synced"); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	waitForOutput(t, it.out, "backup success")
+	backups := waitForRemote(2)
+	branch := strings.TrimSpace(it.git(t, "rev-parse", "--abbrev-ref", "HEAD"))
+	if backups[1] != branch {
+		t.Errorf("expected %s on the remote, got %v", branch, backups)
+	}
+	if out := it.git(t, "--git-dir="+remote, "show", branch+":worlds/world/level.dat"); out != "synced level data" {
+		t.Errorf("unexpected level.dat on the remote %q", out)
+	}
+
+	// Deletions are propagated.
+	if err := it.sm.RunCommand(it.ctx, "backup delete saves/manual/20210101-000000"); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	waitForRemote(1)
+
+	if err := it.sm.RunCommand(it.ctx, "backup sync status"); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	waitForOutput(t, it.out, "0 backups to push, 0 to delete")
+
+	bh.setRemotes(filepath.Join(remote, "missing"))
+	if err := it.sm.RunCommand(it.ctx, "backup sync"); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	waitForOutput(t, it.out, "never synced, 0 backups to push, 0 to delete, 0 only on the remote. last error: unable to list refs")
+}
+
+func TestIntegration_BackupSyncKeepsRemoteBackups(t *testing.T) {
+	it := newIntegrationTest(t)
+	remote := t.TempDir()
+	it.git(t, "init", "--bare", remote)
+	bh := it.sm.handlers["backup"].(*backupHandler)
+	remoteRefs := func() string {
+		return strings.Join(strings.Fields(it.git(t, "--git-dir="+remote, "for-each-ref", "--format=%(refname:short)", "refs/heads/saves", "refs/tags/pinned")), " ")
+	}
+	waitForRemote := func(exp string) {
+		deadline := time.Now().Add(time.Second * 10)
+		for remoteRefs() != exp {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %q on the remote, got %q", exp, remoteRefs())
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+	}
+
+	// The remote has backups that are not in the local repository, for example the ones
+	// lost with the disk or the backups of another server sharing the remote.
+	lost := "saves/manual/20200101-000000"
+	it.git(t, "branch", lost)
+	it.git(t, "tag", pinTagPrefix+lost, lost)
+	it.git(t, "push", remote, lost, pinTagPrefix+lost)
+	it.git(t, "branch", "-D", lost)
+	it.git(t, "tag", "-d", pinTagPrefix+lost)
+
+	bh.setRemotes(remote)
+	os.WriteFile(filepath.Join(it.worldDir, "level.dat"), []byte("new level data"), 0644)
+	if err := it.sm.RunCommand(it.ctx, "backup save after disk failure"); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	waitForOutput(t, it.out, "backup success")
+	branch := strings.TrimSpace(it.git(t, "rev-parse", "--abbrev-ref", "HEAD"))
+	waitForRemote(lost + " " + branch + " " + pinTagPrefix + lost)
+
+	if err := it.sm.RunCommand(it.ctx, "backup sync"); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	waitForOutput(t, it.out, "0 backups to push, 0 to delete, 2 only on the remote")
+	if refs := remoteRefs(); refs != lost+" "+branch+" "+pinTagPrefix+lost {
+		t.Errorf("expected the remote backups to be kept, got %q", refs)
+	}
+
+	// Pins are replicated, and unpinning removes the remote pin.
+	if err := it.sm.RunCommand(it.ctx, "backup pin "+branch); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	waitForRemote(lost + " " + branch + " " + pinTagPrefix + lost + " " + pinTagPrefix + branch)
+	if err := it.sm.RunCommand(it.ctx, "backup unpin "+branch); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	waitForRemote(lost + " " + branch + " " + pinTagPrefix + lost)
+
+	// Only the backups deleted by the manager are deleted from the remote.
+	it.git(t, "branch", "saves/manual/20210101-000000")
+	if err := it.sm.RunCommand(it.ctx, "backup sync"); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	waitForRemote(lost + " saves/manual/20210101-000000 " + branch + " " + pinTagPrefix + lost)
+	if err := it.sm.RunCommand(it.ctx, "backup delete saves/manual/20210101-000000"); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	waitForRemote(lost + " " + branch + " " + pinTagPrefix + lost)
+	// Wait for the sync to finish.
+	bh.syncLock.Lock()
+	bh.syncLock.Unlock()
+	bh.deletedLock.Lock()
+	if len(bh.deleted) != 0 {
+		t.Errorf("expected the synced deletions to be cleared, got %v", bh.deleted)
+	}
+	bh.deletedLock.Unlock()
+}
+
+func TestIntegration_BackupSyncDeletionsAndConflicts(t *testing.T) {
+	it := newIntegrationTest(t)
+	remote := t.TempDir()
+	it.git(t, "init", "--bare", remote)
+	bh := it.sm.handlers["backup"].(*backupHandler)
+	remoteRefs := func() string {
+		return strings.Join(strings.Fields(it.git(t, "--git-dir="+remote, "for-each-ref", "--format=%(refname:short)", "refs/heads/saves")), " ")
+	}
+
+	old := "saves/manual/20210101-000000"
+	it.git(t, "branch", old)
+	it.git(t, "push", remote, old)
+
+	// The deletion is kept while the remote is unreachable, including across restarts of the manager.
+	bh.setRemotes(filepath.Join(remote, "missing"))
+	if err := it.sm.RunCommand(it.ctx, "backup delete "+old); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	bh.syncLock.Lock()
+	bh.syncLock.Unlock()
+	bh.deletedLock.Lock()
+	bh.deleted = map[string]bool{}
+	bh.deletedFile = ""
+	bh.deletedLock.Unlock()
+	bh.setRemotes(remote)
+	if err := it.sm.RunCommand(it.ctx, "backup sync"); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	waitForOutput(t, it.out, "0 pushed, 1 deleted")
+	if refs := remoteRefs(); refs != "" {
+		t.Errorf("expected the backup to be deleted from the remote, got %q", refs)
+	}
+	if _, err := os.Stat(filepath.Join(it.wsDir, ".git", deletedRefsFile)); !os.IsNotExist(err) {
+		t.Errorf("expected the synced deletions to be removed, got %v", err)
+	}
+
+	// A backup with the same name but different commits on the remote is not overwritten.
+	conflict := "saves/manual/20220101-000000"
+	it.git(t, "checkout", "-q", "-b", conflict)
+	os.WriteFile(filepath.Join(it.worldDir, "level.dat"), []byte("conflicting level data"), 0644)
+	it.git(t, "commit", "-q", "-a", "-m", "conflict")
+	it.git(t, "push", remote, conflict)
+	it.git(t, "reset", "-q", "--hard", "HEAD~1")
+	remoteCommit := it.git(t, "--git-dir="+remote, "rev-parse", conflict)
+	bh.syncLock.Lock()
+	bh.syncLock.Unlock()
+	if err := it.sm.RunCommand(it.ctx, "backup sync"); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	waitForOutput(t, it.out, "push rejected for "+conflict)
+	if commit := it.git(t, "--git-dir="+remote, "rev-parse", conflict); commit != remoteCommit {
+		t.Errorf("expected the remote backup to be kept, got %s", commit)
+	}
+}
+
+func TestIntegration_BackupExtract(t *testing.T) {
+	it := newIntegrationTest(t)
+	os.WriteFile(filepath.Join(it.worldDir, "level.dat"), []byte("extracted level data"), 0644)
+	if err := it.sm.RunCommand(it.ctx, "backup save extract"); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	waitForOutput(t, it.out, "backup success")
+	branch := strings.TrimSpace(it.git(t, "rev-parse", "--abbrev-ref", "HEAD"))
+	// The server keeps changing the live world.
+	os.WriteFile(filepath.Join(it.worldDir, "level.dat"), []byte("live level data"), 0644)
+
+	it.sm.RunCommand(it.ctx, "backup extract "+branch+" "+filepath.Join(it.wsDir, "extracted"))
+	waitForOutput(t, it.out, "is inside the git workspace")
+
+	dir := filepath.Join(t.TempDir(), "extracted")
+	if err := it.sm.RunCommand(it.ctx, "backup extract "+branch+" "+dir); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	waitForOutput(t, it.out, "extracted to")
+	if b, _ := os.ReadFile(filepath.Join(dir, "worlds", "world", "level.dat")); string(b) != "extracted level data" {
+		t.Errorf("unexpected extracted level.dat %q", b)
+	}
+	if b, _ := os.ReadFile(filepath.Join(it.worldDir, "level.dat")); string(b) != "live level data" {
+		t.Errorf("live world changed %q", b)
+	}
+	if head := strings.TrimSpace(it.git(t, "rev-parse", "--abbrev-ref", "HEAD")); head != branch {
+		t.Errorf("workspace head changed to %s", head)
+	}
+
+	bh := it.sm.handlers["backup"].(*backupHandler)
+	worktrees, err := bh.worktreeList(it.ctx, it.sm, nil)
+	if err != nil || len(worktrees) != 1 || worktrees[0].Backup != branch || filepath.Base(worktrees[0].Path) != "extracted" {
+		t.Fatalf("unexpected worktrees %+v %v", worktrees, err)
+	}
+
+	os.WriteFile(filepath.Join(dir, "worlds", "world", "level.dat"), []byte("modified"), 0644)
+	it.sm.RunCommand(it.ctx, "backup worktree remove "+dir)
+	waitForOutput(t, it.out, "git worktree remove failed")
+	if err := it.sm.RunCommand(it.ctx, "backup worktree remove --force "+dir); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	waitForOutput(t, it.out, "removed "+dir)
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed. %v", dir, err)
+	}
+	if worktrees, _ := bh.worktreeList(it.ctx, it.sm, nil); len(worktrees) != 0 {
+		t.Errorf("unexpected worktrees %+v", worktrees)
+	}
+}
+
+func TestIntegration_StartupDelay(t *testing.T) {
+	t.Setenv(fakeServerStartupDelayEnv, "200ms")
+	sm, out := newRealProcessTest(t)
+	ctx := context.Background()
+
+	start := time.Now()
+	if err := sm.RunCommand(ctx, "start"); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	if d := time.Since(start); d < time.Millisecond*200 {
+		t.Errorf("start returned before the server started, after %v", d)
+	}
+	if strings.Count(out.String(), serverOutputMarker) != 2 {
+		t.Errorf("start returned before the start marker. %v", out.String())
+	}
+	sm.RunCommand(ctx, "stop")
+	waitForOutput(t, out, "server exited with success")
+}
+
+func TestIntegration_StartFailure(t *testing.T) {
+	t.Setenv(fakeServerFailStartupEnv, "1")
+	sm, out := newRealProcessTest(t)
+	ctx := context.Background()
+	// Failed start must not be retried by the supervisor after the test.
+	sm.RunCommand(ctx, "supervisor policy never")
+
+	if err := sm.RunCommand(ctx, "start"); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	waitForOutput(t, out, "failed to start the server")
+	waitForOutput(t, out, "server exited with failure")
+	if sm.GetServerProcess().IsRunning() {
+		t.Errorf("server still running")
+	}
+}
+
+func TestIntegration_StopTimeout(t *testing.T) {
+	t.Setenv(fakeServerIgnoreStopEnv, "1")
+	oldTimeout := *stopTimeout
+	*stopTimeout = time.Millisecond * 500
+	defer func() { *stopTimeout = oldTimeout }()
+
+	sm, out := newRealProcessTest(t)
+	ctx := context.Background()
+
+	if err := sm.RunCommand(ctx, "start"); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	if err := sm.RunCommand(ctx, "stop"); err != nil {
+		t.Errorf("expecting nil, got %v", err)
+	}
+	waitForOutput(t, out, "Server stop requested")
+	waitForOutput(t, out, "killing the server")
+	waitForOutput(t, out, "server exited with failure")
+}
+
+func TestIntegration_CrashRestart(t *testing.T) {
+	oldBackoff := *restartBackoff
+	*restartBackoff = time.Millisecond * 100
+	defer func() { *restartBackoff = oldBackoff }()
+
+	sm, out := newRealProcessTest(t)
+	ctx := context.Background()
+	t.Cleanup(func() {
+		sm.GetServerProcess().Kill()
+	})
+
+	if err := sm.RunCommand(ctx, "start"); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	if err := sm.RunCommand(ctx, "server crash"); err != nil {
+		t.Errorf("expecting nil, got %v", err)
+	}
+	waitForOutput(t, out, "server exited with failure")
+	waitForOutput(t, out, "restarting server in 100ms")
+
+	deadline := time.Now().Add(time.Second * 10)
+	for strings.Count(out.String(), "Server started") < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("server not restarted. %v", out.String())
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	sm.RunCommand(ctx, "supervisor policy never")
+	sm.RunCommand(ctx, "stop")
+	waitForOutput(t, out, "server exited with success")
+}
+
+func TestIntegration_LogsNotBackedUp(t *testing.T) {
+	it := newIntegrationTest(t)
+	logDir := filepath.Join(it.wsDir, "logs")
+	proc := it.sm.serverProcess.(*serverProcess)
+	proc.logFile = newServerLogWriter(logDir, 0, 10)
+	defer proc.logFile.Close()
+	it.sm.excludeFromBackups(it.ctx, []string{logDir})
+	// Excluding twice does not duplicate the pattern.
+	it.sm.excludeFromBackups(it.ctx, []string{logDir})
+
+	if err := it.sm.RunCommand(it.ctx, "start"); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	if err := it.sm.RunCommand(it.ctx, "backup save with logs"); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	waitForOutput(t, it.out, "backup success")
+	if err := it.sm.RunCommand(it.ctx, "stop"); err != nil {
+		t.Errorf("expecting nil, got %v", err)
+	}
+	waitForOutput(t, it.out, "server exited with success")
+
+	if files, _ := filepath.Glob(filepath.Join(logDir, "*"+serverLogSuffix)); len(files) == 0 {
+		t.Fatalf("expected the server output in %s", logDir)
+	}
+	branches := strings.Fields(it.git(t, "branch", "--list", "--format=%(refname:short)", "saves/manual/*"))
+	if len(branches) != 1 {
+		t.Fatalf("expected one manual backup, got %v", branches)
+	}
+	if files := it.git(t, "ls-tree", "-r", "--name-only", branches[0]); strings.Contains(files, "logs/") {
+		t.Errorf("expected the logs to be excluded from the backup, got %v", files)
+	}
+	// The server keeps writing the world after the backup, but the logs never show up as changes.
+	if status := it.git(t, "status", "--porcelain", "--untracked-files=all"); strings.Contains(status, "logs/") {
+		t.Errorf("expected the log files to not dirty the workspace, got %v", status)
+	}
+	exclude, _ := os.ReadFile(filepath.Join(it.wsDir, ".git", "info", "exclude"))
+	if n := strings.Count(string(exclude), "/logs\n"); n != 1 {
+		t.Errorf("expected one exclude pattern for the logs, got %q", exclude)
+	}
+}
+
+func TestIntegration_PlayerSessionsNotBackedUp(t *testing.T) {
+	it := newIntegrationTest(t)
+	path := filepath.Join(it.wsDir, "player_sessions.jsonl")
+	store := newPlayerSessionStore(path)
+	it.sm.handlers["players"].(*playersHandler).store = store
+	it.sm.excludeFromBackups(it.ctx, []string{path})
+	initial := strings.TrimSpace(it.git(t, "rev-parse", "--abbrev-ref", "HEAD"))
+
+	now := time.Now()
+	if err := store.Add(PlayerSession{Name: "Steve", XUID: "1", Joined: now.Add(-time.Hour), Left: now, EndReason: sessionEndDisconnect}); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(it.worldDir, "level.dat"), []byte("updated level data"), 0644)
+	if err := it.sm.RunCommand(it.ctx, "backup save with sessions"); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	waitForOutput(t, it.out, "backup success")
+
+	branches := strings.Fields(it.git(t, "branch", "--list", "--format=%(refname:short)", "saves/manual/*"))
+	if len(branches) != 1 {
+		t.Fatalf("expected one manual backup, got %v", branches)
+	}
+	if files := it.git(t, "ls-tree", "-r", "--name-only", branches[0]); strings.Contains(files, "player_sessions.jsonl") {
+		t.Errorf("expected the player sessions to be excluded from the backup, got %v", files)
+	}
+
+	// Restoring the initial commit keeps the playtime history.
+	if err := it.sm.RunCommand(it.ctx, "backup restore "+initial); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	waitForOutput(t, it.out, "successfully restored")
+	if content, err := os.ReadFile(path); err != nil || !strings.Contains(string(content), `"Steve"`) {
+		t.Errorf("expected the player sessions to be kept, got %q %v", content, err)
+	}
+}
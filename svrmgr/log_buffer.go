@@ -0,0 +1,94 @@
+package svrmgr
+
+import (
+	"regexp"
+	"sync"
+	"time"
+)
+
+// LogSource identifies the stream the server output came from.
+type LogSource string
+
+const (
+	LogSourceStdout LogSource = "stdout"
+	LogSourceStderr LogSource = "stderr"
+)
+
+// LogBuffer is a bounded ring buffer of server output lines.
+// Safe for concurrent use. Once full, oldest lines are discarded.
+type LogBuffer struct {
+	lock  sync.Mutex
+	lines []LogLine
+	start int // Index of the oldest line.
+	count int // Number of valid lines.
+}
+
+// NewLogBuffer creates a log buffer that holds up to size lines.
+func NewLogBuffer(size int) *LogBuffer {
+	if size < 1 {
+		size = 1
+	}
+	return &LogBuffer{
+		lines: make([]LogLine, size),
+	}
+}
+
+// Add appends the line, discarding the oldest line if the buffer is full.
+func (b *LogBuffer) Add(line LogLine) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	end := (b.start + b.count) % len(b.lines)
+	b.lines[end] = line
+	if b.count < len(b.lines) {
+		b.count++
+	} else {
+		b.start = (b.start + 1) % len(b.lines)
+	}
+}
+
+// Len returns the number of lines in the buffer.
+func (b *LogBuffer) Len() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.count
+}
+
+// Lines returns all the lines, oldest first.
+func (b *LogBuffer) Lines() []LogLine {
+	return b.filter(func(LogLine) bool { return true })
+}
+
+// Tail returns up to n most recent lines, oldest first.
+func (b *LogBuffer) Tail(n int) []LogLine {
+	lines := b.Lines()
+	if n < len(lines) {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
+
+// Grep returns the lines matching the regular expression.
+func (b *LogBuffer) Grep(re *regexp.Regexp) []LogLine {
+	return b.filter(func(l LogLine) bool { return re.MatchString(l.Line) })
+}
+
+// Since returns the lines logged at or after the given time.
+func (b *LogBuffer) Since(t time.Time) []LogLine {
+	return b.filter(func(l LogLine) bool { return !l.Time.Before(t) })
+}
+
+// filter returns a copy of the lines matching the predicate, oldest first.
+func (b *LogBuffer) filter(match func(LogLine) bool) []LogLine {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	var result []LogLine
+	for i := 0; i < b.count; i++ {
+		l := b.lines[(b.start+i)%len(b.lines)]
+		if match(l) {
+			result = append(result, l)
+		}
+	}
+	return result
+}
@@ -0,0 +1,216 @@
+package svrmgr
+
+import (
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+var serverLogDir = flag.String("server_log_dir", "logs", "directory for the server log files. relative to the bedrock server directory. excluded from the backups if inside the git workspace. set to empty to disable")
+var serverLogMaxSize = flag.Int64("server_log_max_size", 10*1024*1024, "server log file is rotated when it grows beyond this size in bytes")
+var serverLogRetention = flag.Int("server_log_retention", 30, "number of rotated server log files to keep")
+
+const (
+	serverLogPrefix     = "server-"
+	serverLogSuffix     = ".log"
+	formatServerLogDay  = "20060102"
+	formatServerLogLine = "2006-01-02 15:04:05"
+	serverLogArchiveExt = ".gz"
+)
+
+// serverLogWriter writes the server output to daily log files.
+// Files are rotated by date and size. Rotated files are compressed
+// and only the most recent ones are kept.
+type serverLogWriter struct {
+	lock      sync.Mutex
+	dir       string
+	maxSize   int64
+	retention int
+
+	file *os.File
+	day  string // Day of the currently open file.
+	size int64
+}
+
+// newServerLogWriter creates a log writer for the given directory.
+// Files are created on first write.
+func newServerLogWriter(dir string, maxSize int64, retention int) *serverLogWriter {
+	return &serverLogWriter{
+		dir:       dir,
+		maxSize:   maxSize,
+		retention: retention,
+	}
+}
+
+// WriteLine writes a timestamped line to the current log file.
+func (w *serverLogWriter) WriteLine(line LogLine) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	day := line.Time.Local().Format(formatServerLogDay)
+	if w.file == nil || day != w.day || (w.maxSize > 0 && w.size >= w.maxSize) {
+		if err := w.rotate(day); err != nil {
+			return err
+		}
+	}
+
+	tag := ""
+	if line.Source == LogSourceStderr {
+		tag = "[stderr] "
+	}
+	n, err := io.WriteString(w.file, fmt.Sprintf("[%s] %s%s\n", line.Time.Local().Format(formatServerLogLine), tag, line.Line))
+	w.size += int64(n)
+	return err
+}
+
+// Close closes the current log file.
+func (w *serverLogWriter) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// rotate closes the current file, archives all inactive log files and
+// opens the log file for the given day.
+// Must be called with the lock held.
+func (w *serverLogWriter) rotate(day string) error {
+	if w.file != nil {
+		w.file.Close()
+		w.file = nil
+	}
+
+	if err := os.MkdirAll(w.dir, 0755); err != nil {
+		return fmt.Errorf("unable to create log directory. %v", err)
+	}
+
+	current := filepath.Join(w.dir, serverLogPrefix+day+serverLogSuffix)
+	if err := w.archive(current); err != nil {
+		glog.Errorf("unable to archive server logs. %v", err)
+	}
+	w.prune()
+
+	f, err := os.OpenFile(current, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to open log file. %v", err)
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("unable to open log file. %v", err)
+	}
+
+	w.file = f
+	w.day = day
+	w.size = st.Size()
+	return nil
+}
+
+// archive compresses all the uncompressed log files. The file for current day
+// is archived only if it reached the max size.
+func (w *serverLogWriter) archive(current string) error {
+	files, err := filepath.Glob(filepath.Join(w.dir, serverLogPrefix+"*"+serverLogSuffix))
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if f == current {
+			st, err := os.Stat(f)
+			if err != nil || w.maxSize <= 0 || st.Size() < w.maxSize {
+				continue
+			}
+		}
+		if err = compressLogFile(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prune deletes the oldest archived log files beyond the retention count.
+func (w *serverLogWriter) prune() {
+	files, err := filepath.Glob(filepath.Join(w.dir, serverLogPrefix+"*"+serverLogSuffix+serverLogArchiveExt))
+	if err != nil || len(files) <= w.retention {
+		return
+	}
+
+	modTimes := map[string]time.Time{}
+	for _, f := range files {
+		if st, err := os.Stat(f); err == nil {
+			modTimes[f] = st.ModTime()
+		}
+	}
+	// Newest first
+	sort.Slice(files, func(i, j int) bool {
+		if modTimes[files[i]].Equal(modTimes[files[j]]) {
+			return files[i] > files[j]
+		}
+		return modTimes[files[i]].After(modTimes[files[j]])
+	})
+	for _, f := range files[w.retention:] {
+		glog.Infof("deleting old server log %s", f)
+		if err := os.Remove(f); err != nil {
+			glog.Errorf("unable to delete old server log %s. %v", f, err)
+		}
+	}
+}
+
+// compressLogFile gzips the log file and deletes the original.
+// The archive is named server-YYYYMMDD-N.log.gz where N is one more than
+// the last archive of the same day.
+func compressLogFile(path string) error {
+	base := strings.TrimSuffix(path, serverLogSuffix)
+	archives, err := filepath.Glob(base + "-*" + serverLogSuffix + serverLogArchiveExt)
+	if err != nil {
+		return err
+	}
+	next := 1
+	for _, a := range archives {
+		n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(a, base+"-"), serverLogSuffix+serverLogArchiveExt))
+		if err == nil && n >= next {
+			next = n + 1
+		}
+	}
+	dest := fmt.Sprintf("%s-%d%s%s", base, next, serverLogSuffix, serverLogArchiveExt)
+
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	zw.Name = filepath.Base(path)
+	if _, err = io.Copy(zw, in); err == nil {
+		err = zw.Close()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dest)
+		return fmt.Errorf("unable to compress %s. %v", path, err)
+	}
+
+	in.Close()
+	return os.Remove(path)
+}
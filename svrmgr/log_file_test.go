@@ -0,0 +1,107 @@
+package svrmgr
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func listLogDir(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestServerLogWriter_DailyRotation(t *testing.T) {
+	dir := t.TempDir()
+	w := newServerLogWriter(dir, 0, 10)
+	defer w.Close()
+
+	day1 := time.Date(2021, 10, 2, 12, 0, 0, 0, time.Local)
+	day2 := day1.Add(time.Hour * 24)
+	w.WriteLine(LogLine{Line: "first day", Time: day1, Source: LogSourceStdout})
+	w.WriteLine(LogLine{Line: "failure", Time: day1, Source: LogSourceStderr})
+	w.WriteLine(LogLine{Line: "second day", Time: day2, Source: LogSourceStdout})
+
+	exp := "server-20211002-1.log.gz,server-20211003.log"
+	if got := strings.Join(listLogDir(t, dir), ","); got != exp {
+		t.Errorf("expected %s, got %s", exp, got)
+	}
+
+	f, err := os.Open(filepath.Join(dir, "server-20211002-1.log.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := io.ReadAll(zr)
+	exp = "[2021-10-02 12:00:00] first day\n[2021-10-02 12:00:00] [stderr] failure\n"
+	if string(content) != exp {
+		t.Errorf("expected %q, got %q", exp, content)
+	}
+}
+
+func TestServerLogWriter_SizeRotationAndRetention(t *testing.T) {
+	dir := t.TempDir()
+	w := newServerLogWriter(dir, 10, 2)
+	defer w.Close()
+
+	now := time.Date(2021, 10, 2, 12, 0, 0, 0, time.Local)
+	for i := 0; i < 5; i++ {
+		w.WriteLine(LogLine{Line: strings.Repeat("x", 100), Time: now})
+	}
+
+	exp := "server-20211002-3.log.gz,server-20211002-4.log.gz,server-20211002.log"
+	if got := strings.Join(listLogDir(t, dir), ","); got != exp {
+		t.Errorf("expected %s, got %s", exp, got)
+	}
+}
+
+func TestServerLogWriter_NotTruncated(t *testing.T) {
+	dir := t.TempDir()
+	proc := NewProcess(nil, nil)
+	proc.logFile = newServerLogWriter(dir, 0, 10)
+	defer proc.logFile.Close()
+
+	var logged []string
+	prov := &recordingProvider{log: func(l string) { logged = append(logged, l) }}
+	line := strings.Repeat("y", *maxLineLength+50)
+	now := time.Now()
+	proc.processOutputLine(prov, LogLine{Line: line, Time: now, Source: LogSourceStdout})
+
+	content, err := os.ReadFile(filepath.Join(dir, serverLogPrefix+now.Format(formatServerLogDay)+serverLogSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), line) {
+		t.Errorf("line truncated in log file: %q", content)
+	}
+	if len(logged) != 1 || strings.Contains(logged[0], line) {
+		t.Errorf("console line not truncated: %v", logged)
+	}
+}
+
+// recordingProvider records the console output.
+type recordingProvider struct {
+	Provider
+	log func(line string)
+}
+
+func (p *recordingProvider) Log(line string) {
+	p.log(line)
+}
@@ -0,0 +1,113 @@
+package svrmgr
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+func newTestLogBuffer(size, count int, start time.Time) *LogBuffer {
+	buf := NewLogBuffer(size)
+	for i := 0; i < count; i++ {
+		source := LogSourceStdout
+		if i%2 == 1 {
+			source = LogSourceStderr
+		}
+		buf.Add(LogLine{
+			Line:   fmt.Sprintf("line %d", i),
+			Time:   start.Add(time.Minute * time.Duration(i)),
+			Source: source,
+		})
+	}
+	return buf
+}
+
+func lineTexts(lines []LogLine) string {
+	var out []string
+	for _, l := range lines {
+		out = append(out, l.Line)
+	}
+	return strings.Join(out, ",")
+}
+
+func TestLogBuffer_Bounded(t *testing.T) {
+	buf := newTestLogBuffer(3, 5, time.Now())
+	if buf.Len() != 3 {
+		t.Errorf("expected 3 lines, got %d", buf.Len())
+	}
+	if got := lineTexts(buf.Lines()); got != "line 2,line 3,line 4" {
+		t.Errorf("unexpected lines: %s", got)
+	}
+	if got := lineTexts(buf.Tail(2)); got != "line 3,line 4" {
+		t.Errorf("unexpected tail: %s", got)
+	}
+	if got := lineTexts(buf.Tail(10)); got != "line 2,line 3,line 4" {
+		t.Errorf("unexpected tail: %s", got)
+	}
+}
+
+func TestLogBuffer_GrepSince(t *testing.T) {
+	start := time.Date(2021, 1, 2, 1, 0, 0, 0, time.UTC)
+	buf := newTestLogBuffer(10, 10, start)
+
+	if got := lineTexts(buf.Grep(regexp.MustCompile("line [13]$"))); got != "line 1,line 3" {
+		t.Errorf("unexpected grep: %s", got)
+	}
+	if got := lineTexts(buf.Since(start.Add(time.Minute * 8))); got != "line 8,line 9" {
+		t.Errorf("unexpected since: %s", got)
+	}
+}
+
+func TestLogBuffer_Concurrent(t *testing.T) {
+	buf := NewLogBuffer(100)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				buf.Add(LogLine{Line: "line"})
+				buf.Tail(10)
+			}
+		}()
+	}
+	wg.Wait()
+	if buf.Len() != 100 {
+		t.Errorf("expected 100 lines, got %d", buf.Len())
+	}
+}
+
+func TestLog_Commands(t *testing.T) {
+	st := newSvrMgrTest(t)
+	defer st.close(t)
+
+	start := time.Now().Add(-time.Hour)
+	st.spMock.EXPECT().Logs().AnyTimes().Return(newTestLogBuffer(100, 60, start))
+	st.spMock.EXPECT().Stop(gomock.Any(), gomock.Any())
+
+	st.PushCommandAsync("log tail 2")
+	st.PushCommandAsync("log grep line 1[0-2]$")
+	st.PushCommandAsync("log since 90s")
+	st.PushCommandAsync("log grep nomatch")
+	st.PushCommandAsync("quit")
+
+	err := st.sm.Process(context.Background(), []string{})
+	if err != nil {
+		t.Errorf("expecting nil, got %v", err)
+	}
+	out := st.stdoutLog.String()
+	for _, exp := range []string{"line 58", "[stderr] line 59", "line 10", "line 12", "no matching log lines"} {
+		if !strings.Contains(out, exp) {
+			t.Errorf("expected: %s, Got: %v", exp, out)
+		}
+	}
+	if strings.Contains(out, "line 57") || strings.Contains(out, "line 13") {
+		t.Errorf("unexpected lines in output: %v", out)
+	}
+}
@@ -0,0 +1,24 @@
+//go:build !windows
+// +build !windows
+
+package svrmgr
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+const (
+	defaultBedrockExecutable = "bedrock_server"
+	defaultGitExecutable     = "git"
+)
+
+// setupServerCmd sets up the platform specific process attributes for the bedrock server.
+// Bedrock server for Linux loads its shared libraries from the server directory.
+// The server runs in its own process group so that Ctrl+C on the console is
+// handled by the manager, which then stops the server cleanly.
+func setupServerCmd(cmd *exec.Cmd, serverDir string) {
+	cmd.Env = append(os.Environ(), "LD_LIBRARY_PATH="+serverDir)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
@@ -0,0 +1,14 @@
+package svrmgr
+
+import (
+	"os/exec"
+)
+
+const (
+	defaultBedrockExecutable = "bedrock_server.exe"
+	defaultGitExecutable     = "git.exe"
+)
+
+// setupServerCmd sets up the platform specific process attributes for the bedrock server.
+func setupServerCmd(cmd *exec.Cmd, serverDir string) {
+}
@@ -0,0 +1,200 @@
+package svrmgr
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+var playerSessionsFile = flag.String("player_sessions_file", "player_sessions.jsonl", "file for the player session history. relative to the bedrock server directory. excluded from the backups if inside the git workspace. set to empty to disable")
+
+// Reasons for the end of a session.
+const (
+	sessionEndDisconnect = "disconnect"
+	sessionEndServerExit = "server exit"
+)
+
+// PlayerSession is a single play session of a player.
+type PlayerSession struct {
+	Name      string    `json:"name"`
+	XUID      string    `json:"xuid"`
+	Joined    time.Time `json:"joined"`
+	Left      time.Time `json:"left"`       // Zero if the player is still online.
+	EndReason string    `json:"end_reason"` // Why the session ended. Empty if the player is still online.
+}
+
+// Duration returns the session length. Open sessions are counted until now.
+func (s PlayerSession) Duration(now time.Time) time.Duration {
+	if s.Left.IsZero() {
+		return now.Sub(s.Joined)
+	}
+	return s.Left.Sub(s.Joined)
+}
+
+// playerKey identifies the player across name changes.
+// Players without XUID are identified by name.
+func (s PlayerSession) playerKey() string {
+	if s.XUID != "" {
+		return s.XUID
+	}
+	return "name:" + s.Name
+}
+
+// PlayerStats is the playtime summary of a player.
+type PlayerStats struct {
+	Name      string    `json:"name"`  // Most recently used name.
+	Names     []string  `json:"names"` // All the names used, oldest first.
+	XUID      string    `json:"xuid"`
+	Sessions  int       `json:"sessions"`
+	Playtime  Duration  `json:"playtime"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Online    bool      `json:"online"`
+}
+
+// PlayerHistory is the result of the players history command.
+type PlayerHistory struct {
+	Stats    PlayerStats     `json:"stats"`
+	Sessions []PlayerSession `json:"sessions"` // Oldest first.
+}
+
+// playerSessionStore keeps the completed player sessions.
+// Sessions are appended to a JSON lines file, one session per line.
+// If the path is empty, sessions are kept only in memory.
+type playerSessionStore struct {
+	lock     sync.Mutex
+	path     string
+	sessions []PlayerSession // Completed sessions, oldest first.
+}
+
+// newPlayerSessionStore creates the store and loads the existing sessions.
+// Invalid lines are skipped.
+func newPlayerSessionStore(path string) *playerSessionStore {
+	s := &playerSessionStore{path: path}
+	if path == "" {
+		return s
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			glog.Errorf("unable to read player sessions. %v", err)
+		}
+		return s
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var session PlayerSession
+		if err := json.Unmarshal([]byte(line), &session); err != nil {
+			glog.Errorf("skipping invalid player session at %s:%d. %v", path, n, err)
+			continue
+		}
+		s.sessions = append(s.sessions, session)
+	}
+	return s
+}
+
+// Add records the completed session.
+func (s *playerSessionStore) Add(session PlayerSession) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.sessions = append(s.sessions, session)
+	if s.path == "" {
+		return nil
+	}
+
+	content, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("unable to create directory for %s. %v", s.path, err)
+	}
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to open %s. %v", s.path, err)
+	}
+	if _, err = f.Write(append(content, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("unable to write %s. %v", s.path, err)
+	}
+	return f.Close()
+}
+
+// Sessions returns the completed sessions, oldest first.
+func (s *playerSessionStore) Sessions() []PlayerSession {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]PlayerSession{}, s.sessions...)
+}
+
+// playerStats summarizes the sessions by player, most playtime first.
+// Open sessions are counted until now.
+func playerStats(sessions []PlayerSession, now time.Time) []PlayerStats {
+	byKey := map[string]*PlayerStats{}
+	var order []string
+	for _, s := range sortSessions(sessions) {
+		key := s.playerKey()
+		st, ok := byKey[key]
+		if !ok {
+			st = &PlayerStats{XUID: s.XUID, FirstSeen: s.Joined}
+			byKey[key] = st
+			order = append(order, key)
+		}
+		st.Sessions++
+		st.Playtime += Duration(s.Duration(now))
+		st.Name = s.Name
+		st.Names = appendName(st.Names, s.Name)
+		lastSeen := s.Left
+		if s.Left.IsZero() {
+			lastSeen = now
+			st.Online = true
+		}
+		if lastSeen.After(st.LastSeen) {
+			st.LastSeen = lastSeen
+		}
+	}
+
+	var result []PlayerStats
+	for _, key := range order {
+		result = append(result, *byKey[key])
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Playtime > result[j].Playtime
+	})
+	return result
+}
+
+// appendName adds the name unless already present.
+func appendName(names []string, name string) []string {
+	for _, n := range names {
+		if n == name {
+			return names
+		}
+	}
+	return append(names, name)
+}
+
+// sortSessions returns the sessions sorted by join time.
+func sortSessions(sessions []PlayerSession) []PlayerSession {
+	sorted := append([]PlayerSession{}, sessions...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Joined.Before(sorted[j].Joined)
+	})
+	return sorted
+}
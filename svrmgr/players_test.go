@@ -0,0 +1,264 @@
+package svrmgr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+func playerLine(t time.Time, event, name, xuid string) LogLine {
+	return LogLine{
+		Line: fmt.Sprintf("[%s INFO] Player %s: %s, xuid: %s", t.Format("2006-01-02 15:04:05:000"), event, name, xuid),
+		Time: t,
+	}
+}
+
+func TestParsePlayerEvent(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		line string
+		exp  playerEvent
+		ok   bool
+	}{
+		{"[2021-10-02 12:00:00:000 INFO] Player connected: Steve, xuid: 2535412345678901",
+			playerEvent{Player{"Steve", "2535412345678901", now}, true}, true},
+		{"[2021-10-02 12:00:00:000 INFO] Player disconnected: Alex Two, xuid: 2535400000000001\r",
+			playerEvent{Player{"Alex Two", "2535400000000001", now}, false}, true},
+		{"[INFO] Player connected: Offline, xuid: ", playerEvent{Player{"Offline", "", now}, true}, true},
+		{"[2024-05-01 12:00:00:000 INFO] Player connected: Steve, xuid: 2535412345678901, pfid: 1a2b3c4d5e6f7a8b",
+			playerEvent{Player{"Steve", "2535412345678901", now}, true}, true},
+		{"[2024-05-01 12:00:00:000 INFO] Player disconnected: Alex Two, xuid: 2535400000000001, pfid: 1a2b3c4d5e6f7a8b\r",
+			playerEvent{Player{"Alex Two", "2535400000000001", now}, false}, true},
+		{"[INFO] Server started.", playerEvent{}, false},
+		{"Player connected: Steve", playerEvent{}, false},
+	}
+	for _, tc := range tests {
+		ev, ok := parsePlayerEvent(LogLine{Line: tc.line, Time: now})
+		if ok != tc.ok || ev != tc.exp {
+			t.Errorf("%s: expected %v %v, got %v %v", tc.line, tc.exp, tc.ok, ev, ok)
+		}
+	}
+}
+
+func TestPlayers_Tracking(t *testing.T) {
+	st := newSvrMgrTest(t)
+	defer st.close(t)
+
+	now := time.Now()
+	st.sm.notifyServerOutput(playerLine(now.Add(-time.Hour), "connected", "Steve", "1"))
+	st.sm.notifyServerOutput(playerLine(now.Add(-time.Minute), "connected", "Alex", "2"))
+	st.sm.notifyServerOutput(playerLine(now.Add(-time.Minute*2), "connected", "Notch", "3"))
+	st.sm.notifyServerOutput(playerLine(now, "disconnected", "Notch", "3"))
+
+	ph := st.sm.handlers["players"].(*playersHandler)
+	online := ph.Online()
+	if len(online) != 2 || online[0].Name != "Steve" || online[1].Name != "Alex" || online[1].XUID != "2" {
+		t.Fatalf("unexpected online players %v", online)
+	}
+
+	st.spMock.EXPECT().IsRunning().Return(true)
+	st.gwMock.EXPECT().IsDirClean(gomock.Any()).Return(true, nil)
+	st.expectStorageStats()
+	st.spMock.EXPECT().Stop(gomock.Any(), gomock.Any())
+
+	st.PushCommandAsync("players")
+	st.PushCommandAsync("status")
+	st.PushCommandAsync("quit")
+	if err := st.sm.Process(context.Background(), []string{}); err != nil {
+		t.Errorf("expecting nil, got %v", err)
+	}
+	for _, exp := range []string{
+		"2 players online:",
+		"Steve (xuid: 1) connected at",
+		"Alex (xuid: 2)",
+		"server is running with 2 players online",
+	} {
+		if !strings.Contains(st.stdoutLog.String(), exp) {
+			t.Errorf("expected: %s, Got: %v", exp, st.stdoutLog.String())
+		}
+	}
+	if strings.Contains(st.stdoutLog.String(), "Notch (") {
+		t.Errorf("disconnected player listed. %v", st.stdoutLog.String())
+	}
+}
+
+func TestPlayers_ResetOnExit(t *testing.T) {
+	st := newSvrMgrTest(t)
+	defer st.close(t)
+
+	st.sm.notifyServerOutput(playerLine(time.Now(), "connected", "Steve", "1"))
+	ph := st.sm.handlers["players"].(*playersHandler)
+	if ph.Count() != 1 {
+		t.Fatalf("expected 1 player, got %d", ph.Count())
+	}
+
+	st.sm.notifyServerExit(ServerExit{Time: time.Now(), Intentional: true})
+	if ph.Count() != 0 {
+		t.Errorf("players not reset on exit. %v", ph.Online())
+	}
+
+	st.spMock.EXPECT().Stop(gomock.Any(), gomock.Any())
+	st.PushCommandAsync("players list")
+	st.PushCommandAsync("quit")
+	if err := st.sm.Process(context.Background(), []string{}); err != nil {
+		t.Errorf("expecting nil, got %v", err)
+	}
+	if !strings.Contains(st.stdoutLog.String(), "no players online") {
+		t.Errorf("expected: no players online, Got: %v", st.stdoutLog.String())
+	}
+}
+
+func TestPlayerSessionStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions", "player_sessions.jsonl")
+	now := time.Now().Truncate(time.Second)
+	store := newPlayerSessionStore(path)
+	sessions := []PlayerSession{
+		{"Steve", "1", now.Add(-3 * time.Hour), now.Add(-2 * time.Hour), sessionEndDisconnect},
+		{"Alex", "2", now.Add(-time.Hour), now, sessionEndServerExit},
+	}
+	for _, s := range sessions {
+		if err := store.Add(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("not json\n")
+	f.Close()
+
+	loaded := newPlayerSessionStore(path).Sessions()
+	if len(loaded) != 2 {
+		t.Fatalf("expected 2 sessions, got %v", loaded)
+	}
+	for i := range sessions {
+		if !loaded[i].Joined.Equal(sessions[i].Joined) || !loaded[i].Left.Equal(sessions[i].Left) ||
+			loaded[i].Name != sessions[i].Name || loaded[i].EndReason != sessions[i].EndReason {
+			t.Errorf("expected %v, got %v", sessions[i], loaded[i])
+		}
+	}
+}
+
+func TestPlayerStats(t *testing.T) {
+	now := time.Now()
+	stats := playerStats([]PlayerSession{
+		{"Alex", "2", now.Add(-5 * time.Hour), now.Add(-4 * time.Hour), sessionEndDisconnect},
+		{"Steve", "1", now.Add(-10 * time.Hour), now.Add(-9 * time.Hour), sessionEndDisconnect},
+		{"Steve2", "1", now.Add(-2 * time.Hour), now.Add(-time.Hour), sessionEndServerExit},
+		{"Steve3", "1", now.Add(-time.Minute), time.Time{}, ""},
+	}, now)
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 players, got %v", stats)
+	}
+	st := stats[0]
+	if st.XUID != "1" || st.Name != "Steve3" || st.Sessions != 3 || !st.Online ||
+		time.Duration(st.Playtime) != 2*time.Hour+time.Minute || strings.Join(st.Names, ",") != "Steve,Steve2,Steve3" ||
+		!st.FirstSeen.Equal(now.Add(-10*time.Hour)) || !st.LastSeen.Equal(now) {
+		t.Errorf("unexpected stats %+v", st)
+	}
+	if stats[1].Name != "Alex" || stats[1].Online || time.Duration(stats[1].Playtime) != time.Hour {
+		t.Errorf("unexpected stats %+v", stats[1])
+	}
+}
+
+func TestPlayers_HistoryAndTop(t *testing.T) {
+	st := newSvrMgrTest(t)
+	defer st.close(t)
+
+	now := time.Now()
+	ph := st.sm.handlers["players"].(*playersHandler)
+	ph.nowFn = func() time.Time { return now }
+	st.sm.notifyServerOutput(playerLine(now.Add(-3*time.Hour), "connected", "Steve", "1"))
+	st.sm.notifyServerOutput(playerLine(now.Add(-2*time.Hour), "disconnected", "Steve", "1"))
+	st.sm.notifyServerOutput(playerLine(now.Add(-90*time.Minute), "connected", "Alex", "2"))
+	st.sm.notifyServerOutput(playerLine(now.Add(-time.Hour), "connected", "SteveNew", "1"))
+
+	st.spMock.EXPECT().Stop(gomock.Any(), gomock.Any())
+	st.PushCommandAsync("players history Steve")
+	st.PushCommandAsync("players top 1")
+	st.PushCommandAsync("players history Herobrine")
+	st.PushCommandAsync("quit")
+	if err := st.sm.Process(context.Background(), []string{}); err != nil {
+		t.Errorf("expecting nil, got %v", err)
+	}
+	for _, exp := range []string{
+		"SteveNew (xuid: 1): 2 sessions, playtime 2h0m0s",
+		"names: Steve, SteveNew",
+		"online now (1h0m0s)",
+		"1. SteveNew 2h0m0s (2 sessions",
+		"no sessions found for 'Herobrine'",
+	} {
+		if !strings.Contains(st.stdoutLog.String(), exp) {
+			t.Errorf("expected: %s, Got: %v", exp, st.stdoutLog.String())
+		}
+	}
+	if strings.Contains(st.stdoutLog.String(), "2. Alex") {
+		t.Errorf("top count ignored. %v", st.stdoutLog.String())
+	}
+}
+
+func TestPlayers_SessionsClosedOnCrash(t *testing.T) {
+	st := newSvrMgrTest(t)
+	defer st.close(t)
+
+	path := filepath.Join(t.TempDir(), "player_sessions.jsonl")
+	ph := st.sm.handlers["players"].(*playersHandler)
+	ph.store = newPlayerSessionStore(path)
+
+	now := time.Now()
+	st.sm.notifyServerOutput(playerLine(now.Add(-time.Hour), "connected", "Steve", "1"))
+	st.sm.notifyServerOutput(playerLine(now.Add(-time.Minute), "connected", "Alex", "2"))
+	ph.onServerExit(st.sm, ServerExit{Time: now, Err: fmt.Errorf("exit status 1")})
+
+	sessions := newPlayerSessionStore(path).Sessions()
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %v", sessions)
+	}
+	for _, s := range sessions {
+		if !s.Left.Equal(now) || s.EndReason != sessionEndServerExit {
+			t.Errorf("session not closed at exit. %+v", s)
+		}
+	}
+}
+
+func TestAPI_Players(t *testing.T) {
+	at := newAPITest(t)
+	defer at.close(t)
+
+	now := time.Now()
+	at.sm.notifyServerOutput(playerLine(now.Add(-time.Hour), "connected", "Steve", "1"))
+	at.sm.notifyServerOutput(playerLine(now, "disconnected", "Steve", "1"))
+
+	code, resp := at.request(t, http.MethodGet, "/api/players/top?count=5", "")
+	if code != http.StatusOK || resp.Error != "" {
+		t.Fatalf("unexpected response %d %v", code, resp)
+	}
+	var top []map[string]interface{}
+	if err := json.Unmarshal(resp.Result, &top); err != nil {
+		t.Fatalf("invalid result %s. %v", resp.Result, err)
+	}
+	if len(top) != 1 || top[0]["name"] != "Steve" || top[0]["playtime"] != "1h0m0s" {
+		t.Errorf("unexpected result %s", resp.Result)
+	}
+
+	code, resp = at.request(t, http.MethodGet, "/api/players/history?name=Steve", "")
+	if code != http.StatusOK || !strings.Contains(string(resp.Result), `"end_reason":"disconnect"`) {
+		t.Errorf("unexpected response %d %v", code, resp)
+	}
+	if code, _ = at.request(t, http.MethodGet, "/api/players/history", ""); code != http.StatusBadRequest {
+		t.Errorf("expected %d, got %d", http.StatusBadRequest, code)
+	}
+	if code, _ = at.request(t, http.MethodGet, "/api/players/top?count=x", ""); code != http.StatusBadRequest {
+		t.Errorf("expected %d, got %d", http.StatusBadRequest, code)
+	}
+}
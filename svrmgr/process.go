@@ -7,52 +7,105 @@ import (
 	"fmt"
 	"io"
 	"os/exec"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/fieryorc/BedrockServerManager/winutils"
 	"github.com/golang/glog"
 )
 
 //go:generate mockgen -package svrmgr -source=process.go -destination=process_mocks_test.go
 
 var maxLineLength = flag.Int("server_output_line_limit", 100, "max line length for server output. longer lines will be truncated to this size")
+var logBufferLines = flag.Int("server_log_buffer_lines", 5000, "number of server output lines kept in memory for the log command")
+var exitLogLines = flag.Int("server_exit_log_lines", 20, "number of server output lines to record when the server exits")
+
+// serverQuitMarker is printed by the bedrock server once it has shut down cleanly.
+const serverQuitMarker = "Quit correctly"
 
 // LogLine represents a single line of the log
 type LogLine struct {
-	Line string
-	Time time.Time
+	Line   string    `json:"line"`
+	Time   time.Time `json:"time"`
+	Source LogSource `json:"source"`
+}
+
+// ServerExit describes how the server process ended.
+type ServerExit struct {
+	Time        time.Time
+	Err         error     // Exit error. nil if the server exited with success.
+	Intentional bool      // True if the stop was requested by the manager.
+	LastLines   []LogLine // Last lines of the server output before exit.
+}
+
+// IsCrash returns true if the server exited with failure without being asked to.
+func (e ServerExit) IsCrash() bool {
+	return !e.Intentional && e.Err != nil
 }
 
 // serverProcess encapsulates the bedrock server running process.
 type serverProcess struct {
-	provider     Provider
-	cmd          *exec.Cmd
-	stdOut       io.ReadCloser
-	stdErr       io.ReadCloser
-	stdIn        io.WriteCloser
-	stdoutLines  []LogLine
-	outputReader chan string // When set, the output is sent to this channel.
+	provider Provider
+	cmd      *exec.Cmd
+	stdOut   io.ReadCloser
+	stdErr   io.ReadCloser
+	stdIn    io.WriteCloser
+	logs     *LogBuffer       // Recent server output.
+	logFile  *serverLogWriter // When set, the output is written to log files.
+	events   *EventBus        // Server output and exit events are published here.
+
+	lock          sync.Mutex
+	running       bool                          // True while the server process is running.
+	starting      bool                          // True while Start is starting the process.
+	exited        chan struct{}                 // Closed when the running process exits.
+	quitCorrectly bool                          // True if the server reported a clean shutdown.
+	stopRequested bool                          // True if the manager asked the server to stop.
+	readers       map[chan string]*outputReader // Output readers by channel.
+}
+
+// outputReader forwards the server output events to the reader channel.
+type outputReader struct {
+	sub  *Subscription
+	done chan struct{} // Closed once the reader channel is closed.
 }
 
 type ServerProcess interface {
 	SetCmd(cmd *exec.Cmd)
 	SendInput(line string) error
 	StartReadOutput(c chan string)
-	EndReadOutput()
+	EndReadOutput(c chan string)
 	Start(ctx context.Context, provider Provider) error
 	IsRunning() bool
+	Stop(ctx context.Context, timeout time.Duration) error
 	Kill() error
+	Logs() *LogBuffer
 }
 
 // NewProcess creates new process.
+// Events are published on the provider's event bus, if there is a provider.
 func NewProcess(provider Provider, cmd *exec.Cmd) *serverProcess {
+	events := NewEventBus()
+	if provider != nil {
+		events = provider.Events()
+	}
 	return &serverProcess{
 		provider: provider,
 		cmd:      cmd,
+		logs:     NewLogBuffer(*logBufferLines),
+		events:   events,
+		readers:  map[chan string]*outputReader{},
 	}
 }
 
 // SetCmd sets the underlying command.
+// The command of a running server is not replaced.
 func (proc *serverProcess) SetCmd(cmd *exec.Cmd) {
+	proc.lock.Lock()
+	defer proc.lock.Unlock()
+	if proc.running || proc.starting {
+		return
+	}
 	proc.cmd = cmd
 }
 
@@ -62,9 +115,8 @@ func (proc *serverProcess) SendInput(line string) error {
 		return fmt.Errorf("server not running. cannot send input")
 	}
 
-	line += "\r\n"
-	lineBytes := []byte(line)
 	proc.provider.Log(fmt.Sprintf(">%s", line))
+	lineBytes := []byte(winutils.AddNewLine(line))
 	n, err := proc.stdIn.Write(lineBytes)
 	if n != len(lineBytes) {
 		return fmt.Errorf("unable to write to bedrock server")
@@ -72,58 +124,193 @@ func (proc *serverProcess) SendInput(line string) error {
 	return err
 }
 
-// StartReadOutput sets the reader channel.
-// All subsequent output from the server will be sent to this channel.
+// StartReadOutput starts sending the server output to the channel.
+// All subsequent output lines are sent to the channel until EndReadOutput is
+// called or the server exits, after which the channel is closed.
+// Any number of readers can read the output at the same time. Lines are dropped
+// if the reader falls behind by more than defaultSubscriptionBuffer lines.
 func (proc *serverProcess) StartReadOutput(c chan string) {
-	proc.outputReader = c
+	r := &outputReader{
+		sub:  proc.events.Subscribe(defaultSubscriptionBuffer, EventServerOutput, EventServerStopped, EventServerCrashed),
+		done: make(chan struct{}),
+	}
+	proc.lock.Lock()
+	proc.readers[c] = r
+	proc.lock.Unlock()
+
+	go func() {
+		defer close(r.done)
+		defer close(c)
+		defer r.sub.Unsubscribe()
+		for {
+			select {
+			case ev := <-r.sub.C:
+				if ev.Type != EventServerOutput {
+					return
+				}
+				select {
+				case c <- ev.Line.Line:
+				case <-r.sub.Done():
+					return
+				}
+			case <-r.sub.Done():
+				return
+			}
+		}
+	}()
 }
 
-// EndReadOutput resets the output reader.
-func (proc *serverProcess) EndReadOutput() {
-	if proc.outputReader != nil {
-		close(proc.outputReader)
-		proc.outputReader = nil
+// EndReadOutput stops sending the output to the channel and closes it.
+// Safe to call while the output is being sent.
+func (proc *serverProcess) EndReadOutput(c chan string) {
+	proc.lock.Lock()
+	r, ok := proc.readers[c]
+	delete(proc.readers, c)
+	proc.lock.Unlock()
+	if !ok {
+		return
 	}
+
+	r.sub.Unsubscribe()
+	<-r.done
 }
 
 // Start the server process.
+// Returns once the process has been started. If the process cannot be
+// started, the error is returned and no exit event is published.
 func (proc *serverProcess) Start(ctx context.Context, provider Provider) error {
-	var err error
-
-	if proc.IsRunning() {
-		return fmt.Errorf("already running")
+	proc.lock.Lock()
+	if proc.running || proc.starting {
+		proc.lock.Unlock()
+		return conflictErrorf("server already running")
 	}
+	proc.starting = true
+	proc.lock.Unlock()
 
-	proc.stdOut, _ = proc.cmd.StdoutPipe()
-	proc.stdErr, _ = proc.cmd.StderrPipe()
-	proc.stdIn, _ = proc.cmd.StdinPipe()
+	exited := make(chan struct{})
+	err := proc.startCmd()
+	proc.lock.Lock()
+	proc.starting = false
+	if err == nil {
+		proc.running = true
+		proc.exited = exited
+		proc.quitCorrectly = false
+		proc.stopRequested = false
+	}
+	proc.lock.Unlock()
+	if err != nil {
+		return fmt.Errorf("unable to start bedrock server. %v", err)
+	}
 
 	go func() {
-		if err := proc.cmd.Start(); err != nil {
-			provider.Log(fmt.Sprintf("unable to start bedrock server. %v", err))
-		}
-		go proc.handleStdOut(provider, proc.stdOut, true)
-		go proc.handleStdOut(provider, proc.stdErr, false)
-		err = proc.cmd.Wait()
+		defer close(exited)
+		// Wait must be called only after all the output is read.
+		var readers sync.WaitGroup
+		readers.Add(2)
+		go func() {
+			defer readers.Done()
+			proc.handleStdOut(provider, proc.stdOut, LogSourceStdout)
+		}()
+		go func() {
+			defer readers.Done()
+			proc.handleStdOut(provider, proc.stdErr, LogSourceStderr)
+		}()
+		readers.Wait()
+		err := proc.cmd.Wait()
 		if err != nil {
 			provider.Log(fmt.Sprintf("server exited with failure. %v", err))
 		} else {
 			provider.Log("server exited with success")
 		}
-		proc.EndReadOutput()
+
+		proc.lock.Lock()
+		proc.running = false
+		exit := ServerExit{
+			Time:        time.Now(),
+			Err:         err,
+			Intentional: proc.stopRequested,
+			LastLines:   proc.logs.Tail(*exitLogLines),
+		}
+		proc.lock.Unlock()
+
+		evType := EventServerStopped
+		if exit.IsCrash() {
+			evType = EventServerCrashed
+		}
+		proc.events.Publish(Event{Type: evType, Time: exit.Time, Exit: &exit})
 	}()
 	return nil
 }
 
+// startCmd connects the pipes and starts the command.
+func (proc *serverProcess) startCmd() error {
+	var err error
+	if proc.stdOut, err = proc.cmd.StdoutPipe(); err != nil {
+		return err
+	}
+	if proc.stdErr, err = proc.cmd.StderrPipe(); err != nil {
+		return err
+	}
+	if proc.stdIn, err = proc.cmd.StdinPipe(); err != nil {
+		return err
+	}
+	return proc.cmd.Start()
+}
+
 // IsRunning returns true if the server is running.
 func (proc *serverProcess) IsRunning() bool {
-	return proc.cmd != nil && proc.cmd.Process != nil && proc.cmd.ProcessState == nil
+	proc.lock.Lock()
+	defer proc.lock.Unlock()
+	return proc.running
+}
+
+// Stop the running server gracefully.
+// Sends the `stop` command and waits for the server to exit. If the server
+// does not exit within the timeout, the process is killed.
+func (proc *serverProcess) Stop(ctx context.Context, timeout time.Duration) error {
+	if !proc.IsRunning() {
+		return nil
+	}
+
+	proc.lock.Lock()
+	exited := proc.exited
+	proc.stopRequested = true
+	proc.lock.Unlock()
+
+	if err := proc.SendInput("stop"); err != nil {
+		proc.provider.Log(fmt.Sprintf("unable to send stop command. killing the server. %v", err))
+		return proc.Kill()
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	select {
+	case <-exited:
+		proc.lock.Lock()
+		quitCorrectly := proc.quitCorrectly
+		proc.lock.Unlock()
+		if !quitCorrectly {
+			proc.provider.Log("server exited without reporting a clean shutdown")
+		}
+		return nil
+	case <-ctxTimeout.Done():
+		proc.provider.Log(fmt.Sprintf("server did not stop within %v. killing the server", timeout))
+		return proc.Kill()
+	}
+}
+
+// Logs returns the recent server output.
+func (proc *serverProcess) Logs() *LogBuffer {
+	return proc.logs
 }
 
 // Kill the running server process.
 func (proc *serverProcess) Kill() error {
 	if proc.IsRunning() {
 		glog.Infof("killing bedrock server")
+		proc.lock.Lock()
+		proc.stopRequested = true
+		proc.lock.Unlock()
 		return proc.cmd.Process.Kill()
 	}
 	return nil
@@ -132,25 +319,35 @@ func (proc *serverProcess) Kill() error {
 // handleStdOut should be run in its own go routine.
 // Reads the server output and does the necessary processing.
 // All server output is automatically printed to the console with timestamp.
-func (proc *serverProcess) handleStdOut(provider Provider, stdOut io.ReadCloser, capture bool) {
+func (proc *serverProcess) handleStdOut(provider Provider, stdOut io.ReadCloser, source LogSource) {
 	scanner := bufio.NewScanner(stdOut)
 	scanner.Split(bufio.ScanLines)
 	for scanner.Scan() {
 		line := scanner.Text()
-		proc.processOutputLine(provider, line)
-		if capture {
-			proc.stdoutLines = append(proc.stdoutLines, LogLine{Line: line, Time: time.Now()})
-		}
-		if proc.outputReader != nil {
-			proc.outputReader <- line
+		logLine := LogLine{Line: line, Time: time.Now(), Source: source}
+		proc.processOutputLine(provider, logLine)
+		if strings.Contains(line, serverQuitMarker) {
+			proc.lock.Lock()
+			proc.quitCorrectly = true
+			proc.lock.Unlock()
 		}
+		proc.events.Publish(Event{Type: EventServerOutput, Time: logLine.Time, Line: &logLine})
 	}
 	glog.Infof("scanner completed")
 }
 
-// processOutputLine writes line to the console.
-func (proc *serverProcess) processOutputLine(provider Provider, line string) {
+// processOutputLine records the line and writes it to the console.
+// Lines are truncated only for the console.
+func (proc *serverProcess) processOutputLine(provider Provider, logLine LogLine) {
+	line := logLine.Line
 	glog.Infof(line)
+	proc.logs.Add(logLine)
+	if proc.logFile != nil {
+		if err := proc.logFile.WriteLine(logLine); err != nil {
+			glog.Errorf("unable to write server log. %v", err)
+		}
+	}
+
 	if len(line) > *maxLineLength {
 		line = line[:*maxLineLength] + " ..."
 	}
@@ -8,6 +8,7 @@ import (
 	context "context"
 	exec "os/exec"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 )
@@ -36,15 +37,15 @@ func (m *MockServerProcess) EXPECT() *MockServerProcessMockRecorder {
 }
 
 // EndReadOutput mocks base method.
-func (m *MockServerProcess) EndReadOutput() {
+func (m *MockServerProcess) EndReadOutput(c chan string) {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "EndReadOutput")
+	m.ctrl.Call(m, "EndReadOutput", c)
 }
 
 // EndReadOutput indicates an expected call of EndReadOutput.
-func (mr *MockServerProcessMockRecorder) EndReadOutput() *gomock.Call {
+func (mr *MockServerProcessMockRecorder) EndReadOutput(c interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EndReadOutput", reflect.TypeOf((*MockServerProcess)(nil).EndReadOutput))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EndReadOutput", reflect.TypeOf((*MockServerProcess)(nil).EndReadOutput), c)
 }
 
 // IsRunning mocks base method.
@@ -75,6 +76,20 @@ func (mr *MockServerProcessMockRecorder) Kill() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Kill", reflect.TypeOf((*MockServerProcess)(nil).Kill))
 }
 
+// Logs mocks base method.
+func (m *MockServerProcess) Logs() *LogBuffer {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Logs")
+	ret0, _ := ret[0].(*LogBuffer)
+	return ret0
+}
+
+// Logs indicates an expected call of Logs.
+func (mr *MockServerProcessMockRecorder) Logs() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Logs", reflect.TypeOf((*MockServerProcess)(nil).Logs))
+}
+
 // SendInput mocks base method.
 func (m *MockServerProcess) SendInput(line string) error {
 	m.ctrl.T.Helper()
@@ -126,3 +141,17 @@ func (mr *MockServerProcessMockRecorder) StartReadOutput(c interface{}) *gomock.
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StartReadOutput", reflect.TypeOf((*MockServerProcess)(nil).StartReadOutput), c)
 }
+
+// Stop mocks base method.
+func (m *MockServerProcess) Stop(ctx context.Context, timeout time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stop", ctx, timeout)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Stop indicates an expected call of Stop.
+func (mr *MockServerProcessMockRecorder) Stop(ctx, timeout interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stop", reflect.TypeOf((*MockServerProcess)(nil).Stop), ctx, timeout)
+}
@@ -0,0 +1,92 @@
+package svrmgr
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newRealProcessTest creates a server manager that runs the fake bedrock server.
+func newRealProcessTest(t *testing.T) (*ServerManager, *syncBuffer) {
+	out := &syncBuffer{}
+	sm := newServerManagerForTests()
+	sm.stdout = out
+	sm.loadPlugings()
+	return sm, out
+}
+
+func waitForOutput(t *testing.T, out *syncBuffer, exp string) {
+	deadline := time.Now().Add(time.Second * 10)
+	for !strings.Contains(out.String(), exp) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for: %s, Got: %v", exp, out.String())
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestProcess_RealServerStartStop(t *testing.T) {
+	sm, out := newRealProcessTest(t)
+	ctx := context.Background()
+
+	if err := sm.RunCommand(ctx, "start"); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	if !sm.GetServerProcess().IsRunning() {
+		t.Fatalf("server not running. %v", out.String())
+	}
+
+	// Commands must reach the server with the platform new line.
+	if err := sm.RunCommand(ctx, "server foo"); err != nil {
+		t.Errorf("expecting nil, got %v", err)
+	}
+	waitForOutput(t, out, `Unknown command: "foo"`)
+
+	if err := sm.RunCommand(ctx, "stop"); err != nil {
+		t.Errorf("expecting nil, got %v", err)
+	}
+	waitForOutput(t, out, "server exited with success")
+	if strings.Contains(out.String(), "killing") || strings.Contains(out.String(), "without reporting a clean shutdown") {
+		t.Errorf("server not stopped gracefully. %v", out.String())
+	}
+	if sm.GetServerProcess().IsRunning() {
+		t.Errorf("server still running")
+	}
+}
+
+func TestProcess_Shutdown(t *testing.T) {
+	sm, out := newRealProcessTest(t)
+	ctx := context.Background()
+
+	if err := sm.RunCommand(ctx, "start"); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	if err := sm.Shutdown(ctx); err != nil {
+		t.Errorf("expecting nil, got %v", err)
+	}
+	waitForOutput(t, out, "Quit correctly")
+	if sm.GetServerProcess().IsRunning() {
+		t.Errorf("server still running")
+	}
+}
+
+func TestProcess_StartFailure(t *testing.T) {
+	sm, _ := newRealProcessTest(t)
+	ctx := context.Background()
+	sub := sm.Events().Subscribe(defaultSubscriptionBuffer, EventServerStopped, EventServerCrashed)
+	defer sub.Unsubscribe()
+
+	proc := sm.InitServer(ctx, "./does-not-exist", ".", nil)
+	if err := proc.Start(ctx, sm); err == nil {
+		t.Fatalf("expecting error, got nil")
+	}
+	if proc.IsRunning() {
+		t.Errorf("server running after failed start")
+	}
+	select {
+	case ev := <-sub.C:
+		t.Errorf("expecting no exit event, got %v", ev.Type)
+	case <-time.After(time.Millisecond * 200):
+	}
+}
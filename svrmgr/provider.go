@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os/exec"
+	"path/filepath"
 	"time"
 
 	"github.com/fieryorc/BedrockServerManager/winutils"
@@ -36,6 +37,10 @@ type Provider interface {
 	GitWrapper() GitWrapper
 	// GetHandler returns the handler for the command.
 	GetHandler(cmd string) (Handler, error)
+	// ReloadConfig reloads the config file and applies the changed settings.
+	ReloadConfig() error
+	// Events returns the event bus for the server, player and backup events.
+	Events() *EventBus
 }
 
 // Register a handler for given command.
@@ -55,13 +60,13 @@ func (sm *ServerManager) Printf(format string, args ...interface{}) {
 }
 
 func (sm *ServerManager) Printfln(format string, args ...interface{}) {
-	glog.Infof("OUT: %s\r\n", fmt.Sprintf(format, args...))
+	glog.Infof("OUT: %s", fmt.Sprintf(format, args...))
 	io.WriteString(sm.stdout, winutils.AddNewLine(fmt.Sprintf(format, args...)))
 }
 
 // Log output to the console. Usually always visible, and includes timestamp
 func (sm *ServerManager) Log(line string) {
-	glog.Infof("OUT: [%s] %s\r\n", time.Now().Local().Format("20060102-15:04:05"), line)
+	glog.Infof("OUT: [%s] %s", time.Now().Local().Format("20060102-15:04:05"), line)
 	io.WriteString(sm.stdout, winutils.AddNewLine(fmt.Sprintf("[%s] %s", time.Now().Local().Format("20060102-15:04:05"), line)))
 }
 
@@ -72,6 +77,7 @@ func (sm *ServerManager) RunCommand(ctx context.Context, cmd string) error {
 func (sm *ServerManager) InitServer(ctx context.Context, path, dir string, args []string) ServerProcess {
 	cmd := exec.CommandContext(ctx, path)
 	cmd.Dir = dir
+	setupServerCmd(cmd, filepath.Dir(path))
 	sm.serverProcess.SetCmd(cmd)
 	return sm.serverProcess
 }
@@ -91,3 +97,11 @@ func (sm *ServerManager) GetHandler(name string) (Handler, error) {
 	}
 	return h, nil
 }
+
+func (sm *ServerManager) ReloadConfig() error {
+	return sm.config.Reload(sm)
+}
+
+func (sm *ServerManager) Events() *EventBus {
+	return sm.events
+}
@@ -34,6 +34,20 @@ func (m *MockProvider) EXPECT() *MockProviderMockRecorder {
 	return m.recorder
 }
 
+// Events mocks base method.
+func (m *MockProvider) Events() *EventBus {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Events")
+	ret0, _ := ret[0].(*EventBus)
+	return ret0
+}
+
+// Events indicates an expected call of Events.
+func (mr *MockProviderMockRecorder) Events() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Events", reflect.TypeOf((*MockProvider)(nil).Events))
+}
+
 // GetHandler mocks base method.
 func (m *MockProvider) GetHandler(cmd string) (Handler, error) {
 	m.ctrl.T.Helper()
@@ -149,6 +163,32 @@ func (mr *MockProviderMockRecorder) Println(str interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Println", reflect.TypeOf((*MockProvider)(nil).Println), str)
 }
 
+// Register mocks base method.
+func (m *MockProvider) Register(cmd string, handler Handler) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Register", cmd, handler)
+}
+
+// Register indicates an expected call of Register.
+func (mr *MockProviderMockRecorder) Register(cmd, handler interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Register", reflect.TypeOf((*MockProvider)(nil).Register), cmd, handler)
+}
+
+// ReloadConfig mocks base method.
+func (m *MockProvider) ReloadConfig() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReloadConfig")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReloadConfig indicates an expected call of ReloadConfig.
+func (mr *MockProviderMockRecorder) ReloadConfig() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReloadConfig", reflect.TypeOf((*MockProvider)(nil).ReloadConfig))
+}
+
 // RunCommand mocks base method.
 func (m *MockProvider) RunCommand(ctx context.Context, cmd string) error {
 	m.ctrl.T.Helper()
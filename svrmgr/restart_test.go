@@ -0,0 +1,247 @@
+package svrmgr
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// recordHandler records the commands instead of running them.
+type recordHandler struct {
+	cmds chan []string
+	err  error // Returned by Handle.
+}
+
+func (h *recordHandler) Handle(ctx context.Context, provider Provider, cmd []string) error {
+	h.cmds <- cmd
+	return h.err
+}
+
+type restartTest struct {
+	*svrmgrTest
+	rh     *restartHandler
+	start  *recordHandler
+	now    time.Time
+	fire   chan time.Time
+	lock   sync.Mutex
+	delays []time.Duration
+}
+
+func newRestartTest(t *testing.T) *restartTest {
+	rt := &restartTest{
+		svrmgrTest: newSvrMgrTest(t),
+		start:      &recordHandler{cmds: make(chan []string, 10)},
+		now:        time.Date(2021, 1, 2, 3, 0, 0, 0, time.Local),
+		fire:       make(chan time.Time),
+	}
+	rt.sm.handlers["start"] = rt.start
+	rt.rh = rt.sm.handlers["restart"].(*restartHandler)
+	rt.rh.warning = 0
+	rt.rh.nowFn = func() time.Time {
+		return rt.now
+	}
+	rt.rh.afterFn = func(d time.Duration) <-chan time.Time {
+		rt.lock.Lock()
+		defer rt.lock.Unlock()
+		rt.delays = append(rt.delays, d)
+		return rt.fire
+	}
+	return rt
+}
+
+func TestParseTimesOfDay(t *testing.T) {
+	times, err := parseTimesOfDay("16:30, 04:00,")
+	if err != nil || len(times) != 2 || times[0] != (timeOfDay{4, 0}) || times[1] != (timeOfDay{16, 30}) {
+		t.Errorf("unexpected times %v %v", times, err)
+	}
+	for _, str := range []string{"25:00", "4pm", "04:00,x"} {
+		if _, err := parseTimesOfDay(str); err == nil {
+			t.Errorf("%s: expected error", str)
+		}
+	}
+
+	now := time.Date(2021, 1, 2, 3, 0, 0, 0, time.Local)
+	if next := (timeOfDay{4, 0}).next(now); !next.Equal(time.Date(2021, 1, 2, 4, 0, 0, 0, time.Local)) {
+		t.Errorf("unexpected next %v", next)
+	}
+	if next := (timeOfDay{3, 0}).next(now); !next.Equal(time.Date(2021, 1, 3, 3, 0, 0, 0, time.Local)) {
+		t.Errorf("unexpected next %v", next)
+	}
+}
+
+func TestRestart_Scheduled(t *testing.T) {
+	rt := newRestartTest(t)
+	defer rt.close(t)
+
+	gomock.InOrder(
+		rt.spMock.EXPECT().IsRunning().Return(true),
+		rt.spMock.EXPECT().IsRunning().Return(false),
+	)
+	rt.gwMock.EXPECT().IsDirClean(gomock.Any()).Return(true, nil)
+	rt.spMock.EXPECT().Stop(gomock.Any(), gomock.Any())
+
+	rt.rh.setTimes(rt.sm, []timeOfDay{{4, 0}})
+	if next := rt.rh.Status(context.Background(), rt.sm).Next; next == nil || !next.Equal(rt.now.Add(time.Hour)) {
+		t.Fatalf("unexpected next restart %v", next)
+	}
+
+	rt.fire <- rt.now
+	select {
+	case cmd := <-rt.start.cmds:
+		if cmd[0] != "start" {
+			t.Errorf("expected start, got %v", cmd)
+		}
+	case <-time.After(time.Second * 10):
+		t.Fatalf("timed out waiting for restart. Got: %v", rt.stdoutLog.String())
+	}
+
+	exp := time.Date(2021, 1, 3, 4, 0, 0, 0, time.Local)
+	deadline := time.Now().Add(time.Second * 10)
+	for {
+		next := rt.rh.Status(context.Background(), rt.sm).Next
+		rt.lock.Lock()
+		waiting := len(rt.delays) == 2
+		rt.lock.Unlock()
+		if next != nil && next.Equal(exp) && waiting {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("next restart not scheduled. %v", next)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+	if rt.delays[0] != time.Hour || rt.delays[1] != time.Hour*25 {
+		t.Errorf("unexpected delays %v", rt.delays)
+	}
+	for _, exp := range []string{"next server restart at 20210102-04:00", "restarting server"} {
+		if !strings.Contains(rt.stdoutLog.String(), exp) {
+			t.Errorf("expected: %s, Got: %v", exp, rt.stdoutLog.String())
+		}
+	}
+}
+
+func TestRestart_StartFailure(t *testing.T) {
+	rt := newRestartTest(t)
+	defer rt.close(t)
+
+	// The backup before the restart does not prune.
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeTestConfig(t, path, `{"backup_retention": {"periodic": {"keep_all": "24h"}}}`)
+	rt.sm.config.path = path
+	if err := rt.sm.config.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	rt.start.err = fmt.Errorf("bedrock server not found")
+	gomock.InOrder(
+		rt.spMock.EXPECT().IsRunning().Return(true),
+		rt.spMock.EXPECT().IsRunning().Return(false),
+	)
+	rt.gwMock.EXPECT().IsDirClean(gomock.Any()).Return(true, nil)
+	rt.spMock.EXPECT().Stop(gomock.Any(), gomock.Any())
+
+	err := rt.rh.restart(context.Background(), rt.sm, 0)
+	if err == nil || !strings.Contains(err.Error(), "bedrock server not found") {
+		t.Errorf("expected start error, got %v", err)
+	}
+}
+
+func TestRestart_Commands(t *testing.T) {
+	rt := newRestartTest(t)
+	defer rt.close(t)
+
+	rt.rh.setTimes(rt.sm, []timeOfDay{{4, 0}})
+
+	rt.spMock.EXPECT().IsRunning().Return(false).Times(2)
+	rt.gwMock.EXPECT().IsDirClean(gomock.Any()).Return(true, nil)
+	rt.expectStorageStats()
+	rt.spMock.EXPECT().Stop(gomock.Any(), gomock.Any())
+
+	rt.PushCommandAsync("restart at 05:30")
+	rt.PushCommandAsync("restart cancel")
+	rt.PushCommandAsync("status")
+	rt.PushCommandAsync("restart cancel")
+	rt.PushCommandAsync("restart at 5pm")
+	rt.PushCommandAsync("restart now")
+	rt.PushCommandAsync("quit")
+	if err := rt.sm.Process(context.Background(), []string{}); err != nil {
+		t.Errorf("expecting nil, got %v", err)
+	}
+	for _, exp := range []string{
+		"server restart scheduled at 20210102-05:30",
+		"restart at 20210102-05:30 cancelled. next restart at 20210102-04:00",
+		"next restart at 20210102-04:00",
+		"restart at 20210102-04:00 cancelled. next restart at 20210103-04:00",
+		"invalid time of day '5pm'",
+		"server not running",
+	} {
+		if !strings.Contains(rt.stdoutLog.String(), exp) {
+			t.Errorf("expected: %s, Got: %v", exp, rt.stdoutLog.String())
+		}
+	}
+	if len(rt.start.cmds) != 0 {
+		t.Errorf("server started while not running")
+	}
+}
+
+func TestRestart_NowWithWarningCancelled(t *testing.T) {
+	rt := newRestartTest(t)
+	defer rt.close(t)
+
+	said := make(chan string, 10)
+	rt.spMock.EXPECT().IsRunning().Return(true).AnyTimes()
+	rt.spMock.EXPECT().SendInput(gomock.Any()).AnyTimes().DoAndReturn(func(line string) error {
+		said <- line
+		return nil
+	})
+	waitForSay := func(exp string) {
+		select {
+		case line := <-said:
+			if line != exp {
+				t.Errorf("expected %s, got %s", exp, line)
+			}
+		case <-time.After(time.Second * 10):
+			t.Fatalf("timed out waiting for %s. Got: %v", exp, rt.stdoutLog.String())
+		}
+	}
+
+	// The countdown runs in the background, so the command returns right away.
+	if err := rt.sm.RunCommand(context.Background(), "restart now 10m"); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	if next := rt.rh.Status(context.Background(), rt.sm).Next; next == nil || !next.Equal(rt.now.Add(time.Minute*10)) {
+		t.Fatalf("unexpected next restart %v", next)
+	}
+	rt.fire <- rt.now
+	waitForSay("say Server restarting in 10m0s")
+
+	if err := rt.sm.RunCommand(context.Background(), "restart cancel"); err != nil {
+		t.Fatalf("expecting nil, got %v", err)
+	}
+	waitForSay("say Server restart cancelled")
+	if next := rt.rh.Status(context.Background(), rt.sm).Next; next != nil {
+		t.Errorf("expected no restart scheduled, got %v", next)
+	}
+	rt.lock.Lock()
+	if len(rt.delays) != 1 || rt.delays[0] != 0 {
+		t.Errorf("expected the countdown to start right away, got %v", rt.delays)
+	}
+	rt.lock.Unlock()
+	if len(rt.start.cmds) != 0 {
+		t.Errorf("server restarted after the countdown was cancelled")
+	}
+	for _, exp := range []string{"server restart in 10m0s", "restart at 20210102-03:10 cancelled"} {
+		if !strings.Contains(rt.stdoutLog.String(), exp) {
+			t.Errorf("expected: %s, Got: %v", exp, rt.stdoutLog.String())
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package svrmgr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ResultHandler is implemented by the plugins whose commands produce data.
+// HandleResult runs the command and returns the typed result instead of
+// printing it, so that frontends other than the console can consume it.
+// Handle renders the same result as text for the console.
+type ResultHandler interface {
+	Handler
+	// HandleResult handles the command and returns the result.
+	// Commands without a result are handled as by Handle and return nil.
+	HandleResult(ctx context.Context, provider Provider, cmd []string) (interface{}, error)
+}
+
+// Duration is a time.Duration encoded as a string such as "30m0s" in JSON.
+type Duration time.Duration
+
+// MarshalJSON encodes the duration as a string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// ErrorKind classifies the command failures, so that frontends can report them.
+// For example, the HTTP API maps them to the status codes.
+type ErrorKind int
+
+const (
+	// ErrorKindInternal is a failure of the command, such as a failed git command.
+	ErrorKindInternal ErrorKind = iota
+	// ErrorKindInvalidArgs is returned for invalid or missing command arguments.
+	ErrorKindInvalidArgs
+	// ErrorKindNotFound is returned if the backup, player or schedule does not exist.
+	ErrorKindNotFound
+	// ErrorKindConflict is returned if the command is not allowed in the current state,
+	// such as restoring while the server is running or the workspace has changes.
+	ErrorKindConflict
+)
+
+// CommandError is a command failure with its kind.
+type CommandError struct {
+	Kind ErrorKind
+	Msg  string
+}
+
+func (e *CommandError) Error() string {
+	return e.Msg
+}
+
+func invalidArgsErrorf(format string, args ...interface{}) error {
+	return &CommandError{Kind: ErrorKindInvalidArgs, Msg: fmt.Sprintf(format, args...)}
+}
+
+func notFoundErrorf(format string, args ...interface{}) error {
+	return &CommandError{Kind: ErrorKindNotFound, Msg: fmt.Sprintf(format, args...)}
+}
+
+func conflictErrorf(format string, args ...interface{}) error {
+	return &CommandError{Kind: ErrorKindConflict, Msg: fmt.Sprintf(format, args...)}
+}
+
+// errorKind returns the kind of the error. Errors other than CommandError are internal.
+func errorKind(err error) ErrorKind {
+	var ce *CommandError
+	if errors.As(err, &ce) {
+		return ce.Kind
+	}
+	return ErrorKindInternal
+}
@@ -0,0 +1,141 @@
+package svrmgr
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// retentionDefaultKey is the backup_retention key for the policy applied to the
+// automatic backup types without their own policy. Manual, temp and imported backups
+// are pruned only if they have their own policy.
+const retentionDefaultKey = "default"
+
+// retentionConfig is the retention policy of a backup type in the config file.
+// Each value is how far back the tier reaches, for example "7d". Empty disables the tier.
+type retentionConfig struct {
+	KeepAll string `json:"keep_all"` // Keep every backup.
+	Hourly  string `json:"hourly"`   // Keep the newest backup of every hour.
+	Daily   string `json:"daily"`    // Keep the newest backup of every day.
+	Weekly  string `json:"weekly"`   // Keep the newest backup of every week.
+	Monthly string `json:"monthly"`  // Keep the newest backup of every month.
+}
+
+// retentionTier keeps the newest backup of every period within its window.
+type retentionTier struct {
+	name   string
+	window time.Duration
+	period func(t time.Time) string // Identifies the period of the backup time.
+}
+
+// retentionPolicy is the grandfather-father-son retention policy.
+// A backup is kept if any tier keeps it. The newest backup and the active backup are always kept.
+type retentionPolicy struct {
+	keepAll time.Duration
+	tiers   []retentionTier
+}
+
+// newRetentionPolicy parses the retention policy.
+func newRetentionPolicy(rc retentionConfig) (*retentionPolicy, error) {
+	parse := func(name, str string) (time.Duration, error) {
+		if str == "" {
+			return 0, nil
+		}
+		d, err := parseDuration(str)
+		if err != nil || d < 0 {
+			return 0, fmt.Errorf("invalid %s '%s'", name, str)
+		}
+		return d, nil
+	}
+
+	p := &retentionPolicy{}
+	var err error
+	if p.keepAll, err = parse("keep_all", rc.KeepAll); err != nil {
+		return nil, err
+	}
+	tiers := []struct {
+		name   string
+		value  string
+		period func(t time.Time) string
+	}{
+		{"hourly", rc.Hourly, func(t time.Time) string { return t.Format("2006010215") }},
+		{"daily", rc.Daily, func(t time.Time) string { return t.Format("20060102") }},
+		{"weekly", rc.Weekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-%d", year, week)
+		}},
+		{"monthly", rc.Monthly, func(t time.Time) string { return t.Format("200601") }},
+	}
+	for _, tier := range tiers {
+		window, err := parse(tier.name, tier.value)
+		if err != nil {
+			return nil, err
+		}
+		if window > 0 {
+			p.tiers = append(p.tiers, retentionTier{tier.name, window, tier.period})
+		}
+	}
+	if p.keepAll == 0 && len(p.tiers) == 0 {
+		return nil, fmt.Errorf("at least one of keep_all, hourly, daily, weekly or monthly must be set")
+	}
+	return p, nil
+}
+
+func (p *retentionPolicy) String() string {
+	var parts []string
+	if p.keepAll > 0 {
+		parts = append(parts, fmt.Sprintf("keep all %v", p.keepAll))
+	}
+	for _, t := range p.tiers {
+		parts = append(parts, fmt.Sprintf("%s %v", t.name, t.window))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// expired returns the backups not kept by the policy, oldest first.
+func (p *retentionPolicy) expired(backups []GitReference, now time.Time) []GitReference {
+	sorted := append([]GitReference{}, backups...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].CommitDate.After(sorted[j].CommitDate)
+	})
+
+	seen := make([]map[string]bool, len(p.tiers))
+	for i := range seen {
+		seen[i] = map[string]bool{}
+	}
+
+	var result []GitReference
+	for i, b := range sorted {
+		age := now.Sub(b.CommitDate)
+		keep := i == 0 || b.IsHead || age <= p.keepAll
+		for ti, tier := range p.tiers {
+			if age > tier.window {
+				continue
+			}
+			period := tier.period(b.CommitDate.Local())
+			if !seen[ti][period] {
+				seen[ti][period] = true
+				keep = true
+			}
+		}
+		if !keep {
+			result = append(result, b)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CommitDate.Before(result[j].CommitDate)
+	})
+	return result
+}
+
+// backupTypeOf returns the type of the backup branch saves/TYPE/DATE_TIME.
+// Returns empty if the branch is not a backup.
+func backupTypeOf(ref string) backupType {
+	parts := strings.Split(ref, "/")
+	if len(parts) != 3 || parts[0] != "saves" {
+		return ""
+	}
+	return backupType(parts[1])
+}
@@ -0,0 +1,64 @@
+package svrmgr
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetentionPolicy(t *testing.T) {
+	p, err := newRetentionPolicy(retentionConfig{KeepAll: "24h", Daily: "7d", Weekly: "30d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.String() != "keep all 24h0m0s, daily 168h0m0s, weekly 720h0m0s" {
+		t.Errorf("unexpected policy %v", p)
+	}
+
+	// Wednesday.
+	now := time.Date(2021, 3, 10, 12, 0, 0, 0, time.Local)
+	at := func(month time.Month, day, hour int) time.Time {
+		return time.Date(2021, month, day, hour, 0, 0, 0, time.Local)
+	}
+	head := newTestBranch("saves/periodic/", at(1, 2, 0))
+	head.IsHead = true
+	backups := []GitReference{
+		newTestBranch("saves/periodic/", now.Add(-time.Hour)),
+		newTestBranch("saves/periodic/", at(3, 8, 10)), // Newest of the day.
+		newTestBranch("saves/periodic/", at(3, 8, 8)),  // Same day and week.
+		newTestBranch("saves/periodic/", at(3, 5, 9)),  // Newest of the day.
+		newTestBranch("saves/periodic/", at(2, 20, 9)), // Newest of the week.
+		newTestBranch("saves/periodic/", at(2, 19, 9)), // Same week.
+		newTestBranch("saves/periodic/", at(1, 1, 0)),  // Too old.
+		head,
+	}
+	expired := p.expired(backups, now)
+	if len(expired) != 3 || !expired[0].CommitDate.Equal(at(1, 1, 0)) ||
+		!expired[1].CommitDate.Equal(at(2, 19, 9)) || !expired[2].CommitDate.Equal(at(3, 8, 8)) {
+		t.Errorf("unexpected expired backups %v", expired)
+	}
+
+	// Newest backup is always kept.
+	p, _ = newRetentionPolicy(retentionConfig{KeepAll: "1h"})
+	if expired = p.expired(backups[6:7], now); len(expired) != 0 {
+		t.Errorf("newest backup expired. %v", expired)
+	}
+
+	for _, rc := range []retentionConfig{{}, {Daily: "x"}, {Hourly: "-1h"}} {
+		if _, err := newRetentionPolicy(rc); err == nil {
+			t.Errorf("%+v: expected error", rc)
+		}
+	}
+}
+
+func TestBackupTypeOf(t *testing.T) {
+	for ref, exp := range map[string]backupType{
+		"saves/periodic/20210102-010000": backupTypePeriodic,
+		"saves/nightly/20210102-010000":  "nightly",
+		"master":                         "",
+		"saves/x":                        "",
+	} {
+		if bt := backupTypeOf(ref); bt != exp {
+			t.Errorf("%s: expected %s, got %s", ref, exp, bt)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package svrmgr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// savedFile is a world file reported by `save query`.
+// Only the first Length bytes of the file are consistent and must be copied.
+type savedFile struct {
+	Path   string // Path relative to the worlds directory.
+	Length int64
+}
+
+// parseSaveQueryFiles parses the file list printed by `save query` after
+// the save completed marker. The list is of the form
+// `LEVEL/db/000005.ldb:1234, LEVEL/level.dat:2040, ...`
+func parseSaveQueryFiles(line string) ([]savedFile, error) {
+	line = strings.Trim(line, " \r\n\t")
+	if line == "" {
+		return nil, fmt.Errorf("empty file list")
+	}
+
+	var result []savedFile
+	for _, entry := range strings.Split(line, ", ") {
+		sep := strings.LastIndex(entry, ":")
+		if sep <= 0 {
+			return nil, fmt.Errorf("invalid file entry '%s'", entry)
+		}
+		length, err := strconv.ParseInt(entry[sep+1:], 10, 64)
+		if err != nil || length < 0 {
+			return nil, fmt.Errorf("invalid length in file entry '%s'", entry)
+		}
+		result = append(result, savedFile{
+			Path:   entry[:sep],
+			Length: length,
+		})
+	}
+	return result, nil
+}
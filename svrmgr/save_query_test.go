@@ -0,0 +1,120 @@
+package svrmgr
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSaveQueryFiles(t *testing.T) {
+	tests := []struct {
+		line string
+		exp  []savedFile
+	}{
+		{
+			line: "Bedrock level/db/000003.log:0, Bedrock level/db/000005.ldb:1234, Bedrock level/db/CURRENT:16, " +
+				"Bedrock level/db/MANIFEST-000004:109, Bedrock level/level.dat:2040, Bedrock level/level.dat_old:2040, " +
+				"Bedrock level/levelname.txt:13\r\n",
+			exp: []savedFile{
+				{"Bedrock level/db/000003.log", 0},
+				{"Bedrock level/db/000005.ldb", 1234},
+				{"Bedrock level/db/CURRENT", 16},
+				{"Bedrock level/db/MANIFEST-000004", 109},
+				{"Bedrock level/level.dat", 2040},
+				{"Bedrock level/level.dat_old", 2040},
+				{"Bedrock level/levelname.txt", 13},
+			},
+		},
+		{
+			line: "world/db/LOCK:0",
+			exp:  []savedFile{{"world/db/LOCK", 0}},
+		},
+	}
+	for _, tc := range tests {
+		files, err := parseSaveQueryFiles(tc.line)
+		if err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+		if !reflect.DeepEqual(files, tc.exp) {
+			t.Errorf("expected %v, got %v", tc.exp, files)
+		}
+	}
+}
+
+func TestParseSaveQueryFiles_Invalid(t *testing.T) {
+	for _, line := range []string{
+		"",
+		"file list...",
+		"Bedrock level/db/CURRENT:abc",
+		"Bedrock level/db/CURRENT:-1",
+		"Bedrock level/db/CURRENT:16, :20",
+	} {
+		if _, err := parseSaveQueryFiles(line); err == nil {
+			t.Errorf("expected error for '%s'", line)
+		}
+	}
+}
+
+func TestStageSavedFiles(t *testing.T) {
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git not found")
+	}
+	wsDir := t.TempDir()
+	gw := &gitWrapper{exe: gitPath, wsDir: wsDir}
+	ctx := context.Background()
+
+	writeFile := func(path, content string) {
+		path = filepath.Join(wsDir, path)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("server.properties", "level-name=world")
+	writeFile("worlds/world/level.dat", "level data")
+	writeFile("worlds/world/db/MANIFEST-000001", "manifest, partially written tail")
+	writeFile("worlds/world/db/000001.ldb", "obsolete")
+
+	if _, err = gw.RunGitCommand(ctx, "init", "."); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = gw.RunGitCommand(ctx, "add", "."); err != nil {
+		t.Fatal(err)
+	}
+
+	err = gw.StageSavedFiles(ctx, filepath.Join(wsDir, "worlds"), []savedFile{
+		{"world/level.dat", 10},
+		{"world/db/MANIFEST-000001", 8},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	out, err := gw.RunGitCommand(ctx, "ls-files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := "server.properties\nworlds/world/db/MANIFEST-000001\nworlds/world/level.dat\n"
+	if out != exp {
+		t.Errorf("expected staged files %q, got %q", exp, out)
+	}
+
+	out, err = gw.RunGitCommand(ctx, "show", ":worlds/world/db/MANIFEST-000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "manifest" {
+		t.Errorf("expected truncated content, got %q", out)
+	}
+
+	// Live files must not be touched.
+	content, _ := os.ReadFile(filepath.Join(wsDir, "worlds/world/db/MANIFEST-000001"))
+	if !strings.HasSuffix(string(content), "tail") {
+		t.Errorf("live file modified: %q", content)
+	}
+}
@@ -0,0 +1,127 @@
+package svrmgr
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+func TestStop_Graceful(t *testing.T) {
+	st := newSvrMgrTest(t)
+	defer st.close(t)
+
+	gomock.InOrder(
+		st.spMock.EXPECT().Stop(gomock.Any(), *stopTimeout).Return(nil),
+		st.spMock.EXPECT().Stop(gomock.Any(), gomock.Any()),
+	)
+
+	st.PushCommandAsync("stop")
+	st.PushCommandAsync("quit")
+
+	err := st.sm.Process(context.Background(), []string{})
+	if err != nil {
+		t.Errorf("expecting nil, got %v", err)
+	}
+}
+
+func TestStop_Failure(t *testing.T) {
+	st := newSvrMgrTest(t)
+	defer st.close(t)
+
+	gomock.InOrder(
+		st.spMock.EXPECT().Stop(gomock.Any(), gomock.Any()).Return(fmt.Errorf("kill failed")),
+		st.spMock.EXPECT().Stop(gomock.Any(), gomock.Any()),
+	)
+
+	st.PushCommandAsync("stop")
+	st.PushCommandAsync("quit")
+
+	err := st.sm.Process(context.Background(), []string{})
+	if err != nil {
+		t.Errorf("expecting nil, got %v", err)
+	}
+	exp := "unable to stop server. kill failed"
+	if !strings.Contains(st.stdoutLog.String(), exp) {
+		t.Errorf("expected: %s, Got: %v", exp, st.stdoutLog.String())
+	}
+}
+
+func TestStop_Countdown(t *testing.T) {
+	st := newSvrMgrTest(t)
+	defer st.close(t)
+
+	var warnings []string
+	st.spMock.EXPECT().IsRunning().Return(true)
+	st.spMock.EXPECT().SendInput(gomock.Any()).AnyTimes().DoAndReturn(func(inp string) error {
+		warnings = append(warnings, inp)
+		return nil
+	})
+	gomock.InOrder(
+		st.spMock.EXPECT().Stop(gomock.Any(), gomock.Any()).Return(nil),
+		st.spMock.EXPECT().Stop(gomock.Any(), gomock.Any()),
+	)
+
+	st.PushCommandAsync("stop 1s")
+	st.PushCommandAsync("quit")
+
+	err := st.sm.Process(context.Background(), []string{})
+	if err != nil {
+		t.Errorf("expecting nil, got %v", err)
+	}
+	if len(warnings) != 1 || warnings[0] != "say Server stopping in 1s" {
+		t.Errorf("unexpected warnings: %v", warnings)
+	}
+}
+
+func TestStop_InvalidWarning(t *testing.T) {
+	st := newSvrMgrTest(t)
+	defer st.close(t)
+
+	st.spMock.EXPECT().Stop(gomock.Any(), gomock.Any())
+
+	st.PushCommandAsync("stop soon")
+	st.PushCommandAsync("quit")
+
+	err := st.sm.Process(context.Background(), []string{})
+	if err != nil {
+		t.Errorf("expecting nil, got %v", err)
+	}
+	exp := "invalid warning period"
+	if !strings.Contains(st.stdoutLog.String(), exp) {
+		t.Errorf("expected: %s, Got: %v", exp, st.stdoutLog.String())
+	}
+}
+
+func TestStop_NotRunning(t *testing.T) {
+	proc := NewProcess(nil, nil)
+	if err := proc.Stop(context.Background(), time.Second); err != nil {
+		t.Errorf("expecting nil, got %v", err)
+	}
+}
+
+func TestBroadcastCountdown_Marks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	proc := NewMockServerProcess(ctrl)
+
+	var warnings []string
+	proc.EXPECT().SendInput(gomock.Any()).AnyTimes().DoAndReturn(func(inp string) error {
+		warnings = append(warnings, inp)
+		return nil
+	})
+
+	// Cancelled context returns after the first warning.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := broadcastCountdown(ctx, proc, time.Minute*6, "restarting")
+	if err != context.Canceled {
+		t.Errorf("expecting context.Canceled, got %v", err)
+	}
+	if len(warnings) != 1 || warnings[0] != "say Server restarting in 6m0s" {
+		t.Errorf("unexpected warnings: %v", warnings)
+	}
+}
@@ -0,0 +1,190 @@
+package svrmgr
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+type supervisorTest struct {
+	ctrl     *gomock.Controller
+	provider *MockProvider
+	sh       *supervisorHandler
+	now      time.Time
+	restarts chan string
+	delays   []time.Duration
+}
+
+func newSupervisorTest(t *testing.T, policy restartPolicy) *supervisorTest {
+	st := &supervisorTest{
+		now:      time.Date(2021, 1, 2, 1, 0, 0, 0, time.UTC),
+		restarts: make(chan string, 10),
+	}
+	st.ctrl = gomock.NewController(t)
+	st.provider = NewMockProvider(st.ctrl)
+	st.provider.EXPECT().Log(gomock.Any()).AnyTimes()
+	st.provider.EXPECT().RunCommand(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(func(ctx context.Context, cmd string) error {
+		st.restarts <- cmd
+		return nil
+	})
+	st.sh = &supervisorHandler{
+		policy: policy,
+		nowFn: func() time.Time {
+			return st.now
+		},
+		afterFn: func(d time.Duration) <-chan time.Time {
+			st.delays = append(st.delays, d)
+			ch := make(chan time.Time, 1)
+			ch <- st.now
+			return ch
+		},
+	}
+	return st
+}
+
+func (st *supervisorTest) crash() {
+	st.sh.onServerExit(st.provider, ServerExit{
+		Time:      st.now,
+		Err:       fmt.Errorf("exit status 1"),
+		LastLines: []LogLine{{Line: "last words", Time: st.now}},
+	})
+}
+
+func (st *supervisorTest) expectRestart(t *testing.T) {
+	select {
+	case cmd := <-st.restarts:
+		if cmd != "start" {
+			t.Errorf("expected start, got %s", cmd)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("server was not restarted")
+	}
+}
+
+func (st *supervisorTest) expectNoRestart(t *testing.T) {
+	select {
+	case cmd := <-st.restarts:
+		t.Errorf("unexpected command %s", cmd)
+	case <-time.After(time.Millisecond * 50):
+	}
+}
+
+func TestSupervisor_RestartOnCrash(t *testing.T) {
+	st := newSupervisorTest(t, restartPolicyOnFailure)
+	defer st.ctrl.Finish()
+
+	st.crash()
+	st.expectRestart(t)
+	if len(st.sh.crashes) != 1 {
+		t.Errorf("expected 1 crash recorded, got %d", len(st.sh.crashes))
+	}
+}
+
+func TestSupervisor_NoRestartOnIntentionalStop(t *testing.T) {
+	st := newSupervisorTest(t, restartPolicyAlways)
+	defer st.ctrl.Finish()
+
+	st.sh.onServerExit(st.provider, ServerExit{Time: st.now, Intentional: true})
+	st.expectNoRestart(t)
+	if len(st.sh.crashes) != 0 {
+		t.Errorf("intentional stop recorded as crash")
+	}
+}
+
+func TestSupervisor_Policies(t *testing.T) {
+	tests := []struct {
+		policy  restartPolicy
+		err     error
+		restart bool
+	}{
+		{restartPolicyNever, fmt.Errorf("exit status 1"), false},
+		{restartPolicyOnFailure, nil, false},
+		{restartPolicyAlways, nil, true},
+	}
+	for _, tc := range tests {
+		st := newSupervisorTest(t, tc.policy)
+		st.sh.onServerExit(st.provider, ServerExit{Time: st.now, Err: tc.err})
+		if tc.restart {
+			st.expectRestart(t)
+		} else {
+			st.expectNoRestart(t)
+		}
+		st.ctrl.Finish()
+	}
+}
+
+func TestSupervisor_CrashLoop(t *testing.T) {
+	st := newSupervisorTest(t, restartPolicyOnFailure)
+	defer st.ctrl.Finish()
+
+	for i := 0; i < *restartMaxCrashes-1; i++ {
+		st.crash()
+		st.expectRestart(t)
+		st.now = st.now.Add(time.Second)
+	}
+	st.crash()
+	st.expectNoRestart(t)
+
+	exp := []time.Duration{*restartBackoff, *restartBackoff * 2, *restartBackoff * 4, *restartBackoff * 8}
+	if fmt.Sprint(st.delays) != fmt.Sprint(exp) {
+		t.Errorf("expected delays %v, got %v", exp, st.delays)
+	}
+
+	status := st.sh.Status(context.Background(), st.provider)
+	if !status.Suspended || !strings.Contains(status.String(), "restart suspended") {
+		t.Errorf("unexpected status: %s", status)
+	}
+
+	// Crashes outside the window are forgotten.
+	st.sh.Reset(context.Background(), st.provider)
+	st.now = st.now.Add(*restartCrashWindow)
+	st.crash()
+	st.expectRestart(t)
+}
+
+func TestSupervisor_CancelRestart(t *testing.T) {
+	st := newSupervisorTest(t, restartPolicyOnFailure)
+	defer st.ctrl.Finish()
+	st.sh.afterFn = func(d time.Duration) <-chan time.Time {
+		return make(chan time.Time)
+	}
+
+	st.crash()
+	st.sh.cancelRestart()
+	st.expectNoRestart(t)
+}
+
+func TestRestartDelay(t *testing.T) {
+	if d := restartDelay(0); d != *restartBackoff {
+		t.Errorf("expected %v, got %v", *restartBackoff, d)
+	}
+	if d := restartDelay(100); d != *restartBackoffMax {
+		t.Errorf("expected %v, got %v", *restartBackoffMax, d)
+	}
+}
+
+func TestProcess_StatusRestartPolicy(t *testing.T) {
+	st := newSvrMgrTest(t)
+	defer st.close(t)
+
+	st.gwMock.EXPECT().IsDirClean(gomock.Any()).Return(true, nil)
+	st.expectStorageStats()
+	st.spMock.EXPECT().IsRunning().Return(false)
+	st.spMock.EXPECT().Stop(gomock.Any(), gomock.Any())
+
+	st.PushCommandAsync("supervisor policy always")
+	st.PushCommandAsync("status")
+	st.PushCommandAsync("quit")
+	err := st.sm.Process(context.Background(), []string{})
+	if err != nil {
+		t.Errorf("expecting nil, got %v", err)
+	}
+	exp := "restart policy: always"
+	if !strings.Contains(st.stdoutLog.String(), exp) {
+		t.Errorf("expected: %s, Got: %v", exp, st.stdoutLog.String())
+	}
+}
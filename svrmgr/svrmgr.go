@@ -10,6 +10,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/golang/glog"
 )
@@ -20,6 +21,7 @@ import (
 var ErrExit = errors.New("exiting the session")
 
 // aliases list
+// Additional aliases can be defined in the config file.
 var aliases = map[string]string{
 	"bs":        "backup save",
 	"br":        "backup restore",
@@ -35,6 +37,8 @@ var aliases = map[string]string{
 	"$":         "shell",
 	"wc":        "backup clean",
 	"@":         "server",
+	"sv":        "supervisor",
+	"cfg":       "config",
 }
 
 var gitWorkspaceDir = flag.String("git_workspace", "", "git root directory for the world. If not specified, uses bedrock server directory")
@@ -44,6 +48,16 @@ type Handler interface {
 	Handle(ctx context.Context, provider Provider, cmd []string) error
 }
 
+// serverExitListener is implemented by plugins that need to know when the server exits.
+type serverExitListener interface {
+	onServerExit(provider Provider, exit ServerExit)
+}
+
+// serverOutputListener is implemented by plugins that need to parse the server output.
+type serverOutputListener interface {
+	onServerOutput(provider Provider, line LogLine)
+}
+
 // ServerManager contains the main server manager logic
 type ServerManager struct {
 	// List of all registered handlers
@@ -52,38 +66,84 @@ type ServerManager struct {
 	// Initialized and never nil.
 	serverProcess ServerProcess
 	gw            GitWrapper
+	config        *config
+	events        *EventBus
 	stdin         io.Reader
 	stdout        io.Writer
+	// Serializes starting and stopping the server, from the console and the API.
+	serverLock sync.Mutex
 }
 
 // NewServerManager creates a new server manager
-// Should be called only once.
-func NewServerManager() *ServerManager {
+// Should be called only once. Returns error if the config file cannot be loaded.
+func NewServerManager() (*ServerManager, error) {
 	sm := &ServerManager{}
-	sm.serverProcess = NewProcess(sm, nil)
+	sm.config = newConfig(*configFile)
+	if err := sm.config.Load(); err != nil {
+		return nil, err
+	}
+	sm.events = NewEventBus()
+	go sm.dispatchEvents(sm.events.Subscribe(defaultSubscriptionBuffer, EventServerOutput, EventServerStopped, EventServerCrashed))
+	proc := NewProcess(sm, nil)
+	sm.serverProcess = proc
 	sm.stdin = os.Stdin
 	sm.stdout = os.Stdout
 	sm.handlers = map[string]Handler{}
 
 	sm.loadPlugings()
+	serverDir := filepath.Dir(getBedrockServerPath())
+	// Files written by the manager are not part of the world.
+	var excluded []string
+	if *serverLogDir != "" {
+		logDir := *serverLogDir
+		if !filepath.IsAbs(logDir) {
+			logDir = filepath.Join(serverDir, logDir)
+		}
+		proc.logFile = newServerLogWriter(logDir, *serverLogMaxSize, *serverLogRetention)
+		excluded = append(excluded, logDir)
+	}
+	if *playerSessionsFile != "" {
+		path := *playerSessionsFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(serverDir, path)
+		}
+		sm.handlers["players"].(*playersHandler).store = newPlayerSessionStore(path)
+		excluded = append(excluded, path)
+	}
 	wsDir := *gitWorkspaceDir
 	if wsDir == "" {
-		wsDir = filepath.Dir(getBedrockServerPath())
+		wsDir = serverDir
 	}
 	sm.gw = newGitWrapper(wsDir)
+	sm.excludeFromBackups(context.Background(), excluded)
 
-	return sm
+	return sm, nil
 }
 
 //newServerManagerForTests create new servermanager for tests.
 func newServerManagerForTests() *ServerManager {
 	sm := &ServerManager{}
-	sm.serverProcess = NewProcess(sm, nil)
+	sm.config = newConfig("")
+	sm.events = NewEventBus()
+	go sm.dispatchEvents(sm.events.Subscribe(defaultSubscriptionBuffer, EventServerOutput, EventServerStopped, EventServerCrashed))
+	proc := NewProcess(sm, nil)
+	sm.serverProcess = proc
 	sm.handlers = map[string]Handler{}
 
 	return sm
 }
 
+// excludeFromBackups excludes the files written by the manager from the backups.
+// Otherwise they are committed by every backup, keep the workspace dirty and are rolled back by restore.
+func (sm *ServerManager) excludeFromBackups(ctx context.Context, paths []string) {
+	if len(paths) == 0 {
+		return
+	}
+	if err := sm.gw.ExcludePaths(ctx, paths); err != nil {
+		glog.Warningf("unable to exclude %v from the backups. %v", paths, err)
+	}
+}
+
 // loadPlugings loads all the plugins in the sytem.
 // New plugin must be registered here.
 func (sm *ServerManager) loadPlugings() {
@@ -91,10 +151,51 @@ func (sm *ServerManager) loadPlugings() {
 	initHelpHandler(sm)
 	initServerCmdHandler(sm)
 	initShellCmdHandler(sm)
-	initBackupHandler(sm)
-	initStartHandler(sm)
-	initStopHandler(sm)
+	initBackupHandler(sm, sm.config)
+	initStartHandler(sm, &sm.serverLock)
+	initStopHandler(sm, &sm.serverLock)
 	initStatusHandler(sm)
+	initSupervisorHandler(sm, sm.config)
+	initRestartHandler(sm, sm.config)
+	initLogHandler(sm)
+	initConfigHandler(sm, sm.config)
+	initPlayersHandler(sm)
+}
+
+// dispatchEvents notifies the plugins of the server events.
+// Runs until the subscription is cancelled.
+func (sm *ServerManager) dispatchEvents(sub *Subscription) {
+	for {
+		select {
+		case ev := <-sub.C:
+			switch ev.Type {
+			case EventServerOutput:
+				sm.notifyServerOutput(*ev.Line)
+			case EventServerStopped, EventServerCrashed:
+				sm.notifyServerExit(*ev.Exit)
+			}
+		case <-sub.Done():
+			return
+		}
+	}
+}
+
+// notifyServerExit notifies all the interested plugins that the server exited.
+func (sm *ServerManager) notifyServerExit(exit ServerExit) {
+	for _, h := range sm.handlers {
+		if l, ok := h.(serverExitListener); ok {
+			l.onServerExit(sm, exit)
+		}
+	}
+}
+
+// notifyServerOutput notifies all the interested plugins of the server output line.
+func (sm *ServerManager) notifyServerOutput(line LogLine) {
+	for _, h := range sm.handlers {
+		if l, ok := h.(serverOutputListener); ok {
+			l.onServerOutput(sm, line)
+		}
+	}
 }
 
 // printHelp - print interactive help message
@@ -106,6 +207,9 @@ func (sm *ServerManager) printHelp() {
 func (sm *ServerManager) Process(ctx context.Context, args []string) error {
 	reader := bufio.NewReader(sm.stdin)
 	sm.printHelp()
+	if *apiAddress != "" {
+		go sm.serveAPI(ctx, *apiAddress)
+	}
 
 	// Main interactive promt and user input handling.
 	// TODO: Make it so that the server output automatically reprints the prompt.
@@ -132,25 +236,20 @@ func (sm *ServerManager) Process(ctx context.Context, args []string) error {
 
 // handleCommand handles a single command and dispatches to the plugin.
 func (sm *ServerManager) handleCommand(ctx context.Context, cmd string) error {
-	var err error
 	// Expand aliases
 	glog.Infof("handling command '%s'", cmd)
 	parts := strings.Split(cmd, " ")
-	al, ok := aliases[parts[0]]
+	al, ok := sm.config.Alias(parts[0])
+	if !ok {
+		al, ok = aliases[parts[0]]
+	}
 	if ok {
 		glog.Infof("alias found, '%s' = '%s'", parts[0], al)
 		parts = append(strings.Split(al, " "), parts[1:]...)
 		glog.Infof("expanded alias to '%s'", strings.Join(parts, " "))
 	}
 
-	h, ok := sm.handlers[parts[0]]
-	if !ok {
-		sm.Log(fmt.Sprintf("invalid command '%s'\n", parts[0]))
-		return nil
-	}
-
-	glog.Infof("Handler found, invoking")
-	err = h.Handle(ctx, sm, parts)
+	err := sm.dispatchCommand(ctx, sm, parts)
 	if err != nil {
 		sm.Log(err.Error())
 	}
@@ -161,3 +260,38 @@ func (sm *ServerManager) handleCommand(ctx context.Context, cmd string) error {
 
 	return nil
 }
+
+// dispatchCommand invokes the plugin for the command with the given provider.
+// Returns the plugin error.
+func (sm *ServerManager) dispatchCommand(ctx context.Context, provider Provider, parts []string) error {
+	h, ok := sm.handlers[parts[0]]
+	if !ok {
+		return invalidArgsErrorf("invalid command '%s'", parts[0])
+	}
+
+	glog.Infof("Handler found, invoking")
+	return h.Handle(ctx, provider, parts)
+}
+
+// dispatchCommandResult invokes the plugin for the command with the given provider.
+// Returns the typed result if the plugin implements ResultHandler, nil otherwise.
+func (sm *ServerManager) dispatchCommandResult(ctx context.Context, provider Provider, parts []string) (interface{}, error) {
+	h, ok := sm.handlers[parts[0]]
+	if !ok {
+		return nil, invalidArgsErrorf("invalid command '%s'", parts[0])
+	}
+
+	if rh, ok := h.(ResultHandler); ok {
+		glog.Infof("Result handler found, invoking")
+		return rh.HandleResult(ctx, provider, parts)
+	}
+	glog.Infof("Handler found, invoking")
+	return nil, h.Handle(ctx, provider, parts)
+}
+
+// Shutdown stops the server gracefully.
+// Called when the manager is asked to terminate, for example by SIGTERM.
+func (sm *ServerManager) Shutdown(ctx context.Context) error {
+	sm.Log("shutting down")
+	return sm.RunCommand(ctx, "stop")
+}
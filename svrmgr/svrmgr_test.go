@@ -22,7 +22,7 @@ func TestProcess_Basic(t *testing.T) {
 	t.Logf("starting process")
 	st.PushCommandAsync("quit")
 	t.Logf("starting process")
-	st.spMock.EXPECT().Kill()
+	st.spMock.EXPECT().Stop(gomock.Any(), gomock.Any())
 
 	err := st.sm.Process(context.Background(), []string{})
 	if err != nil {
@@ -39,8 +39,9 @@ func TestProcess_Status(t *testing.T) {
 	defer st.close(t)
 
 	st.gwMock.EXPECT().IsDirClean(gomock.Any()).Return(true, nil)
+	st.expectStorageStats()
 	st.spMock.EXPECT().IsRunning().Return(false)
-	st.spMock.EXPECT().Kill()
+	st.spMock.EXPECT().Stop(gomock.Any(), gomock.Any())
 
 	st.PushCommandAsync("status")
 	st.PushCommandAsync("quit")
@@ -48,9 +49,13 @@ func TestProcess_Status(t *testing.T) {
 	if err != nil {
 		t.Errorf("expecting nil, got %v", err)
 	}
-	exp := "server is not running, workspace is clean, automatic backup interval: 30m0s"
-	if !strings.Contains(st.stdoutLog.String(), exp) {
-		t.Errorf("expected: %s, Got: %v", exp, st.stdoutLog.String())
+	for _, exp := range []string{
+		"server is not running, workspace is clean, automatic backup interval: 30m0s",
+		"0 backups using 2.0 KiB",
+	} {
+		if !strings.Contains(st.stdoutLog.String(), exp) {
+			t.Errorf("expected: %s, Got: %v", exp, st.stdoutLog.String())
+		}
 	}
 }
 
@@ -59,7 +64,7 @@ func TestProcess_StartServerAlreadyRunning(t *testing.T) {
 	defer st.close(t)
 
 	st.spMock.EXPECT().IsRunning().Return(true)
-	st.spMock.EXPECT().Kill()
+	st.spMock.EXPECT().Stop(gomock.Any(), gomock.Any())
 
 	st.PushCommandAsync("start")
 	st.PushCommandAsync("quit")
@@ -90,8 +95,8 @@ func TestProcess_StartServer(t *testing.T) {
 			t.Logf("finished writing server output marker")
 		}()
 	})
-	st.spMock.EXPECT().EndReadOutput()
-	st.spMock.EXPECT().Kill()
+	st.spMock.EXPECT().EndReadOutput(gomock.Any())
+	st.spMock.EXPECT().Stop(gomock.Any(), gomock.Any())
 
 	st.PushCommandAsync("start")
 	st.PushCommandAsync("quit")
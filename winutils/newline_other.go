@@ -0,0 +1,9 @@
+//go:build !windows
+// +build !windows
+
+package winutils
+
+// NewLine returns the platform specific new line.
+func NewLine() string {
+	return "\n"
+}
@@ -0,0 +1,6 @@
+package winutils
+
+// NewLine returns the platform specific new line.
+func NewLine() string {
+	return "\r\n"
+}
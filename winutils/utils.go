@@ -1,9 +1,6 @@
 package winutils
 
-func NewLine() string {
-	return "\r\n"
-}
-
+// AddNewLine appends the platform specific new line to the string.
 func AddNewLine(str string) string {
 	return str + NewLine()
 }